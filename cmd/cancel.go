@@ -0,0 +1,175 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var cancelSampleId string
+var cancelTimeoutForCommand time.Duration
+var cancelScancelFlag bool
+var cancelToilCleanFlag bool
+var cancelForceFlag bool
+
+// cancelCmd represents the cancel command
+var cancelCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel running sample",
+	Long: `Cancel running sample started by 'run' from another terminal.
+SIGTERM is sent to toil-cwl-runner of the sample, and the execution is marked as cancelled.
+This command must be executed on the same host as 'run'.
+If heartbeat of the execution is old, 'run' may be killed and its process group id may be reused,
+so signal is not sent unless '--force' is set.
+
+If '--scancel' is set, Slurm jobs recorded in the jobManager directory of the sample are cancelled by scancel.
+If '--toil-clean' is set, jobStore is removed by 'toil clean' after toil-cwl-runner is stopped. The sample can not be resumed after that.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cancelMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cancelCmd)
+
+	cancelCmd.Flags().StringVarP(&cancelSampleId, "sample", "", "", "Sample ID to cancel")
+	cancelCmd.Flags().DurationVarP(&cancelTimeoutForCommand, "timeout", "", 2*time.Minute, "Wait time for toil-cwl-runner to stop after SIGTERM, then it is killed")
+	cancelCmd.Flags().BoolVarP(&cancelScancelFlag, "scancel", "", false, "Cancel Slurm jobs submitted for the sample")
+	cancelCmd.Flags().BoolVarP(&cancelToilCleanFlag, "toil-clean", "", false, "Remove jobStore by 'toil clean'")
+	cancelCmd.Flags().BoolVarP(&cancelForceFlag, "force", "", false, "Send signal even if heartbeat of the execution is old")
+	cancelCmd.MarkFlagRequired("sample")
+}
+
+func cancelMain(args []string) bool {
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	found := false
+	for _, s := range ss.SampleList {
+		if s.SampleId == cancelSampleId {
+			found = true
+		}
+	}
+	if !found {
+		fmt.Printf("SampleId [%s] is not in sample sheet\n", cancelSampleId)
+		return false
+	}
+	attemptDirectories := utils.ListSampleAttemptDirectories(rss.OutputDirectory.Path, cancelSampleId)
+	if len(attemptDirectories) == 0 {
+		fmt.Printf("SampleId [%s] is never executed\n", cancelSampleId)
+		return false
+	}
+	// the latest execution
+	jobManagerDirectory := attemptDirectories[0]
+	if utils.IsExistsFile(filepath.Join(jobManagerDirectory, "toil.exitcode.txt")) {
+		fmt.Printf("SampleId [%s] is not running. See [%s]\n", cancelSampleId, jobManagerDirectory)
+		return false
+	}
+	record, err := utils.ReadProcessRecord(jobManagerDirectory)
+	if err != nil {
+		fmt.Printf("Process of SampleId [%s] is not recorded in [%s]\n", cancelSampleId, jobManagerDirectory)
+		return false
+	}
+	hostname, _ := os.Hostname()
+	if record.Hostname != hostname {
+		fmt.Printf("SampleId [%s] is running on host [%s]. Execute cancel on that host\n", cancelSampleId, record.Hostname)
+		return false
+	}
+	// heartbeat is checked, because pgid of crashed JobManager may be reused by other process group
+	running, _ := utils.IsAttemptRunning(jobManagerDirectory)
+	if !running && record.Pgid > 0 && utils.IsProcessGroupAlive(record.Pgid) && !cancelForceFlag {
+		fmt.Printf("Heartbeat of SampleId [%s] is older than %s, so process group [%d] may not be toil-cwl-runner\n", cancelSampleId, utils.HeartbeatTimeout, record.Pgid)
+		fmt.Println("If it is toil-cwl-runner of the sample, use --force to send signal")
+		return false
+	}
+	// mark as cancelled before signal, so `run` does not retry this sample
+	if err := ioutil.WriteFile(filepath.Join(jobManagerDirectory, utils.CancelledFileName), []byte(utils.GetCurrentTime()+"\n"), 0644); err != nil {
+		fmt.Printf("Can not mark SampleId [%s] as cancelled: %v\n", cancelSampleId, err)
+		return false
+	}
+	result := true
+	// jobStore must not be removed while toil-cwl-runner is running
+	stopped := true
+	if record.Pgid <= 0 {
+		fmt.Printf("toil-cwl-runner of SampleId [%s] is not started yet. It will not be started\n", cancelSampleId)
+		// JobManager may be starting toil-cwl-runner just before it is marked
+		stopped = !running
+	} else if utils.IsProcessGroupAlive(record.Pgid) {
+		fmt.Printf("Send SIGTERM to toil-cwl-runner [%d] of SampleId [%s]\n", record.Pid, cancelSampleId)
+		if !utils.StopProcessGroup(record.Pgid, cancelTimeoutForCommand) {
+			fmt.Printf("Can not stop process group [%d]\n", record.Pgid)
+			result = false
+			stopped = false
+		}
+	} else {
+		fmt.Printf("toil-cwl-runner [%d] of SampleId [%s] is already finished\n", record.Pid, cancelSampleId)
+	}
+	if cancelScancelFlag {
+		result = cancelSlurmJobs(jobManagerDirectory) && result
+	}
+	if cancelToilCleanFlag {
+		if stopped {
+			result = cleanJobStore(utils.GetAttemptJobStore(jobManagerDirectory)) && result
+		} else {
+			fmt.Println("toil-cwl-runner may be still running, so toil clean is not executed")
+			result = false
+		}
+	}
+	fmt.Printf("SampleId [%s] is cancelled. See [%s]\n", cancelSampleId, jobManagerDirectory)
+	return result
+}
+
+func cancelSlurmJobs(jobManagerDirectory string) bool {
+	slurmJobIds := utils.ReadSlurmJobIds(jobManagerDirectory)
+	if len(slurmJobIds) == 0 {
+		fmt.Printf("Slurm job ids are not recorded in [%s]\n", filepath.Join(jobManagerDirectory, utils.SlurmJobIdsFileName))
+		return true
+	}
+	if !utils.IsExistsSbatch() {
+		fmt.Println("Slurm is not found, so scancel is not executed")
+		return false
+	}
+	fmt.Printf("scancel %s\n", strings.Join(slurmJobIds, " "))
+	output, err := exec.Command("scancel", slurmJobIds...).CombinedOutput()
+	fmt.Print(string(output))
+	if err != nil {
+		fmt.Printf("scancel failed: %v\n", err)
+		return false
+	}
+	return true
+}
+
+func cleanJobStore(jobStoreDir string) bool {
+	fmt.Printf("toil clean %s\n", jobStoreDir)
+	output, err := exec.Command("toil", "clean", jobStoreDir).CombinedOutput()
+	fmt.Print(string(output))
+	if err != nil {
+		fmt.Printf("toil clean failed: %v\n", err)
+		return false
+	}
+	return true
+}
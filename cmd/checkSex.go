@@ -0,0 +1,98 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var checkSexFormat string
+var checkSexOutput string
+
+// checkSexCmd represents the check-sex command
+var checkSexCmd = &cobra.Command{
+	Use:   "check-sex",
+	Short: "Check sex of samples by chrX and chrY coverage",
+	Long: fmt.Sprintf(`Infer sex of samples from mean coverage of chrX nonPAR and chrY nonPAR to autosome
+in wgs_metrics, and compare with 'sex' of samples in sample sheet.
+  chrX ratio < %g : X,  >= %g : XX
+  chrY ratio < %g : no Y, >= %g : Y
+Mismatch is likely to be a sample swap. Exit status is 1 if any sample is mismatched.`,
+		utils.SexCheckChrXLow, utils.SexCheckChrXHigh, utils.SexCheckChrYLow, utils.SexCheckChrYHigh),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkSexMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkSexCmd)
+
+	checkSexCmd.Flags().StringVarP(&checkSexFormat, "format", "", "tsv", "Output format, tsv or json")
+	checkSexCmd.Flags().StringVarP(&checkSexOutput, "output", "o", "", "Output file. Default is stdout")
+}
+
+func checkSexMain(args []string) bool {
+	if checkSexFormat != "tsv" && checkSexFormat != "json" {
+		fmt.Printf("Unknown format [%s]\n", checkSexFormat)
+		return false
+	}
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	report := utils.CheckSex(rss.OutputDirectory.Path, &ss)
+	var w io.Writer = os.Stdout
+	if checkSexOutput != "" {
+		f, err := os.Create(checkSexOutput)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		defer f.Close()
+		w = f
+	}
+	if checkSexFormat == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	} else {
+		writeSexCheckTsv(w, report)
+	}
+	for _, check := range report.Samples {
+		if check.Result == utils.SexCheckMismatch {
+			fmt.Fprintf(os.Stderr, "Sample ID: [%s] is %s in sample sheet, but inferred as %s (%s). Sample may be swapped\n", check.SampleId, check.SampleSheet, check.InferredSex, check.Karyotype)
+		}
+	}
+	return report.Mismatches == 0
+}
+
+func writeSexCheckTsv(w io.Writer, report *utils.SexCheckReport) {
+	fmt.Fprintln(w, strings.Join([]string{"sample_id", "autosome_coverage", "chrX_coverage", "chrY_coverage", "chrX_ratio", "chrY_ratio", "karyotype", "inferred_sex", "sample_sheet_sex", "result", "error"}, "\t"))
+	for _, check := range report.Samples {
+		fmt.Fprintf(w, "%s\t%g\t%g\t%g\t%.3f\t%.3f\t%s\t%s\t%s\t%s\t%s\n", check.SampleId, check.AutosomeCoverage, check.ChrXCoverage, check.ChrYCoverage, check.ChrXRatio, check.ChrYRatio, check.Karyotype, check.InferredSex, check.SampleSheet, check.Result, check.ErrorMessage)
+	}
+}
@@ -1,10 +1,10 @@
 package cmd
 
 import (
-	"bufio"
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -19,21 +19,22 @@ var samplesheetfileBytes []byte
 //go:embed configfile_schema.json
 var configfileBytes []byte
 
-//go:embed create_docker_image.sh
-var createDockerImageScript []byte
-
-//go:embed create_singularity_image.sh
-var createSingularityImageScript []byte
-
 /*
  * Behavior:
  *   All fine: true
  *   Something wrong: false
  */
 func loadSampleSheetAndConfigFile(args []string) bool {
+	return loadSampleSheetAndConfigFileTo(os.Stdout, args)
+}
+
+/*
+ * Same as loadSampleSheetAndConfigFile, but messages are written to w.
+ */
+func loadSampleSheetAndConfigFileTo(w io.Writer, args []string) bool {
 	if len(args) != 2 {
-		fmt.Printf("Some required files are not specified. You pass [%d] file(s)\n", len(args))
-		fmt.Println("samplesheet_data configfile_data")
+		fmt.Fprintf(w, "Some required files are not specified. You pass [%d] file(s)\n", len(args))
+		fmt.Fprintln(w, "samplesheet_data configfile_data")
 		return false
 	}
 	samplesheet_data_file := args[0]
@@ -41,67 +42,49 @@ func loadSampleSheetAndConfigFile(args []string) bool {
 	// Check sample sheet filename and config filename has invalid character.
 	allfilepathisvalidchar := true
 	if !utils.IsOnlyValidCharcterInFilepath(samplesheet_data_file) {
-		fmt.Printf("[%s] has invalid character.\n", samplesheet_data_file)
+		fmt.Fprintf(w, "[%s] has invalid character.\n", samplesheet_data_file)
 		allfilepathisvalidchar = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(config_data_file) {
-		fmt.Printf("[%s] has invalid character.\n", config_data_file)
+		fmt.Fprintf(w, "[%s] has invalid character.\n", config_data_file)
 		allfilepathisvalidchar = false
 	}
 	if !allfilepathisvalidchar {
-		fmt.Println("Some required files has invalid character. So stop execute")
+		fmt.Fprintln(w, "Some required files has invalid character. So stop execute")
 		return false
 	}
 	// Check sample sheet filename and config filename is exist.
 	allfileexist := true
 	if !utils.IsExistsFile(samplesheet_data_file) {
-		fmt.Printf("[%s] is missing sample data file\n", samplesheet_data_file)
+		fmt.Fprintf(w, "[%s] is missing sample data file\n", samplesheet_data_file)
 		allfileexist = false
 	}
 	if !utils.IsExistsFile(config_data_file) {
-		fmt.Printf("[%s] is missing config data file\n", config_data_file)
+		fmt.Fprintf(w, "[%s] is missing config data file\n", config_data_file)
 		allfileexist = false
 	}
 	if !allfileexist {
-		fmt.Println("Some required files are missing. So stop execute")
+		fmt.Fprintln(w, "Some required files are missing. So stop execute")
 		return false
 	}
 	// files are provided. check both files contents.
 	validateisfine := true
-	// sample sheet schema provided by embed.
-	schemaLoader := gojsonschema.NewStringLoader(string(samplesheetfileBytes))
-	// MUST must be canonical
-	sampplesheet_data_file_abs, _ := filepath.Abs(samplesheet_data_file)
-	documentLoader := gojsonschema.NewReferenceLoader("file://" + sampplesheet_data_file_abs)
-
-	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
-	if err != nil {
-		panic(err.Error())
-	}
-	if result.Valid() {
-		if displayMeesage {
-			fmt.Printf("The sample sheet document is valid\n")
-		}
-	} else {
-		fmt.Printf("The sample sheet document is not valid. see errors :\n")
-		for _, desc := range result.Errors() {
-			fmt.Printf("- %s\n", desc)
-		}
+	if !validateSampleSheetDocument(w, samplesheet_data_file) {
 		validateisfine = false
 	}
 	if displayMeesage {
-		fmt.Println("Load sample sheet")
+		fmt.Fprintln(w, "Load sample sheet")
 	}
 	raw, err := ioutil.ReadFile(samplesheet_data_file)
 	if err != nil {
-		fmt.Println("Samplesheet has some problems")
-		fmt.Println(err.Error())
+		fmt.Fprintln(w, "Samplesheet has some problems")
+		fmt.Fprintln(w, err.Error())
 		validateisfine = false
 	}
 
 	json.Unmarshal(raw, &ss)
 	if displayMeesage {
-		fmt.Println("Load sample sheet end")
+		fmt.Fprintln(w, "Load sample sheet end")
 	}
 	// configfile loader strings are embed variable
 	rschemaLoader := gojsonschema.NewStringLoader(string(configfileBytes))
@@ -116,52 +99,127 @@ func loadSampleSheetAndConfigFile(args []string) bool {
 
 	if rresult.Valid() {
 		if displayMeesage {
-			fmt.Printf("The reference config document is valid\n")
+			fmt.Fprintf(w, "The reference config document is valid\n")
 		}
 	} else {
-		fmt.Printf("The reference config document is not valid. see errors :\n")
+		fmt.Fprintf(w, "The reference config document is not valid. see errors :\n")
 		for _, desc := range rresult.Errors() {
-			fmt.Printf("- %s\n", desc)
+			fmt.Fprintf(w, "- %s\n", desc)
 		}
 		validateisfine = false
 	}
 	if displayMeesage {
-		fmt.Println("Load config file")
+		fmt.Fprintln(w, "Load config file")
 	}
 	rraw, err := ioutil.ReadFile(config_data_file)
 	if err != nil {
-		fmt.Println("Config file has problem")
-		fmt.Println(err.Error())
+		fmt.Fprintln(w, "Config file has problem")
+		fmt.Fprintln(w, err.Error())
 		validateisfine = false
 	}
 
 	json.Unmarshal(rraw, &rss)
 	if displayMeesage {
-		fmt.Println("Load config file end")
+		fmt.Fprintln(w, "Load config file end")
 	}
-	validateisfine = validateisfine && IsAllSamplesheetFilepathHasValidchar(&ss)
-	validateisfine = validateisfine && IsAllFilepathInConfigFileHasValidchar(&rss)
+	validateisfine = validateisfine && isAllSamplesheetFilepathHasValidchar(w, &ss)
+	validateisfine = validateisfine && isAllFilepathInConfigFileHasValidchar(w, &rss)
 	return validateisfine
 }
 
+func validateSampleSheetDocument(w io.Writer, samplesheet_data_file string) bool {
+	valid, err := validateSampleSheetDocumentWithError(w, samplesheet_data_file)
+	if err != nil {
+		panic(err.Error())
+	}
+	return valid
+}
+
+/*
+ * Validate sample sheet by schema.
+ * error is returned if the document can not be read, such as malformed JSON.
+ */
+func validateSampleSheetDocumentWithError(w io.Writer, samplesheet_data_file string) (bool, error) {
+	// sample sheet schema provided by embed.
+	schemaLoader := gojsonschema.NewStringLoader(string(samplesheetfileBytes))
+	// MUST must be canonical
+	sampplesheet_data_file_abs, _ := filepath.Abs(samplesheet_data_file)
+	documentLoader := gojsonschema.NewReferenceLoader("file://" + sampplesheet_data_file_abs)
+
+	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
+	if err != nil {
+		return false, err
+	}
+	if result.Valid() {
+		if displayMeesage {
+			fmt.Fprintf(w, "The sample sheet document is valid\n")
+		}
+		return true, nil
+	}
+	fmt.Fprintf(w, "The sample sheet document is not valid. see errors :\n")
+	for _, desc := range result.Errors() {
+		fmt.Fprintf(w, "- %s\n", desc)
+	}
+	return false, nil
+}
+
+/*
+ * Load sample sheet again without changing loaded sample sheet.
+ * Used by `run --watch`, sample sheet is appended while running.
+ * If the sample sheet is broken, such as half-written, false is returned and caller keeps loaded sample sheet.
+ */
+func reloadSampleSheet(samplesheet_data_file string) (*utils.SimpleSchema, bool) {
+	if !utils.IsExistsFile(samplesheet_data_file) {
+		fmt.Printf("[%s] is missing sample data file\n", samplesheet_data_file)
+		return nil, false
+	}
+	valid, err := validateSampleSheetDocumentWithError(os.Stdout, samplesheet_data_file)
+	if err != nil {
+		// sample sheet may be being written. loaded sample sheet is kept
+		fmt.Printf("[%s] can not be loaded: %s\n", samplesheet_data_file, err.Error())
+		return nil, false
+	}
+	if !valid {
+		return nil, false
+	}
+	raw, err := ioutil.ReadFile(samplesheet_data_file)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, false
+	}
+	var reloaded utils.SimpleSchema
+	if err := json.Unmarshal(raw, &reloaded); err != nil {
+		fmt.Println(err.Error())
+		return nil, false
+	}
+	if !IsAllSamplesheetFilepathHasValidchar(&reloaded) {
+		return nil, false
+	}
+	return &reloaded, true
+}
+
 func IsAllSamplesheetFilepathHasValidchar(samplesheet *utils.SimpleSchema) bool {
+	return isAllSamplesheetFilepathHasValidchar(os.Stdout, samplesheet)
+}
+
+func isAllSamplesheetFilepathHasValidchar(w io.Writer, samplesheet *utils.SimpleSchema) bool {
 	result := true
-	for _, s := range ss.SampleList {
+	for _, s := range samplesheet.SampleList {
 		for _, r := range s.RunList {
 			if r.PEOrSE == "PE" {
 				// PE
 				if !utils.IsOnlyValidCharcterInFilepath(r.FQ1) {
-					fmt.Printf("In SampleID[%s] RunID[%s] [%s] has invalid character in filepath\n", s.SampleId, r.RunId, r.FQ1)
+					fmt.Fprintf(w, "In SampleID[%s] RunID[%s] [%s] has invalid character in filepath\n", s.SampleId, r.RunId, r.FQ1)
 					result = false
 				}
 				if !utils.IsOnlyValidCharcterInFilepath(r.FQ2) {
-					fmt.Printf("In SampleID[%s] RunID[%s] [%s] has invalid character in filepath\n", s.SampleId, r.RunId, r.FQ2)
+					fmt.Fprintf(w, "In SampleID[%s] RunID[%s] [%s] has invalid character in filepath\n", s.SampleId, r.RunId, r.FQ2)
 					result = false
 				}
 			} else {
 				// SE
 				if !utils.IsOnlyValidCharcterInFilepath(r.FQ1) {
-					fmt.Printf("In SampleID[%s] RunID[%s] [%s] has invalid character in filepath\n", s.SampleId, r.RunId, r.FQ1)
+					fmt.Fprintf(w, "In SampleID[%s] RunID[%s] [%s] has invalid character in filepath\n", s.SampleId, r.RunId, r.FQ1)
 					result = false
 				}
 			}
@@ -171,60 +229,64 @@ func IsAllSamplesheetFilepathHasValidchar(samplesheet *utils.SimpleSchema) bool
 }
 
 func IsAllFilepathInConfigFileHasValidchar(rss *utils.ReferenceSchema) bool {
+	return isAllFilepathInConfigFileHasValidchar(os.Stdout, rss)
+}
+
+func isAllFilepathInConfigFileHasValidchar(w io.Writer, rss *utils.ReferenceSchema) bool {
 	result := true
 	if !utils.IsOnlyValidCharcterInFilepath(rss.WorkflowFile.Path) {
-		fmt.Printf("In config file, `workflow_file` path [%s] has invalid character.\n", rss.WorkflowFile.Path)
+		fmt.Fprintf(w, "In config file, `workflow_file` path [%s] has invalid character.\n", rss.WorkflowFile.Path)
 		result = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(rss.OutputDirectory.Path) {
-		fmt.Printf("In config file, `output_directory` path [%s] has invalid character.\n", rss.OutputDirectory.Path)
+		fmt.Fprintf(w, "In config file, `output_directory` path [%s] has invalid character.\n", rss.OutputDirectory.Path)
 		result = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(rss.ContainerCacheDirectory.Path) {
-		fmt.Printf("In config file, `container_cache_directory` path [%s] has invalid character.\n", rss.ContainerCacheDirectory.Path)
+		fmt.Fprintf(w, "In config file, `container_cache_directory` path [%s] has invalid character.\n", rss.ContainerCacheDirectory.Path)
 		result = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(rss.Reference.Path) {
-		fmt.Printf("In config file, `reference` path [%s] has invalid character.\n", rss.Reference.Path)
+		fmt.Fprintf(w, "In config file, `reference` path [%s] has invalid character.\n", rss.Reference.Path)
 		result = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(rss.Dbsnp.Path) {
-		fmt.Printf("In config file, `dnsnp` path [%s] has invalid character.\n", rss.Dbsnp.Path)
+		fmt.Fprintf(w, "In config file, `dnsnp` path [%s] has invalid character.\n", rss.Dbsnp.Path)
 		result = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(rss.Mills.Path) {
-		fmt.Printf("In config file, `mills` path [%s] has invalid character.\n", rss.Mills.Path)
+		fmt.Fprintf(w, "In config file, `mills` path [%s] has invalid character.\n", rss.Mills.Path)
 		result = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(rss.KnownIndels.Path) {
-		fmt.Printf("In config file, `known_indels` path [%s] has invalid character.\n", rss.KnownIndels.Path)
+		fmt.Fprintf(w, "In config file, `known_indels` path [%s] has invalid character.\n", rss.KnownIndels.Path)
 		result = false
 	}
 	// Autosome PAR
 	if !utils.IsOnlyValidCharcterInFilepath(rss.HaplotypecallerAutosomePARIntervalBed.Path) {
-		fmt.Printf("In config file, `haplotypecaller_autosome_PAR_interval_bed` path [%s] has invalid character.\n", rss.HaplotypecallerAutosomePARIntervalBed.Path)
+		fmt.Fprintf(w, "In config file, `haplotypecaller_autosome_PAR_interval_bed` path [%s] has invalid character.\n", rss.HaplotypecallerAutosomePARIntervalBed.Path)
 		result = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(rss.HaplotypecallerAutosomePARIntervalList.Path) {
-		fmt.Printf("In config file, `haplotypecaller_autosome_PAR_interval_list` path [%s] has invalid character.\n", rss.HaplotypecallerAutosomePARIntervalList.Path)
+		fmt.Fprintf(w, "In config file, `haplotypecaller_autosome_PAR_interval_list` path [%s] has invalid character.\n", rss.HaplotypecallerAutosomePARIntervalList.Path)
 		result = false
 	}
 	// ChrX NonPAR
 	if !utils.IsOnlyValidCharcterInFilepath(rss.HaplotypecallerChrXNonPARIntervalBed.Path) {
-		fmt.Printf("In config file, `haplotypecaller_chrX_nonPAR_interval_bed` path [%s] has invalid character.\n", rss.HaplotypecallerChrXNonPARIntervalBed.Path)
+		fmt.Fprintf(w, "In config file, `haplotypecaller_chrX_nonPAR_interval_bed` path [%s] has invalid character.\n", rss.HaplotypecallerChrXNonPARIntervalBed.Path)
 		result = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(rss.HaplotypecallerChrXNonPARIntervalList.Path) {
-		fmt.Printf("In config file, `haplotypecaller_chrX_nonPAR_interval_list` path [%s] has invalid character.\n", rss.HaplotypecallerChrXNonPARIntervalList.Path)
+		fmt.Fprintf(w, "In config file, `haplotypecaller_chrX_nonPAR_interval_list` path [%s] has invalid character.\n", rss.HaplotypecallerChrXNonPARIntervalList.Path)
 		result = false
 	}
 	// ChrY NonPar
 	if !utils.IsOnlyValidCharcterInFilepath(rss.HaplotypecallerChrYNonPARIntervalBed.Path) {
-		fmt.Printf("In config file, `haplotypecaller_chrY_nonPAR_interval_bed` path [%s] has invalid character.\n", rss.HaplotypecallerChrYNonPARIntervalBed.Path)
+		fmt.Fprintf(w, "In config file, `haplotypecaller_chrY_nonPAR_interval_bed` path [%s] has invalid character.\n", rss.HaplotypecallerChrYNonPARIntervalBed.Path)
 		result = false
 	}
 	if !utils.IsOnlyValidCharcterInFilepath(rss.HaplotypecallerChrYNonPARIntervalList.Path) {
-		fmt.Printf("In config file, `haplotypecaller_chrY_nonPAR_interval_list` path [%s] has invalid character.\n", rss.HaplotypecallerChrYNonPARIntervalList.Path)
+		fmt.Fprintf(w, "In config file, `haplotypecaller_chrY_nonPAR_interval_list` path [%s] has invalid character.\n", rss.HaplotypecallerChrYNonPARIntervalList.Path)
 		result = false
 	}
 	return result
@@ -263,79 +325,111 @@ func IsSameFilePath(src, dst string) bool {
 }
 
 func DisplayJobInfo(outputDirectoryPath string, execSampleIdList []string) {
-	jobManagerExecutedFiles, err := ioutil.ReadDir(outputDirectoryPath + "/jobManager")
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-	} else {
-		// sort jobManager directories by name
-		utils.SortByFileNameOrderDesc(jobManagerExecutedFiles)
-		// copy execSampleIdList to notfinishSampleIdList
-		notfinishSampleIdList := make([]string, len(execSampleIdList))
-		copy(notfinishSampleIdList, execSampleIdList)
-		for _, notFinishedSampleId := range notfinishSampleIdList {
-			for _, jobManagerTimestampDirectory := range jobManagerExecutedFiles {
-				// jobManagerTimestampDirectory is directory
-				// check exitcode  file
-				sampleIdPath := outputDirectoryPath + "/jobManager/" + jobManagerTimestampDirectory.Name() + "/" + notFinishedSampleId
-				exitcodeFilePath := sampleIdPath + "/toil.exitcode.txt"
-				isExitCodeFileExist := utils.IsExistsFile(exitcodeFilePath)
-				isError := false
-				exitCode := ""
-				if isExitCodeFileExist {
-					// if file content is "0", then remove from notfinishSampleIdList
-					exitCode = getExitCodeContent(exitcodeFilePath)
-					if exitCode != "0" {
-						// investigate next SampleId
-						isError = true
-					} else {
-						// content is "0", this is happens something wrong
-						// because notfinishSampleIdList is only contains sampleId that is not finished.
-						isError = true
-						fmt.Printf("Error: Something wrong SampleId[%s] is exitcode 0. but not created result directory under output_path\n", notFinishedSampleId)
-					}
+	if !utils.IsExistsFile(outputDirectoryPath + "/jobManager") {
+		fmt.Printf("Error: jobManager directory is missing under [%s]\n", outputDirectoryPath)
+		return
+	}
+	// rules to classify failures
+	rules, rulesErr := utils.LoadFailureRules(&rss)
+	// copy execSampleIdList to notfinishSampleIdList
+	notfinishSampleIdList := make([]string, len(execSampleIdList))
+	copy(notfinishSampleIdList, execSampleIdList)
+	for _, notFinishedSampleId := range notfinishSampleIdList {
+		// jobManager directories of the sample, sorted by name
+		for _, sampleIdPath := range utils.ListSampleAttemptDirectories(outputDirectoryPath, notFinishedSampleId) {
+			// check running
+			if isRunning, record := utils.IsAttemptRunning(sampleIdPath); isRunning {
+				fmt.Printf("Sample ID: [%s] is running\n", notFinishedSampleId)
+				fmt.Printf(" Elapsed: [%s]\n", record.Elapsed())
+				fmt.Printf(" Host: [%s] JobManager PID: [%d] toil-cwl-runner PID: [%d]\n", record.Hostname, record.JobManagerPid, record.Pid)
+				fmt.Printf(" JobManager directory: [%s]\n", sampleIdPath)
+				break
+			}
+			// check exitcode  file
+			exitcodeFilePath := sampleIdPath + "/toil.exitcode.txt"
+			isExitCodeFileExist := utils.IsExistsFile(exitcodeFilePath)
+			isError := false
+			exitCode := ""
+			if isExitCodeFileExist {
+				// if file content is "0", then remove from notfinishSampleIdList
+				exitCode = getExitCodeContent(exitcodeFilePath)
+				if exitCode != "0" {
+					// investigate next SampleId
+					isError = true
 				} else {
+					// content is "0", this is happens something wrong
+					// because notfinishSampleIdList is only contains sampleId that is not finished.
 					isError = true
+					fmt.Printf("Error: Something wrong SampleId[%s] is exitcode 0. but not created result directory under output_path\n", notFinishedSampleId)
 				}
-				if isError {
-					// display
-					fmt.Printf("Sample ID: [%s] has error\n", notFinishedSampleId)
-					// display exitcode
-					if isExitCodeFileExist {
-						fmt.Printf(" ExitCode: [%s]\n", exitCode)
-					} else {
-						fmt.Print(" ExitCode file is missing. CWL execution is seemed to be complete\n")
-					}
-					// display stdout
-					stdoutFilePath := sampleIdPath + "/toil.stdout.txt"
-					if utils.IsExistsFile(stdoutFilePath) {
-						fmt.Printf(" Stdout: [%s]\n", stdoutFilePath)
-					} else {
-						fmt.Printf(" Stdout file is missing. expect path is [%s]\n", stdoutFilePath)
-					}
-					// display stderr
-					stderrFilePath := sampleIdPath + "/toil.stderr.txt"
-					if utils.IsExistsFile(stderrFilePath) {
-						fmt.Printf(" Stderr: [%s]\n", stderrFilePath)
-					} else {
-						fmt.Printf(" Stderr file is missing. expect path is [%s]\n", stderrFilePath)
+			} else {
+				isError = true
+			}
+			if isError {
+				// display
+				fmt.Printf("Sample ID: [%s] has error\n", notFinishedSampleId)
+				// display exitcode
+				if isExitCodeFileExist {
+					fmt.Printf(" ExitCode: [%s]\n", exitCode)
+				} else {
+					fmt.Print(" ExitCode file is missing and not running. JobManager is seemed to be killed\n")
+				}
+				// display cancelled time
+				cancelledFilePath := sampleIdPath + "/" + utils.CancelledFileName
+				if utils.IsExistsFile(cancelledFilePath) {
+					fmt.Printf(" Cancelled at: [%s]\n", utils.GetExitCodeContent(cancelledFilePath))
+				}
+				// display stdout
+				stdoutFilePath := sampleIdPath + "/toil.stdout.txt"
+				if utils.IsExistsFile(stdoutFilePath) {
+					fmt.Printf(" Stdout: [%s]\n", stdoutFilePath)
+				} else {
+					fmt.Printf(" Stdout file is missing. expect path is [%s]\n", stdoutFilePath)
+				}
+				// display stderr
+				stderrFilePath := sampleIdPath + "/toil.stderr.txt"
+				if utils.IsExistsFile(stderrFilePath) {
+					fmt.Printf(" Stderr: [%s]\n", stderrFilePath)
+				} else {
+					fmt.Printf(" Stderr file is missing. expect path is [%s]\n", stderrFilePath)
+				}
+				// display failure category
+				if rulesErr == nil {
+					diagnosis := utils.DiagnoseAttempt(sampleIdPath, notFinishedSampleId, rules)
+					fmt.Printf(" Category: [%s] %s\n", diagnosis.Category, diagnosis.Description)
+					if diagnosis.FailingStep != "" {
+						fmt.Printf(" Failing step: [%s]\n", diagnosis.FailingStep)
 					}
-					//
-					break
+					fmt.Printf(" For details, use `diagnose --sample %s`\n", notFinishedSampleId)
 				}
+				//
+				break
 			}
 		}
 	}
 }
 
+/*
+ * Create sample id list which the latest execution is running.
+ */
+func createRunningSampleIdList(outputDirectoryPath string, execSampleIdList []string) []string {
+	result := []string{}
+	for _, sampleId := range execSampleIdList {
+		attemptDirectories := utils.ListSampleAttemptDirectories(outputDirectoryPath, sampleId)
+		if len(attemptDirectories) == 0 {
+			continue
+		}
+		if isRunning, _ := utils.IsAttemptRunning(attemptDirectories[0]); isRunning {
+			result = append(result, sampleId)
+		}
+	}
+	return result
+}
+
 func getExitCodeContent(exitcodeFilePath string) string {
 	// read exitCodeFilePath
-	exitCodeFile, err := os.Open(exitcodeFilePath)
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+	if !utils.IsExistsFile(exitcodeFilePath) {
+		fmt.Printf("Error: exitcode file [%s] is missing\n", exitcodeFilePath)
 	}
-	defer exitCodeFile.Close()
-	scanner := bufio.NewScanner(exitCodeFile)
-	scanner.Scan()
-	exitCode := scanner.Text()
-	return exitCode
+	return utils.GetExitCodeContent(exitcodeFilePath)
 }
@@ -1,11 +1,20 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"io/ioutil"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,6 +42,14 @@ func Test_loadSampleSheetAndConfigFile_pass_1file_fail(t *testing.T) {
 	assert.False(t, result, "input file MUST be exactly 2")
 }
 
+func Test_loadSampleSheetAndConfigFileTo_messages(t *testing.T) {
+	var messages bytes.Buffer
+	result := loadSampleSheetAndConfigFileTo(&messages, []string{"../test/datafiles/no-such-samplesheet.json", "../test/datafiles/configfile_1run-test.json"})
+
+	assert.False(t, result)
+	assert.Contains(t, messages.String(), "[../test/datafiles/no-such-samplesheet.json] is missing sample data file\n")
+}
+
 func Test_loadSampleSheetAndConfigFile_pass_3file_fail(t *testing.T) {
 	result := loadSampleSheetAndConfigFile([]string{"../test/datafiles/samplesheet_1run-test.json", "../test/datafiles/configfile_1run-test.json", "3rd.file"})
 
@@ -311,3 +328,259 @@ func Test_getExitCodeContent_exitcode_0(t *testing.T) {
 	result := getExitCodeContent("../test/jobManager/20211101143242/XX00003/toil.exitcode.txt")
 	assert.Equal(t, "0", result, "Exit code 0")
 }
+
+func Test_loadSampleSheetAndConfigFile_configfile_with_retry_policy(t *testing.T) {
+	result := loadSampleSheetAndConfigFile([]string{"../test/datafiles/samplesheet_1run-test.json", "../test/datafiles/configfile_retry-test.json"})
+	assert.True(t, result, "retry_policy is valid")
+	assert.Equal(t, 3, rss.RetryPolicy.MaxAttempts)
+	assert.Equal(t, []int{1}, rss.RetryPolicy.RetryableExitCodes)
+	// other tests load config file without retry_policy into same variable
+	rss.RetryPolicy = nil
+}
+
+func Test_createRunningSampleIdList(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	hostname, _ := os.Hostname()
+	// XX00001 is running in this process, XX00002 is finished
+	running := filepath.Join(outputDirectoryPath, "jobManager", "20211101145001", "XX00001")
+	os.MkdirAll(running, 0755)
+	utils.WriteProcessRecord(running, &utils.ProcessRecord{Hostname: hostname, JobManagerPid: os.Getpid(), StartedAt: "20211101145001", HeartbeatAt: utils.GetCurrentTime()})
+	finished := filepath.Join(outputDirectoryPath, "jobManager", "20211101145001", "XX00002")
+	os.MkdirAll(finished, 0755)
+	utils.WriteProcessRecord(finished, &utils.ProcessRecord{Hostname: hostname, JobManagerPid: os.Getpid(), StartedAt: "20211101145001"})
+	ioutil.WriteFile(filepath.Join(finished, "toil.exitcode.txt"), []byte("1\n"), 0644)
+	result := createRunningSampleIdList(outputDirectoryPath, []string{"XX00001", "XX00002", "XX00003"})
+	assert.Equal(t, []string{"XX00001"}, result)
+}
+
+func Test_reloadSampleSheet(t *testing.T) {
+	reloaded, ok := reloadSampleSheet("../test/datafiles/samplesheet_2run-test.json")
+	assert.True(t, ok)
+	assert.NotEqual(t, 0, len(reloaded.SampleList))
+	_, ok = reloadSampleSheet("../test/datafiles/invalid_samplesheet_data.json")
+	assert.False(t, ok, "schema error")
+	_, ok = reloadSampleSheet("../test/datafiles/no_such_samplesheet.json")
+	assert.False(t, ok, "missing file")
+}
+
+func Test_reloadSampleSheet_truncated(t *testing.T) {
+	raw, err := ioutil.ReadFile("../test/datafiles/samplesheet_2run-test.json")
+	assert.NoError(t, err)
+	// sample sheet which is being written
+	fn := filepath.Join(t.TempDir(), "samplesheet.json")
+	assert.NoError(t, ioutil.WriteFile(fn, raw[:len(raw)/2], 0644))
+	reloaded, ok := reloadSampleSheet(fn)
+	assert.False(t, ok, "malformed JSON")
+	assert.Nil(t, reloaded)
+}
+
+func Test_reloadSampleSheet_invalid_character(t *testing.T) {
+	assert.True(t, loadSampleSheetAndConfigFile([]string{"../test/datafiles/samplesheet_1run-test.json", "../test/datafiles/configfile_1run-test.json"}))
+	raw, err := ioutil.ReadFile("../test/datafiles/samplesheet_2run-test.json")
+	assert.NoError(t, err)
+	var appended utils.SimpleSchema
+	assert.NoError(t, json.Unmarshal(raw, &appended))
+	appended.SampleList[len(appended.SampleList)-1].RunList[0].FQ1 = "aaa;aaa"
+	data, err := json.Marshal(&appended)
+	assert.NoError(t, err)
+	fn := filepath.Join(t.TempDir(), "samplesheet.json")
+	assert.NoError(t, ioutil.WriteFile(fn, data, 0644))
+	// loaded sample sheet has no invalid character, reloaded one has
+	assert.True(t, IsAllSamplesheetFilepathHasValidchar(&ss))
+	_, ok := reloadSampleSheet(fn)
+	assert.False(t, ok, "FQ1 of reloaded sample sheet has invalid character")
+}
+
+func Test_updateWatchStatus(t *testing.T) {
+	assert.True(t, loadSampleSheetAndConfigFile([]string{"../test/datafiles/samplesheet_2run-test.json", "../test/datafiles/configfile_1run-test.json"}))
+	outputDirectoryPath := t.TempDir()
+	for _, s := range ss.SampleList {
+		for _, resultFile := range utils.ListResultFiles(s) {
+			fn := filepath.Join(outputDirectoryPath, resultFile)
+			assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+			assert.NoError(t, ioutil.WriteFile(fn, []byte("result\n"), 0644))
+		}
+	}
+	l := newSampleLauncher(context.Background(), outputDirectoryPath, &utils.ExecOptions{}, false)
+	// result files exist, but the sample is failed by deep check
+	l.setFinished(ss.SampleList[0].SampleId, false)
+	status := &utils.WatchStatus{}
+	l.updateWatchStatus(status, ss.SampleList, map[string]bool{})
+	assert.Equal(t, len(ss.SampleList), status.Total)
+	assert.Equal(t, 1, status.Failed)
+	assert.Equal(t, len(ss.SampleList)-1, status.Finished)
+	assert.Equal(t, 0, status.Waiting)
+}
+
+func Test_newStatusHandler(t *testing.T) {
+	assert.True(t, loadSampleSheetAndConfigFile([]string{"../test/datafiles/samplesheet_1run-test.json", "../test/datafiles/configfile_1run-test.json"}))
+	handler, err := newStatusHandler(func() *utils.StatusReport {
+		return collectStatusReport("../test/datafiles/samplesheet_1run-test.json")
+	}, false)
+	assert.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/status", nil))
+	assert.Equal(t, 200, recorder.Code)
+	var report utils.StatusReport
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, len(ss.SampleList), report.Total)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ss.SampleList[0].SampleId)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "jobmanager_samples_total 1")
+	assert.NotContains(t, recorder.Body.String(), "jobmanager_checksum_bytes_total", "md5 is not verified by serve-status")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/no-such-page", nil))
+	assert.Equal(t, 404, recorder.Code)
+}
+
+func Test_newStatusHandler_truncated_samplesheet(t *testing.T) {
+	assert.True(t, loadSampleSheetAndConfigFile([]string{"../test/datafiles/samplesheet_1run-test.json", "../test/datafiles/configfile_1run-test.json"}))
+	raw, err := ioutil.ReadFile("../test/datafiles/samplesheet_2run-test.json")
+	assert.NoError(t, err)
+	// sample sheet which is being written
+	fn := filepath.Join(t.TempDir(), "samplesheet.json")
+	assert.NoError(t, ioutil.WriteFile(fn, raw[:len(raw)/2], 0644))
+	handler, err := newStatusHandler(func() *utils.StatusReport {
+		return collectStatusReport(fn)
+	}, false)
+	assert.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/status", nil))
+	assert.Equal(t, 200, recorder.Code)
+	var report utils.StatusReport
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, len(ss.SampleList), report.Total, "loaded sample sheet is used")
+}
+
+func Test_loadSampleSheetAndConfigFile_configfile_with_notifications(t *testing.T) {
+	result := loadSampleSheetAndConfigFile([]string{"../test/datafiles/samplesheet_1run-test.json", "../test/datafiles/configfile_notification-test.json"})
+	assert.True(t, result, "notifications are valid")
+	assert.Equal(t, 2, len(rss.Notifications))
+	assert.Equal(t, []string{"sample_failure", "batch_complete"}, rss.Notifications[0].Events)
+	assert.NoError(t, utils.ValidateNotificationHooks(rss.Notifications))
+	// other tests load config file without notifications into same variable
+	rss.Notifications = nil
+}
+
+func Test_writeQcSummary(t *testing.T) {
+	value := 0.995
+	summary := &utils.QcSummary{
+		Thresholds: &utils.QcThresholds{MinMappingRate: 0.998},
+		Samples: []utils.SampleQc{{
+			SampleId:    "NA12878",
+			MappingRate: &value,
+			Regions:     []utils.RegionQc{{Region: utils.QcAutosomeRegion}},
+			Flags:       []string{"mapping_rate<0.998"},
+			Errors:      []string{},
+		}},
+		Outliers: 1,
+	}
+	var tsv strings.Builder
+	writeQcSummaryTsv(&tsv, summary)
+	lines := strings.Split(strings.TrimSuffix(tsv.String(), "\n"), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, len(strings.Split(lines[0], "\t")), len(strings.Split(lines[1], "\t")), "missing region is empty")
+	assert.True(t, strings.HasPrefix(lines[1], "NA12878\t\t0.995\t\t"))
+	assert.True(t, strings.HasSuffix(lines[1], "\tmapping_rate<0.998\t"))
+
+	var html strings.Builder
+	assert.NoError(t, writeQcSummaryHtml(&html, summary))
+	assert.Contains(t, html.String(), `<tr class="outlier">`)
+	assert.Contains(t, html.String(), "mapping_rate&lt;0.998")
+}
+
+func Test_validateSampleSheetDocument_sex(t *testing.T) {
+	raw, err := ioutil.ReadFile("../test/datafiles/samplesheet_1run-test.json")
+	assert.NoError(t, err)
+	var sheet map[string]interface{}
+	assert.NoError(t, json.Unmarshal(raw, &sheet))
+	sample := sheet["samplelist"].([]interface{})[0].(map[string]interface{})
+	for sex, valid := range map[string]bool{"female": true, "male": true, "unknown": true, "F": false} {
+		sample["sex"] = sex
+		fn := filepath.Join(t.TempDir(), "samplesheet.json")
+		raw, _ = json.Marshal(sheet)
+		assert.NoError(t, ioutil.WriteFile(fn, raw, 0644))
+		assert.Equal(t, valid, validateSampleSheetDocument(os.Stdout, fn), sex)
+	}
+}
+
+func Test_writePullResults(t *testing.T) {
+	var table strings.Builder
+	writePullResults(&table, []utils.PullResult{
+		{Image: "quay.io/biocontainers/bwa:0.7.17", File: "/cache/quay.io_biocontainers_bwa:0.7.17.sif", Status: utils.PullStatusCached},
+		{Image: "example/broken:1.0", File: "/cache/example_broken:1.0.sif", Status: utils.PullStatusFailed, ErrorMessage: "manifest unknown"},
+	})
+	lines := strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "IMAGE "))
+	// columns are aligned
+	assert.Equal(t, strings.Index(lines[0], "STATUS"), strings.Index(lines[1], "cached"))
+	assert.Equal(t, strings.Index(lines[0], "STATUS"), strings.Index(lines[2], "failed"))
+	assert.True(t, strings.HasSuffix(lines[2], "manifest unknown"))
+}
+
+func Test_replayMain_check_failed(t *testing.T) {
+	samplesheet := "../test/datafiles/samplesheet_1run-test-fail.json"
+	configfile := "../test/datafiles/configfile_1run-test.json"
+	jobManagerDirectory := t.TempDir()
+	invocation := utils.NewInvocation(toolVersionString(), samplesheet, configfile, map[string]string{}, nil)
+	assert.NoError(t, utils.WriteInvocation(jobManagerDirectory, invocation, samplesheet, configfile))
+	replayDryRunFlag = true
+	defer func() {
+		replayDryRunFlag = false
+		runCmd.Flags().Set("dry-run", "false")
+	}()
+	assert.False(t, replayMain([]string{jobManagerDirectory}), "FASTQ files in sample sheet are missing")
+}
+
+/*
+ * Config file whose output directory is outputDirectoryPath
+ */
+func createTestConfigFile(t *testing.T, outputDirectoryPath string) string {
+	raw, err := ioutil.ReadFile("../test/datafiles/configfile_1run-test.json")
+	assert.NoError(t, err)
+	var config map[string]interface{}
+	assert.NoError(t, json.Unmarshal(raw, &config))
+	config["output_directory"] = map[string]interface{}{"path": outputDirectoryPath}
+	data, err := json.Marshal(config)
+	assert.NoError(t, err)
+	fn := filepath.Join(t.TempDir(), "configfile.json")
+	assert.NoError(t, ioutil.WriteFile(fn, data, 0644))
+	return fn
+}
+
+func Test_cancelMain_heartbeat_timeout(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	configfile := createTestConfigFile(t, outputDirectoryPath)
+	attemptDirectory := filepath.Join(outputDirectoryPath, "jobManager", "20211101145001", "NA12878")
+	assert.NoError(t, os.MkdirAll(attemptDirectory, 0755))
+	// process group of other program, whose pgid is same as toil-cwl-runner of crashed JobManager
+	c := exec.Command("sleep", "30")
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	assert.NoError(t, c.Start())
+	defer c.Process.Kill()
+	go c.Wait()
+	hostname, _ := os.Hostname()
+	heartbeatAt := time.Now().Add(-2 * utils.HeartbeatTimeout).Format("20060102150405")
+	utils.WriteProcessRecord(attemptDirectory, &utils.ProcessRecord{Pid: c.Process.Pid, Pgid: c.Process.Pid, Hostname: hostname, JobManagerPid: c.Process.Pid, StartedAt: "20211101145001", HeartbeatAt: heartbeatAt})
+
+	cancelSampleId = "NA12878"
+	cancelToilCleanFlag = true
+	defer func() {
+		cancelSampleId = ""
+		cancelToilCleanFlag = false
+	}()
+	assert.False(t, cancelMain([]string{"../test/datafiles/samplesheet_1run-test.json", configfile}), "heartbeat is old")
+	assert.True(t, utils.IsProcessGroupAlive(c.Process.Pid), "signal is not sent")
+	assert.False(t, utils.IsExistsFile(filepath.Join(attemptDirectory, utils.CancelledFileName)))
+}
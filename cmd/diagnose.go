@@ -0,0 +1,134 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var diagnoseSampleId string
+var diagnoseAllAttemptsFlag bool
+
+// diagnoseCmd represents the diagnose command
+var diagnoseCmd = &cobra.Command{
+	Use:   "diagnose",
+	Short: "Classify failure of samples",
+	Long: `Classify failure of samples by toil stderr and toil log file (logs/<sample>.log).
+Failure category, failing CWL step, the matched log line and hint are displayed.
+Rules are 'failure_rules' in config file followed by default rules.
+If '--sample' is not set, all failed samples are diagnosed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !diagnoseMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diagnoseCmd)
+
+	diagnoseCmd.Flags().StringVarP(&diagnoseSampleId, "sample", "", "", "Sample ID to diagnose")
+	diagnoseCmd.Flags().BoolVarP(&diagnoseAllAttemptsFlag, "all-attempts", "", false, "Diagnose all executions, not only the latest one")
+}
+
+func diagnoseMain(args []string) bool {
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	rules, err := utils.LoadFailureRules(&rss)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	outputDirectoryPath := rss.OutputDirectory.Path
+	sampleIdList := []string{}
+	if diagnoseSampleId != "" {
+		for _, s := range ss.SampleList {
+			if s.SampleId == diagnoseSampleId {
+				sampleIdList = append(sampleIdList, s.SampleId)
+			}
+		}
+		if len(sampleIdList) == 0 {
+			fmt.Printf("SampleId [%s] is not in sample sheet\n", diagnoseSampleId)
+			return false
+		}
+	} else {
+		sampleIdList = utils.CreateExecuteSampleIDList(outputDirectoryPath, &ss)
+	}
+	for _, sampleId := range sampleIdList {
+		attemptDirectories := utils.ListSampleAttemptDirectories(outputDirectoryPath, sampleId)
+		if len(attemptDirectories) == 0 {
+			if diagnoseSampleId != "" {
+				fmt.Printf("SampleId [%s] is never executed\n", sampleId)
+			}
+			continue
+		}
+		if !diagnoseAllAttemptsFlag {
+			attemptDirectories = attemptDirectories[:1]
+		}
+		for _, jobManagerDirectory := range attemptDirectories {
+			if isRunning, _ := utils.IsAttemptRunning(jobManagerDirectory); isRunning {
+				fmt.Printf("Sample ID: [%s] is running\n", sampleId)
+				fmt.Printf(" JobManager directory: [%s]\n", jobManagerDirectory)
+				continue
+			}
+			if utils.GetExitCodeContent(jobManagerDirectory+"/toil.exitcode.txt") == "0" && utils.CheckAllResultFiles(outputDirectoryPath, sampleById(sampleId)) {
+				fmt.Printf("Sample ID: [%s] is successfully finished\n", sampleId)
+				fmt.Printf(" JobManager directory: [%s]\n", jobManagerDirectory)
+				continue
+			}
+			displayDiagnosis(utils.DiagnoseAttempt(jobManagerDirectory, sampleId, rules))
+		}
+	}
+	return true
+}
+
+func sampleById(sampleId string) *utils.Sample {
+	for _, s := range ss.SampleList {
+		if s.SampleId == sampleId {
+			return s
+		}
+	}
+	return &utils.Sample{SampleId: sampleId}
+}
+
+func displayDiagnosis(diagnosis *utils.Diagnosis) {
+	fmt.Printf("Sample ID: [%s] has error\n", diagnosis.SampleId)
+	fmt.Printf(" JobManager directory: [%s]\n", diagnosis.JobManagerDirectory)
+	if diagnosis.ExitCode != "" {
+		fmt.Printf(" ExitCode: [%s]\n", diagnosis.ExitCode)
+	} else {
+		fmt.Print(" ExitCode file is missing. JobManager is seemed to be killed\n")
+	}
+	fmt.Printf(" Category: [%s] %s\n", diagnosis.Category, diagnosis.Description)
+	if diagnosis.MatchedLine != "" {
+		fmt.Printf(" Matched: %s:%d\n", diagnosis.MatchedFile, diagnosis.MatchedLineNo)
+		fmt.Printf("   %s\n", diagnosis.MatchedLine)
+	}
+	if diagnosis.FailingStep != "" {
+		fmt.Printf(" Failing step: [%s]\n", diagnosis.FailingStep)
+		fmt.Printf("   %s\n", diagnosis.FailingStepLine)
+	} else {
+		fmt.Print(" Failing step is not found in toil log\n")
+	}
+	if diagnosis.Hint != "" {
+		fmt.Printf(" Hint: %s\n", diagnosis.Hint)
+	}
+}
@@ -16,12 +16,17 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
 	"github.com/spf13/cobra"
 )
 
+var displayJobmanagerRecognitionFormat string
+
 // displayJobmanagerRecognitionCmd represents the displayJobmanagerRecognition command
 var displayJobmanagerRecognitionCmd = &cobra.Command{
 	Use:   "display-jobmanager-recognition",
@@ -30,27 +35,73 @@ var displayJobmanagerRecognitionCmd = &cobra.Command{
 Virutlenv state
 Singularity command
 Slurm command
+Versions of toil-cwl-runner, singularity, sbatch and python
+Slurm partitions by sinfo
+Container images in CWL files which are not cached in container_cache_directory
+Disk space estimated for samples which are not finished
+Finally, whether 'run' can execute samples is displayed. If not ready, exit code is 1.
+With '--format json', report is written to stdout as JSON and other messages are written to stderr.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("displayJobmanagerRecognition called")
-		// This command display recognition of JobManager.
-		// So result of loadSampleSheetAndConfigFile is not care.
-		loadSampleSheetAndConfigFile(args)
-		utils.CheckSampleSheetFiles(&ss, fileExistsCheckFlag, fileHashCheckFlag, displayMeesage)
-		utils.DisplayJobManagerRecoginition(&rss)
+		if !displayJobmanagerRecognitionMain(args) {
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(displayJobmanagerRecognitionCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// displayJobmanagerRecognitionCmd.PersistentFlags().String("foo", "", "A help for foo")
+	displayJobmanagerRecognitionCmd.Flags().StringVarP(&displayJobmanagerRecognitionFormat, "format", "", "text", "Output format: text or json")
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// displayJobmanagerRecognitionCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+/*
+ * Return value: true if ready to run
+ */
+func displayJobmanagerRecognitionMain(args []string) bool {
+	if displayJobmanagerRecognitionFormat != "text" && displayJobmanagerRecognitionFormat != "json" {
+		fmt.Printf("Unknown format [%s]\n", displayJobmanagerRecognitionFormat)
+		return false
+	}
+	// messages while loading and checking files must not be mixed in JSON
+	var messages io.Writer = os.Stdout
+	if displayJobmanagerRecognitionFormat == "json" {
+		messages = os.Stderr
+	} else {
+		fmt.Println("displayJobmanagerRecognition called")
+	}
+	// This command display recognition of JobManager.
+	// So result of loadSampleSheetAndConfigFile is not care.
+	loaded := loadSampleSheetAndConfigFileTo(messages, args)
+	if rss.WorkflowFile == nil || rss.OutputDirectory == nil {
+		fmt.Fprintln(messages, "Config file is not loaded")
+		return false
+	}
+	sampleSheetFilesFound := utils.CheckSampleSheetFiles(messages, &ss, fileExistsCheckFlag, fileHashCheckFlag, displayMeesage)
+	env := utils.CollectEnvironmentReport(&rss)
+	env.CollectToolsAndPartitions()
+	report := utils.NewReadinessReport(toolVersionString(), env, utils.MissingFilesForExecute(&rss),
+		utils.CheckDiskSpace(&rss, pendingSamples(rss.OutputDirectory.Path)))
+	if !loaded {
+		report.AddProblem("sample sheet or config file is invalid")
+	}
+	if !sampleSheetFilesFound {
+		report.AddProblem("some FASTQ files in sample sheet are missing or invalid")
+	}
+	if images, missing, err := missingCachedImages(&rss); err != nil {
+		fmt.Fprintln(messages, err)
+	} else {
+		report.SetCachedImages(images, missing)
+	}
+	if displayJobmanagerRecognitionFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+	} else {
+		utils.DisplayJobManagerRecoginition(report)
+	}
+	return report.Ready
 }
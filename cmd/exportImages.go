@@ -0,0 +1,86 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var exportImagesOutput string
+var exportImagesAllowMissing bool
+
+// exportImagesCmd represents the export-images command
+var exportImagesCmd = &cobra.Command{
+	Use:   "export-images",
+	Short: "Export cached container images of the workflow into a bundle",
+	Long: `Export cached container images required by the workflow into a bundle (tar), for offline nodes.
+Images are dockerPull of DockerRequirement in CWL files of the workflow,
+and their .sif and .tar files in container_cache_directory are bundled.
+The bundle has ` + utils.ImageBundleManifestFileName + ` with image names, file names, sizes and sha256.
+Import the bundle by import-images.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !exportImagesMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportImagesCmd)
+
+	exportImagesCmd.Flags().StringVarP(&exportImagesOutput, "output", "o", "", "Image bundle file to write (required)")
+	exportImagesCmd.Flags().BoolVarP(&exportImagesAllowMissing, "allow-missing", "", false, "Export even if some images are not cached")
+}
+
+func exportImagesMain(args []string) bool {
+	if exportImagesOutput == "" {
+		fmt.Println("--output is required")
+		return false
+	}
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	images, err := utils.DiscoverDockerImages(utils.WorkflowDirectory(rss.WorkflowFile.Path))
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	containerCacheDirectory := rss.ContainerCacheDirectory.Path
+	entries, missing := utils.CachedImageEntries(containerCacheDirectory, images)
+	for _, image := range missing {
+		fmt.Printf("Container image [%s] is not cached in [%s]\n", image, containerCacheDirectory)
+	}
+	if len(missing) > 0 && !exportImagesAllowMissing {
+		fmt.Println("To cache them, use `pull-container-images`. To export anyway, use --allow-missing")
+		return false
+	}
+	manifest, err := utils.WriteImageBundle(exportImagesOutput, containerCacheDirectory, entries, toolVersionString())
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	total := int64(0)
+	for _, entry := range manifest.Images {
+		fmt.Printf("%s\t%s\t%s\tsha256:%s\n", entry.Image, entry.File, utils.FormatBytes(entry.Size), entry.Sha256)
+		total += entry.Size
+	}
+	fmt.Printf("%d files (%s) are exported to [%s]\n", len(manifest.Images), utils.FormatBytes(total), exportImagesOutput)
+	return true
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var exportProvenanceSampleIds []string
+var exportProvenanceChecksum bool
+
+// exportProvenanceCmd represents the export-provenance command
+var exportProvenanceCmd = &cobra.Command{
+	Use:   "export-provenance",
+	Short: "Export provenance of finished samples as RO-Crate",
+	Long: `Export provenance of finished samples as RO-Crate metadata (` + utils.RoCrateMetadataFileName + `)
+in result directory of each sample. It records
+  - workflow file and its digest, version of this tool
+  - container images in CWL files and their digests in container_cache_directory
+  - job file of the latest successful execution, sample sheet and config file (copied to ` + utils.ProvenanceDirectoryName + `/)
+    If successful execution is not found, job file is not recorded
+  - FASTQ files with md5 in sample sheet, reference files
+  - result files with size, md5 and sha256`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !exportProvenanceMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportProvenanceCmd)
+
+	exportProvenanceCmd.Flags().StringSliceVarP(&exportProvenanceSampleIds, "sample", "", []string{}, "Sample IDs to export. Default is all finished samples")
+	exportProvenanceCmd.Flags().BoolVarP(&exportProvenanceChecksum, "checksum", "", true, "Compute md5 and sha256 of result files")
+}
+
+// sample sheet and config file copied by `run`. If not copied, the given file is used.
+func copiedInputFile(outputDirectoryPath string, fn string) string {
+	copied := filepath.Join(outputDirectoryPath, filepath.Base(fn))
+	if utils.IsExistsFile(copied) {
+		return copied
+	}
+	return fn
+}
+
+func exportProvenanceMain(args []string) bool {
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	outputDirectoryPath := rss.OutputDirectory.Path
+	// container images are dockerPull of the workflow
+	images, err := utils.DiscoverDockerImages(utils.WorkflowDirectory(rss.WorkflowFile.Path))
+	if err != nil {
+		fmt.Printf("Container images are not recorded: %v\n", err)
+		images = []string{}
+	}
+	containerImages, missingContainerImages := utils.CollectContainerImages(rss.ContainerCacheDirectory.Path, images)
+	opts := &utils.ProvenanceOptions{
+		SampleSheetFile:        copiedInputFile(outputDirectoryPath, args[0]),
+		ConfigFile:             copiedInputFile(outputDirectoryPath, args[1]),
+		ContainerImages:        containerImages,
+		MissingContainerImages: missingContainerImages,
+		Checksum:               exportProvenanceChecksum,
+	}
+	result := true
+	for _, s := range ss.SampleList {
+		if len(exportProvenanceSampleIds) > 0 && !contains(exportProvenanceSampleIds, s.SampleId) {
+			continue
+		}
+		if !utils.CheckAllResultFiles(outputDirectoryPath, s) {
+			fmt.Printf("SampleId: %s is not finished. skip\n", s.SampleId)
+			continue
+		}
+		fn, err := utils.ExportProvenance(outputDirectoryPath, s, &rss, opts)
+		if err != nil {
+			fmt.Printf("SampleId: %s provenance can not be exported: %v\n", s.SampleId, err)
+			result = false
+			continue
+		}
+		fmt.Printf("SampleId: %s provenance is exported to [%s]\n", s.SampleId, fn)
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var importImagesCacheDirectory string
+var importImagesForce bool
+
+// importImagesCmd represents the import-images command
+var importImagesCmd = &cobra.Command{
+	Use:   "import-images <image bundle>",
+	Short: "Import container images from a bundle created by export-images",
+	Long: `Import container images from a bundle created by export-images into container cache directory.
+Size and sha256 of each image are verified with ` + utils.ImageBundleManifestFileName + ` in the bundle,
+and only verified images are placed in the directory.
+Existing image with the same sha256 is kept. Existing image with different sha256 is replaced only with --force.
+Result of each image is displayed, and exit code is 1 if some images are failed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !importImagesMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importImagesCmd)
+
+	importImagesCmd.Flags().StringVarP(&importImagesCacheDirectory, "cache-dir", "", "", "Container cache directory to import images, container_cache_directory in config file (required)")
+	importImagesCmd.Flags().BoolVarP(&importImagesForce, "force", "", false, "Replace existing images with different sha256")
+}
+
+func writeImportResults(w io.Writer, results []utils.ImportResult) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tSTATUS\tFILE\tERROR")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Image, r.Status, r.File, r.ErrorMessage)
+	}
+	tw.Flush()
+}
+
+func importImagesMain(args []string) bool {
+	if importImagesCacheDirectory == "" {
+		fmt.Println("--cache-dir is required")
+		return false
+	}
+	results, err := utils.ImportImageBundle(args[0], importImagesCacheDirectory, importImagesForce)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	writeImportResults(os.Stdout, results)
+	failed := 0
+	for _, r := range results {
+		if r.Status == utils.ImportStatusFailed {
+			failed += 1
+		}
+	}
+	fmt.Printf("%d files, %d failed\n", len(results), failed)
+	return failed == 0
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"syscall"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var logsSampleId string
+var logsAttempt int
+var logsLatestFlag bool
+var logsAllFlag bool
+var logsListFlag bool
+var logsStdoutFlag bool
+var logsStderrFlag bool
+var logsToilFlag bool
+var logsFollowFlag bool
+var logsGrepPattern string
+var logsTailLines int
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show logs of sample",
+	Long: `Show logs of sample in jobManager directory.
+Attempts are numbered from 1 for the first execution. The latest attempt is shown by default.
+Log file is selected by '--toil' (logs/<sample>.log, default), '--stderr' (toil.stderr.txt) or '--stdout' (toil.stdout.txt).
+If '--grep' is set, only matched lines are shown with line number.
+If '--follow' is set, appended lines are shown until the execution is finished.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !logsMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().StringVarP(&logsSampleId, "sample", "", "", "Sample ID")
+	logsCmd.Flags().IntVarP(&logsAttempt, "attempt", "", 0, "Attempt number, 1 is the first execution")
+	logsCmd.Flags().BoolVarP(&logsLatestFlag, "latest", "", false, "Show the latest attempt (default)")
+	logsCmd.Flags().BoolVarP(&logsAllFlag, "all", "", false, "Show all attempts from the first execution")
+	logsCmd.Flags().BoolVarP(&logsListFlag, "list", "", false, "List attempts")
+	logsCmd.Flags().BoolVarP(&logsStdoutFlag, "stdout", "", false, "Show toil stdout")
+	logsCmd.Flags().BoolVarP(&logsStderrFlag, "stderr", "", false, "Show toil stderr")
+	logsCmd.Flags().BoolVarP(&logsToilFlag, "toil", "", false, "Show toil log file (default)")
+	logsCmd.Flags().BoolVarP(&logsFollowFlag, "follow", "f", false, "Show appended lines until the execution is finished")
+	logsCmd.Flags().StringVarP(&logsGrepPattern, "grep", "", "", "Show lines matched to the regular expression")
+	logsCmd.Flags().IntVarP(&logsTailLines, "tail", "", 0, "Show last lines only. 0 is all lines")
+	logsCmd.MarkFlagRequired("sample")
+}
+
+func selectedLogKind() (string, error) {
+	kind := utils.LogKindToil
+	selected := 0
+	if logsStdoutFlag {
+		kind = utils.LogKindStdout
+		selected += 1
+	}
+	if logsStderrFlag {
+		kind = utils.LogKindStderr
+		selected += 1
+	}
+	if logsToilFlag {
+		selected += 1
+	}
+	if selected > 1 {
+		return "", fmt.Errorf("--stdout, --stderr and --toil can not be used together")
+	}
+	return kind, nil
+}
+
+func logsMain(args []string) bool {
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	kind, err := selectedLogKind()
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if (logsAllFlag && (logsAttempt != 0 || logsLatestFlag)) || (logsLatestFlag && logsAttempt != 0) {
+		fmt.Println("--attempt, --latest and --all can not be used together")
+		return false
+	}
+	if logsFollowFlag && (logsAllFlag || logsListFlag) {
+		fmt.Println("--follow can not be used with --all or --list")
+		return false
+	}
+	var re *regexp.Regexp
+	if logsGrepPattern != "" {
+		if re, err = regexp.Compile(logsGrepPattern); err != nil {
+			fmt.Printf("invalid pattern [%s]: %v\n", logsGrepPattern, err)
+			return false
+		}
+	}
+	outputDirectoryPath := rss.OutputDirectory.Path
+	// the latest is first
+	attemptDirectories := utils.ListSampleAttemptDirectories(outputDirectoryPath, logsSampleId)
+	if (logsListFlag || logsAllFlag) && len(attemptDirectories) == 0 {
+		fmt.Printf("SampleId [%s] is never executed\n", logsSampleId)
+		return false
+	}
+	if logsListFlag {
+		for i := range attemptDirectories {
+			jobManagerDirectory := attemptDirectories[len(attemptDirectories)-1-i]
+			attempt := utils.CollectAttemptStatus(jobManagerDirectory)
+			state := "exitcode " + attempt.ExitCode
+			if attempt.Running {
+				state = "running"
+			} else if attempt.Killed {
+				state = "killed"
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\n", i+1, filepath.Base(filepath.Dir(jobManagerDirectory)), state, jobManagerDirectory)
+		}
+		return true
+	}
+	if logsAllFlag {
+		for i := len(attemptDirectories) - 1; i >= 0; i-- {
+			logFilePath := utils.LogFilePath(attemptDirectories[i], logsSampleId, kind)
+			fmt.Printf("==> %s <==\n", logFilePath)
+			if _, _, err := utils.WriteLog(os.Stdout, logFilePath, re, logsTailLines, true); err != nil {
+				fmt.Println(err)
+			}
+		}
+		return true
+	}
+	jobManagerDirectory, err := utils.ResolveAttemptDirectory(outputDirectoryPath, logsSampleId, logsAttempt)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logFilePath := utils.LogFilePath(jobManagerDirectory, logsSampleId, kind)
+	offset, lineNo, err := utils.WriteLog(os.Stdout, logFilePath, re, logsTailLines, !logsFollowFlag)
+	if err != nil && !(logsFollowFlag && os.IsNotExist(err)) {
+		fmt.Println(err)
+		return false
+	}
+	if logsFollowFlag {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		utils.FollowLog(ctx, os.Stdout, logFilePath, offset, lineNo, re, func() bool {
+			isRunning, _ := utils.IsAttemptRunning(jobManagerDirectory)
+			return !isRunning
+		})
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+var packageDeliveryDirectory string
+var packageMode string
+var packageManifest string
+var packageSampleIds []string
+var packageJobs int
+
+// packageCmd represents the package command
+var packageCmd = &cobra.Command{
+	Use:   "package",
+	Short: "Write checksum manifest of result files of finished samples",
+	Long: `Write manifest (path, size, md5 and sha256) of result files of finished samples.
+Result files are the files checked by show-job-progress.
+If '--delivery-dir' is set, result files are placed in the delivery directory in the same layout
+as output directory (sampleId/...), by hard link (fall back to copy) or copy.
+Manifest is written in the delivery directory, or output directory if delivery directory is not set.
+Entries of samples packaged before are kept. Verify the files later by verify-package.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !packageMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(packageCmd)
+
+	packageCmd.Flags().StringVarP(&packageDeliveryDirectory, "delivery-dir", "", "", "Delivery directory where result files are placed")
+	packageCmd.Flags().StringVarP(&packageMode, "mode", "", utils.DeliveryModeHardlink, "How result files are placed in delivery directory, hardlink or copy")
+	packageCmd.Flags().StringVarP(&packageManifest, "manifest", "", "", "Manifest file. Default is "+utils.ManifestFileName+" in delivery directory or output directory")
+	packageCmd.Flags().StringSliceVarP(&packageSampleIds, "sample", "", []string{}, "Sample IDs to package. Default is all finished samples")
+	packageCmd.Flags().IntVarP(&packageJobs, "jobs", "j", 4, "Number of samples packaged in parallel")
+}
+
+func packageMain(args []string) bool {
+	if packageMode != utils.DeliveryModeHardlink && packageMode != utils.DeliveryModeCopy {
+		fmt.Printf("Unknown mode [%s]\n", packageMode)
+		return false
+	}
+	if packageJobs < 1 {
+		packageJobs = 1
+	}
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	outputDirectoryPath := rss.OutputDirectory.Path
+	rootDirectoryPath := packageDeliveryDirectory
+	mode := packageMode
+	if rootDirectoryPath == "" {
+		rootDirectoryPath = outputDirectoryPath
+		mode = utils.DeliveryModeNone
+	}
+	manifestPath := packageManifest
+	if manifestPath == "" {
+		manifestPath = filepath.Join(rootDirectoryPath, utils.ManifestFileName)
+	}
+	sampleList := []*utils.Sample{}
+	if len(packageSampleIds) > 0 {
+		for _, sampleId := range packageSampleIds {
+			found := false
+			for _, s := range ss.SampleList {
+				if s.SampleId == sampleId {
+					sampleList = append(sampleList, s)
+					found = true
+				}
+			}
+			if !found {
+				fmt.Printf("SampleId [%s] is not in sample sheet\n", sampleId)
+				return false
+			}
+		}
+	} else {
+		sampleList = ss.SampleList
+	}
+	finishedSampleList := []*utils.Sample{}
+	for _, s := range sampleList {
+		if utils.CheckAllResultFiles(outputDirectoryPath, s) {
+			finishedSampleList = append(finishedSampleList, s)
+		} else {
+			fmt.Printf("SampleId: %s is not finished. skip\n", s.SampleId)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0755); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	entries, err := utils.ReadManifest(manifestPath)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	var mutex sync.Mutex
+	packagedSampleIds := []string{}
+	packagedEntries := []utils.ManifestEntry{}
+	semaphore := make(chan struct{}, packageJobs)
+	var eg errgroup.Group
+	for _, s := range finishedSampleList {
+		s := s
+		eg.Go(func() error {
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			sampleEntries, err := utils.PackageSample(outputDirectoryPath, s, rootDirectoryPath, mode)
+			if err != nil {
+				fmt.Printf("SampleId: %s can not be packaged: %v\n", s.SampleId, err)
+				return err
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			packagedSampleIds = append(packagedSampleIds, s.SampleId)
+			packagedEntries = append(packagedEntries, sampleEntries...)
+			fmt.Printf("SampleId: %s is packaged. %d files\n", s.SampleId, len(sampleEntries))
+			return nil
+		})
+	}
+	packageErr := eg.Wait()
+	// successfully packaged samples are written even if other samples fail
+	entries = utils.MergeManifest(entries, packagedSampleIds, packagedEntries)
+	if err := utils.WriteManifest(manifestPath, entries); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	fmt.Printf("%d samples are packaged. manifest: %s\n", len(packagedSampleIds), manifestPath)
+	return packageErr == nil
+}
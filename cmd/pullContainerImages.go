@@ -16,11 +16,14 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
 	"github.com/spf13/cobra"
@@ -29,6 +32,8 @@ import (
 //
 var pullSingularityImages bool
 var pullDockerImages bool
+var pullForce bool
+var pullJobs int
 
 // pullContainerImagesCmd represents the pullContainerImages command
 var pullContainerImagesCmd = &cobra.Command{
@@ -37,34 +42,17 @@ var pullContainerImagesCmd = &cobra.Command{
 	Long: `Pull container images
 Please specify --sigularity or --docker.
 
+Images are dockerPull of DockerRequirement in CWL files of the workflow.
 Cached container images are save in container_cache_directory.
 singularity image has suffix .sif
 docker image has suffix .tar
+Cached images are not pulled again unless --force is set.
+Result of each image is displayed, and exit code is 1 if some images are failed.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		if pullDockerImages == false && pullSingularityImages == false {
-			fmt.Println("One of --docker or --singularity is required")
-			os.Exit(1)
-		}
-		if pullDockerImages == true && pullSingularityImages == true {
-			fmt.Println("One of --docker or --singularity is required")
-			os.Exit(1)
-		}
-		if pullDockerImages {
-			if !utils.IsExistsDocker() {
-				fmt.Println("docker is not found.")
-				os.Exit(1)
-			}
-		}
-		if pullSingularityImages {
-			if !utils.IsExistsSingularity() {
-				fmt.Println("singularity is not found.")
-			}
-		}
-		pullResult := execPullContainerImages(args)
-		if !pullResult {
+		if !pullContainerImagesMain(args) {
 			fmt.Println("Some error happens at pull images.")
-			os.Exit(0)
+			os.Exit(1)
 		}
 	},
 }
@@ -72,49 +60,49 @@ docker image has suffix .tar
 func init() {
 	rootCmd.AddCommand(pullContainerImagesCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// pullContainerImagesCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// pullContainerImagesCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	pullContainerImagesCmd.Flags().BoolVarP(&pullSingularityImages, "singularity", "", false, "Save Singularity images")
 	pullContainerImagesCmd.Flags().BoolVarP(&pullDockerImages, "docker", "", false, "Save as Docker images")
+	pullContainerImagesCmd.Flags().BoolVarP(&pullForce, "force", "", false, "Pull images even if they are cached")
+	pullContainerImagesCmd.Flags().IntVarP(&pullJobs, "jobs", "j", 4, "Number of images pulled in parallel")
 }
 
-func cacheDockerImages(cwldir string, container_cache_directory string, scriptCode string) bool {
-	c1 := exec.Command("/bin/bash")
-	scriptEnv := append(os.Environ(), "CWLDIR="+cwldir)
+/*
+ * Format of images from --singularity and --docker. Empty if not valid.
+ */
+func pullImageFormat() string {
+	if pullDockerImages == pullSingularityImages {
+		fmt.Println("One of --docker or --singularity is required")
+		return ""
+	}
 	if pullDockerImages {
-		scriptEnv = append(scriptEnv, "CWL_DOCKER_CACHE="+container_cache_directory)
+		if !utils.IsExistsDocker() {
+			fmt.Println("docker is not found.")
+			return ""
+		}
+		return utils.ContainerImageFormatDocker
 	}
-	if pullSingularityImages {
-		scriptEnv = append(scriptEnv, "CWL_SINGULARITY_CACHE="+container_cache_directory)
+	if !utils.IsExistsSingularity() {
+		fmt.Println("singularity is not found.")
+		return ""
 	}
+	return utils.ContainerImageFormatSingularity
+}
 
-	c1.Env = scriptEnv
-	stdin, _ := c1.StdinPipe()
-	io.WriteString(stdin, scriptCode)
-	stdin.Close()
-	output, _ := c1.CombinedOutput()
-
-	c1.Start()
-	c1.Wait()
-	fmt.Println(string(output))
-	exitCode := c1.ProcessState.ExitCode()
-	fmt.Printf("Pull ExitCode is [%d]\n", exitCode)
-	return exitCode == 0
+func writePullResults(w io.Writer, results []utils.PullResult) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tSTATUS\tELAPSED\tFILE\tERROR")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Image, r.Status, r.Elapsed.Round(time.Second), r.File, r.ErrorMessage)
+	}
+	tw.Flush()
 }
 
-func execPullContainerImages(args []string) bool {
+func pullContainerImagesMain(args []string) bool {
+	format := pullImageFormat()
+	if format == "" {
+		return false
+	}
 	loadSampleSheetAndConfigFile(args)
-	// check in sample sheet data
-	// if !checkSampleSheet(&ss) {
-	// 	return
-	// }
 	// check in config data
 	if !checkConfigFile(&rss) {
 		return false
@@ -124,23 +112,23 @@ func execPullContainerImages(args []string) bool {
 		fmt.Println("Stop pull container images")
 		return false
 	}
-	// assueme workflow file is
-	//  jga-analysis/per-sample/Workflows/per-sample.cwl
-	// become
-	//  jga-analysis/per-sample
-	cwldir := filepath.Dir(filepath.Dir(rss.WorkflowFile.Path))
-	// cache create this directory
-	//  docker image cache has suffix ".tar"
-	//  singularity image cache has suffix ".sif"
-	container_cache_directory := rss.ContainerCacheDirectory.Path
-	fmt.Println(container_cache_directory)
-	//
-	result := false
-	if pullDockerImages {
-		result = cacheDockerImages(cwldir, container_cache_directory, string(createDockerImageScript))
+	images, err := utils.DiscoverDockerImages(utils.WorkflowDirectory(rss.WorkflowFile.Path))
+	if err != nil {
+		fmt.Println(err)
+		return false
 	}
-	if pullSingularityImages {
-		result = cacheDockerImages(cwldir, container_cache_directory, string(createSingularityImageScript))
+	containerCacheDirectory := rss.ContainerCacheDirectory.Path
+	fmt.Printf("Pull [%d] images to [%s]\n", len(images), containerCacheDirectory)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	results := utils.PullImages(ctx, images, containerCacheDirectory, format, pullForce, pullJobs)
+	writePullResults(os.Stdout, results)
+	failed := 0
+	for _, r := range results {
+		if r.Status == utils.PullStatusFailed {
+			failed += 1
+		}
 	}
-	return result
+	fmt.Printf("%d images, %d failed\n", len(results), failed)
+	return failed == 0
 }
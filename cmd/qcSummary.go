@@ -0,0 +1,138 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var qcSummaryFormat string
+var qcSummaryOutput string
+
+//go:embed qc_summary.html
+var qcSummaryHtml string
+
+// qcSummaryCmd represents the qc-summary command
+var qcSummaryCmd = &cobra.Command{
+	Use:   "qc-summary",
+	Short: "Summarize QC metrics of finished samples",
+	Long: `Summarize QC metrics of samples in output directory into one table.
+  mapping rate   : samtools flagstat (.cram.flagstat)
+  duplicate rate : Picard MarkDuplicates (.metrics.txt)
+  mean coverage  : Picard CollectWgsMetrics of each region (.cram.<region>.wgs_metrics)
+  Ti/Tv, variants: bcftools stats of each region (.<region>.g.vcf.gz.bcftools-stats)
+Samples which do not satisfy 'qc_thresholds' in config file are flagged as outliers.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !qcSummaryMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(qcSummaryCmd)
+
+	qcSummaryCmd.Flags().StringVarP(&qcSummaryFormat, "format", "", "tsv", "Output format, tsv, json or html")
+	qcSummaryCmd.Flags().StringVarP(&qcSummaryOutput, "output", "o", "", "Output file. Default is stdout")
+}
+
+func qcSummaryMain(args []string) bool {
+	if qcSummaryFormat != "tsv" && qcSummaryFormat != "json" && qcSummaryFormat != "html" {
+		fmt.Printf("Unknown format [%s]\n", qcSummaryFormat)
+		return false
+	}
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	summary := utils.CollectQcSummary(rss.OutputDirectory.Path, &ss, utils.GetQcThresholds(&rss))
+	var w io.Writer = os.Stdout
+	if qcSummaryOutput != "" {
+		f, err := os.Create(qcSummaryOutput)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		defer f.Close()
+		w = f
+	}
+	var err error
+	switch qcSummaryFormat {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(summary)
+	case "html":
+		err = writeQcSummaryHtml(w, summary)
+	default:
+		writeQcSummaryTsv(w, summary)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "%d samples, %d outliers, %d not finished\n", len(summary.Samples), summary.Outliers, len(summary.NotFinishedSampleIds))
+	return true
+}
+
+func formatQcValue(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%g", *value)
+}
+
+func writeQcSummaryTsv(w io.Writer, summary *utils.QcSummary) {
+	header := []string{"sample_id", "total_reads", "mapping_rate", "duplicate_rate"}
+	for _, region := range utils.QcRegions {
+		header = append(header, "mean_coverage_"+region, "titv_"+region, "records_"+region, "snps_"+region, "indels_"+region)
+	}
+	header = append(header, "flags", "errors")
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, sample := range summary.Samples {
+		row := []string{sample.SampleId, formatQcValue(sample.TotalReads), formatQcValue(sample.MappingRate), formatQcValue(sample.DuplicateRate)}
+		for _, region := range utils.QcRegions {
+			regionQc := sample.Region(region)
+			if regionQc == nil {
+				regionQc = &utils.RegionQc{}
+			}
+			row = append(row, formatQcValue(regionQc.MeanCoverage), formatQcValue(regionQc.TiTv), formatQcValue(regionQc.Records), formatQcValue(regionQc.Snps), formatQcValue(regionQc.Indels))
+		}
+		row = append(row, strings.Join(sample.Flags, ","), strings.Join(sample.Errors, ","))
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+}
+
+func writeQcSummaryHtml(w io.Writer, summary *utils.QcSummary) error {
+	page, err := template.New("qc").Funcs(template.FuncMap{
+		"value": formatQcValue,
+	}).Parse(qcSummaryHtml)
+	if err != nil {
+		return err
+	}
+	return page.Execute(w, struct {
+		Summary *utils.QcSummary
+		Regions []string
+	}{summary, utils.QcRegions})
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var replayDryRunFlag bool
+var replayBreakLockFlag bool
+
+// jobManager directory of the replayed invocation, recorded in new invocation by `run`
+var replayOf string
+
+// Flags of `run` which depend on the state at that time, so they are not replayed
+var replayIgnoredFlags = []string{"dry-run", "break-lock"}
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay <jobManager/<currentTime> directory or invocation.json>",
+	Short: "Execute workflow again from invocation recorded by run",
+	Long: `Execute workflow again from invocation recorded by 'run' in jobManager/<currentTime>/` + utils.InvocationDirectoryName + `.
+	Copies of sample sheet and config file in the record are used with the same flags,
+	in the same working directory as recorded, so relative paths in config file are resolved as before.
+	'--dry-run' and '--break-lock' are not replayed. Set them to 'replay' if needed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !replayMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().BoolVarP(&replayDryRunFlag, "dry-run", "n", false, "Dry-run, do not execute acutal command")
+	replayCmd.Flags().BoolVarP(&replayBreakLockFlag, "break-lock", "", false, "Remove lock of output directory held by other 'run'")
+}
+
+/*
+ * Set flags of `run` to the recorded values.
+ */
+func applyInvocationFlags(invocation *utils.Invocation) bool {
+	for name, value := range invocation.Flags {
+		if contains(replayIgnoredFlags, name) {
+			continue
+		}
+		if runCmd.Flags().Lookup(name) == nil {
+			fmt.Printf("Flag --%s is not supported by this version. ignored\n", name)
+			continue
+		}
+		if err := runCmd.Flags().Set(name, value); err != nil {
+			fmt.Printf("Flag --%s=%s can not be replayed: %v\n", name, value, err)
+			return false
+		}
+	}
+	runCmd.Flags().Set("dry-run", fmt.Sprint(replayDryRunFlag))
+	runCmd.Flags().Set("break-lock", fmt.Sprint(replayBreakLockFlag))
+	return true
+}
+
+func replayMain(args []string) bool {
+	invocation, err := utils.ReadInvocation(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	invocationDirectory := filepath.Dir(invocation.SampleSheetFile)
+	fmt.Printf("Replay invocation [%s] started at %s\n", invocationDirectory, invocation.StartedAt)
+	if invocation.ToolVersion != toolVersionString() {
+		fmt.Println("Version of this tool is different from the recorded invocation")
+		fmt.Printf("  recorded: %s\n", invocation.ToolVersion)
+		fmt.Printf("  current:  %s\n", toolVersionString())
+	}
+	if invocation.WorkingDirectory != "" {
+		if err := os.Chdir(invocation.WorkingDirectory); err != nil {
+			fmt.Printf("Can not change to recorded working directory [%s]: %v\n", invocation.WorkingDirectory, err)
+			return false
+		}
+	}
+	if !applyInvocationFlags(invocation) {
+		return false
+	}
+	replayOf = filepath.Dir(invocationDirectory)
+	return runmain(runCmd, []string{invocation.SampleSheetFile, invocation.ConfigFile})
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var reportUsageFormat string
+var reportUsageBy string
+var reportUsageOutput string
+
+// reportUsageCmd represents the report-usage command
+var reportUsageCmd = &cobra.Command{
+	Use:   "report-usage",
+	Short: "Report resource usage of samples from toil stats",
+	Long: `Report wall time, CPU time and peak memory of samples and CWL steps from toil stats.
+The latest successful execution of each sample is used. 'run' saves output of 'toil stats --raw'
+as toil.stats.json in jobManager directory when the execution is successfully finished,
+so the report can be created after jobStore is removed. If it is not saved, it is created from jobStore.
+  --by sample : usage of each sample
+  --by step   : usage of each CWL step of each sample
+  --by batch  : usage of each CWL step aggregated across samples
+'--by' is used for TSV. JSON contains all of them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !reportUsageMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportUsageCmd)
+
+	reportUsageCmd.Flags().StringVarP(&reportUsageFormat, "format", "", "tsv", "Output format, tsv or json")
+	reportUsageCmd.Flags().StringVarP(&reportUsageBy, "by", "", "batch", "Rows of TSV, sample, step or batch")
+	reportUsageCmd.Flags().StringVarP(&reportUsageOutput, "output", "o", "", "Output file. Default is stdout")
+}
+
+func reportUsageMain(args []string) bool {
+	if reportUsageFormat != "tsv" && reportUsageFormat != "json" {
+		fmt.Printf("Unknown format [%s]\n", reportUsageFormat)
+		return false
+	}
+	if reportUsageBy != "sample" && reportUsageBy != "step" && reportUsageBy != "batch" {
+		fmt.Printf("Unknown --by [%s]\n", reportUsageBy)
+		return false
+	}
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	report := utils.CollectUsageReport(rss.OutputDirectory.Path, &ss)
+	var w io.Writer = os.Stdout
+	if reportUsageOutput != "" {
+		f, err := os.Create(reportUsageOutput)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		defer f.Close()
+		w = f
+	}
+	if reportUsageFormat == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	} else {
+		writeUsageTsv(w, report, reportUsageBy)
+	}
+	if len(report.MissingSampleIds) > 0 {
+		fmt.Fprintf(os.Stderr, "%d samples have no usage: %s\n", len(report.MissingSampleIds), strings.Join(report.MissingSampleIds, ","))
+	}
+	return true
+}
+
+// peak memory is reported in MiB, to compare with --maxMemory and --defaultMemory
+func kibToMib(kib float64) string {
+	return fmt.Sprintf("%.1f", kib/1024)
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.1f", s)
+}
+
+func writeUsageTsv(w io.Writer, report *utils.UsageReport, by string) {
+	writeRow := func(columns ...string) {
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+	}
+	switch by {
+	case "sample":
+		writeRow("sample_id", "jobs", "wall_time_seconds", "cpu_time_seconds", "peak_memory_mib", "jobmanager_directory")
+		for _, sample := range report.Samples {
+			writeRow(sample.SampleId, fmt.Sprint(sample.Jobs), seconds(sample.WallTimeSeconds), seconds(sample.CpuTimeSeconds), kibToMib(sample.PeakMemoryKiB), sample.JobManagerDirectory)
+		}
+	case "step":
+		writeRow("sample_id", "step", "jobs", "wall_time_seconds", "cpu_time_seconds", "peak_memory_mib")
+		for _, sample := range report.Samples {
+			for _, step := range sample.Steps {
+				writeRow(sample.SampleId, step.Step, fmt.Sprint(step.Jobs), seconds(step.WallTimeSeconds), seconds(step.CpuTimeSeconds), kibToMib(step.PeakMemoryKiB))
+			}
+		}
+	default:
+		writeRow("step", "samples", "mean_wall_time_seconds", "max_wall_time_seconds", "mean_cpu_time_seconds", "max_cpu_time_seconds", "max_peak_memory_mib")
+		for _, step := range report.Steps {
+			writeRow(step.Step, fmt.Sprint(step.Samples), seconds(step.MeanWallTimeSeconds), seconds(step.MaxWallTimeSeconds), seconds(step.MeanCpuTimeSeconds), seconds(step.MaxCpuTimeSeconds), kibToMib(step.MaxPeakMemoryKiB))
+		}
+	}
+}
@@ -16,21 +16,40 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
-	"github.com/jinzhu/copier"
 	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
 	"github.com/spf13/cobra"
-	"golang.org/x/sync/errgroup"
+	"github.com/spf13/pflag"
 )
 
 //
 var dryrunFlag bool
 var fileExistsCheckFlag bool
 var fileHashCheckFlag bool
+var rerunStaleFlag bool
+var resumeFlag bool
+var cancelTimeout time.Duration
+var breakLockFlag bool
+var deepCheckFlag bool
+var watchFlag bool
+var watchInterval time.Duration
+var metricsListen string
+var diskSpaceCheck string
+
+// Values of --disk-space-check
+const (
+	diskSpaceCheckRefuse = "refuse"
+	diskSpaceCheckWarn   = "warn"
+	diskSpaceCheckNone   = "none"
+)
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
@@ -38,9 +57,22 @@ var runCmd = &cobra.Command{
 	Short: "Run workflow",
 	Long: `Run workflow. When to actually to execute workflow, create output directory.
 	And stdout and sterr is redirected to output directory.
-	If '--dry-run' flag is set, it only display information do not create directory`,
+	If '--dry-run' flag is set, it only display information do not create directory
+	Output directory is locked while running, so other 'run' for the same output directory is refused.
+	If the lock is left by killed 'run' on other host, remove it by '--break-lock'.
+	Each sample is also claimed before execution, so same sample is not executed twice.
+	If '--watch' flag is set, sample sheet is loaded again every '--watch-interval',
+	and new samples are launched until interrupted. Status is written to jobmanager.watch-status.json in output directory.
+	If '--metrics-listen' is set, status and Prometheus metrics are served by HTTP as 'serve-status' while running.
+	Metrics also include jobmanager_checksum_bytes_total, bytes of input files verified by md5 in this process.
+	Sample sheet, config file, flags, recognized environment and version are recorded in
+	jobManager/<currentTime>/invocation of output directory, and can be executed again by 'replay'.
+	Before execution, disk space used by samples is estimated from FASTQ size and 'disk_space' in config file,
+	and free space of output and jobStore is checked. Container cache is also checked if some images are not cached yet. See '--disk-space-check'.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		runmain(args)
+		if !runmain(cmd, args) {
+			os.Exit(1)
+		}
 	},
 }
 
@@ -58,6 +90,15 @@ func init() {
 	runCmd.Flags().BoolVarP(&dryrunFlag, "dry-run", "n", false, "Dry-run, do not execute acutal command")
 	runCmd.Flags().BoolVarP(&fileExistsCheckFlag, "file-exists-check", "", true, "Check file exists")
 	runCmd.Flags().BoolVarP(&fileHashCheckFlag, "file-hash-check", "", true, "Check file hash value")
+	runCmd.Flags().BoolVarP(&resumeFlag, "resume", "", false, "Restart failed samples from jobStore of the last execution")
+	runCmd.Flags().DurationVarP(&cancelTimeout, "cancel-timeout", "", 2*time.Minute, "Wait time for running samples to stop after SIGINT/SIGTERM, then they are killed")
+	runCmd.Flags().BoolVarP(&rerunStaleFlag, "rerun-stale", "", false, "Execute again samples whose results are created from different inputs")
+	runCmd.Flags().BoolVarP(&watchFlag, "watch", "", false, "Keep running, and launch samples appended to sample sheet")
+	runCmd.Flags().DurationVarP(&watchInterval, "watch-interval", "", 5*time.Minute, "Interval to load sample sheet in watch mode")
+	runCmd.Flags().StringVarP(&metricsListen, "metrics-listen", "", "", "Address to serve status and Prometheus metrics, e.g. 127.0.0.1:9100")
+	runCmd.Flags().BoolVarP(&breakLockFlag, "break-lock", "", false, "Remove lock of output directory held by other 'run'")
+	runCmd.Flags().StringVarP(&diskSpaceCheck, "disk-space-check", "", diskSpaceCheckRefuse, "Action when estimated disk space is insufficient: refuse, warn or none")
+	runCmd.Flags().BoolVarP(&deepCheckFlag, "deep-check", "", false, "Check contents of result files, such as BGZF EOF, CRAM EOF, index timestamp and errors in .log files")
 
 }
 func copyFiles(outputDirectoryPath string, samplesheet_data_file string, config_data_file string) bool {
@@ -124,13 +165,25 @@ func createDirectory(outputDirectoryPath string) bool {
 }
 
 func checkSampleSheet(ss *utils.SimpleSchema) bool {
-	if !utils.CheckSampleSheetFiles(ss, fileExistsCheckFlag, fileHashCheckFlag, displayMeesage) {
+	if !utils.CheckSampleSheetFiles(os.Stdout, ss, fileExistsCheckFlag, fileHashCheckFlag, displayMeesage) {
 		fmt.Println("Some files in sample sheet are missing.")
 		return false
 	}
 	return true
 }
 func checkConfigFile(rss *utils.ReferenceSchema) bool {
+	if err := utils.GetRetryPolicy(rss).Validate(); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if err := utils.ValidateNotificationHooks(rss.Notifications); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if _, err := utils.LoadFailureRules(rss); err != nil {
+		fmt.Println(err)
+		return false
+	}
 	secondaryFilesCheck, _ := utils.CheckSecondaryFilesExists(rss.Reference.Path)
 	if !secondaryFilesCheck {
 		fmt.Println("Some secondary file is missing")
@@ -150,20 +203,111 @@ func checkConfigFile(rss *utils.ReferenceSchema) bool {
 		fmt.Println("Some files for workflow execution are missing.")
 		return false
 	}
+	// images which are not cached are pulled while running, so they are not error
+	if _, missing, err := missingCachedImages(rss); err != nil {
+		fmt.Println(err)
+	} else if len(missing) > 0 {
+		for _, image := range missing {
+			fmt.Printf("Container image [%s] is not cached in [%s]\n", image, rss.ContainerCacheDirectory.Path)
+		}
+		fmt.Println("To cache them, use `pull-container-images --singularity`")
+	}
 	return true
 }
-func runmain(args []string) {
+
+/*
+ * Images required by the workflow, and images not cached as Singularity image in container_cache_directory.
+ */
+func missingCachedImages(rss *utils.ReferenceSchema) ([]string, []string, error) {
+	images, err := utils.DiscoverDockerImages(utils.WorkflowDirectory(rss.WorkflowFile.Path))
+	if err != nil {
+		return nil, nil, err
+	}
+	return images, utils.MissingCachedImages(rss.ContainerCacheDirectory.Path, images, utils.ContainerImageFormatSingularity), nil
+}
+/*
+ * Samples which will be executed, without results or with stale results if --rerun-stale is set.
+ */
+func pendingSamples(outputDirectoryPath string) []*utils.Sample {
+	result := []*utils.Sample{}
+	for _, s := range ss.SampleList {
+		if !utils.CheckAllResultFiles(outputDirectoryPath, s) || rerunStaleFlag && utils.IsStaleResult(outputDirectoryPath, s, &rss, toolVersionString()) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+/*
+ * Display disk space estimation of the samples.
+ * Return value: false if space is insufficient and --disk-space-check is refuse.
+ */
+func checkDiskSpace(samples []*utils.Sample) bool {
+	if diskSpaceCheck == diskSpaceCheckNone {
+		return true
+	}
+	report := utils.CheckDiskSpace(&rss, samples)
+	utils.DisplayDiskSpaceReport(report)
+	if report.Sufficient || dryrunFlag {
+		return true
+	}
+	if diskSpaceCheck == diskSpaceCheckWarn {
+		fmt.Println("Samples may fail by insufficient disk space.")
+		return true
+	}
+	fmt.Println("Refuse to run. Free disk space, or use --disk-space-check=warn to run anyway.")
+	return false
+}
+
+/*
+ * Resolved values of all flags of `run`, recorded in invocation.
+ */
+func runFlagValues(cmd *cobra.Command) map[string]string {
+	flags := map[string]string{}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name != "help" {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	return flags
+}
+
+/*
+ * Execute `run`.
+ * Return value: false if it stops before execution, e.g. sample sheet, config file or environment has problem.
+ * Failure of samples is not included. See status by `show-job-progress`.
+ */
+func runmain(cmd *cobra.Command, args []string) bool {
+	if !contains([]string{diskSpaceCheckRefuse, diskSpaceCheckWarn, diskSpaceCheckNone}, diskSpaceCheck) {
+		fmt.Printf("Invalid --disk-space-check [%s]. refuse, warn or none\n", diskSpaceCheck)
+		return false
+	}
 	loadSampleSheetAndConfigFile(args)
 	// check in sample sheet data
 	if !checkSampleSheet(&ss) {
-		return
+		return false
 	}
 	// check in config data
 	if !checkConfigFile(&rss) {
-		return
+		return false
+	}
+	// check free space before anything is written
+	if !checkDiskSpace(pendingSamples(rss.OutputDirectory.Path)) {
+		return false
 	}
 	// Get Current Time for output directory
 	currentTime := utils.GetCurrentTime()
+	// Lock output directory before anything is written in it
+	if !dryrunFlag {
+		if !createDirectory(rss.OutputDirectory.Path) {
+			return false
+		}
+		if err := utils.AcquireOutputDirectoryLock(rss.OutputDirectory.Path, breakLockFlag); err != nil {
+			fmt.Println(err)
+			return false
+		}
+		defer utils.ReleaseOutputDirectoryLock(rss.OutputDirectory.Path)
+	}
 	// Create JobManager Top level directory
 	// Setup stdout and stderr to Console and Files (JobManager Top Level Directory).
 	if !dryrunFlag {
@@ -173,7 +317,7 @@ func runmain(args []string) {
 		if err := os.MkdirAll(jobManagerTopDirectory, 0755); err != nil {
 			fmt.Println(err)
 			fmt.Println("cannot create JobManager Top Directory")
-			return
+			return false
 		}
 		// for jobmanager log files
 		// Setup log files
@@ -187,6 +331,14 @@ func runmain(args []string) {
 		fmt.Print(utils.BuildVersionString(Version, Revision, Date))
 		// Display JobManager Top Directory
 		fmt.Println("JobManager Top Directory: " + jobManagerTopDirectory)
+		// Record this invocation for `replay`
+		invocation := utils.NewInvocation(toolVersionString(), args[0], args[1], runFlagValues(cmd), utils.CollectEnvironmentReport(&rss))
+		invocation.ReplayOf = replayOf
+		if err := utils.WriteInvocation(jobManagerTopDirectory, invocation, args[0], args[1]); err != nil {
+			fmt.Println(err)
+			fmt.Println("Can not record invocation")
+			return false
+		}
 	} else {
 		// Display Version
 		fmt.Print(utils.BuildVersionString(Version, Revision, Date))
@@ -201,13 +353,13 @@ func runmain(args []string) {
 		if !foundToilCWLRunner {
 			fmt.Println("toil-cwl-runner not found, so can not execute anything.")
 			fmt.Println("To ckeck execution environment using `display-jobmanager-recognition`")
-			return
+			return false
 		}
 		// create output directory
 		isDirecotryCreate := createDirectory(outputDirectoryPath)
 		if !isDirecotryCreate {
 			fmt.Println("Can not create output direcoty")
-			os.Exit(1)
+			return false
 		}
 		//
 		samplesheet_data_file := args[0]
@@ -216,43 +368,82 @@ func runmain(args []string) {
 		isCopyFiles := copyFiles(outputDirectoryPath, samplesheet_data_file, config_data_file)
 		if !isCopyFiles {
 			fmt.Println("Can not copy files to output direcoty")
-			os.Exit(1)
+			return false
 		}
 		// Generate sample id list
 		utils.GenerateSampleList(&ss, &rss)
 	}
 
 	// exec and wait
-	var eg errgroup.Group
-	executeCount := 0
-	for i, s := range ss.SampleList {
-		// sample id has something missing. sample id executes
-		isExecute := !utils.CheckAllResultFiles(outputDirectoryPath, s)
-		if isExecute {
-			executeCount += 1
-			fmt.Printf("index: %d, SampleId: %s will be Execute new.\n", i, s.SampleId)
-			if !dryrunFlag {
-				// TODO exec real
-				// check toil-cwl-runner is exists or not
-				if foundToilCWLRunner {
-					// only exec when toil-cwl-runner is found
-					var sampleForExecCWL utils.Sample
-					copier.Copy(&sampleForExecCWL, &s)
-					eg.Go(func() error {
-						utils.ExecCWL(&sampleForExecCWL, &rss, currentTime)
-						return nil
-					})
-				}
-			}
-		}
+	execOptions := utils.ExecOptions{
+		ToolVersion:   toolVersionString(),
+		Resume:        resumeFlag,
+		CancelTimeout: cancelTimeout,
+		Summary: func() *utils.NotificationSummary {
+			return collectNotificationSummary(outputDirectoryPath)
+		},
+		DeepCheck: deepCheckFlag,
+	}
+	ctx, stopSignalHandler := handleCancelSignals()
+	defer stopSignalHandler()
+	launcher := newSampleLauncher(ctx, outputDirectoryPath, &execOptions, foundToilCWLRunner)
+	if !dryrunFlag && metricsListen != "" {
+		startStatusServer(metricsListen, func() *utils.StatusReport {
+			return utils.CollectStatusReport(outputDirectoryPath, snapshotSampleSheet(), &rss, toolVersionString(), serveStatusLogTailLines)
+		})
 	}
+	executeCount := launcher.launchSamples(ss.SampleList, 0, currentTime)
 	if dryrunFlag {
 		fmt.Printf("[%d/%d] task will be executed.\n", executeCount, len(ss.SampleList))
+	} else if watchFlag {
+		fmt.Printf("Watch [%s] every %s. To stop, send SIGINT or SIGTERM\n", args[0], watchInterval)
+		watchSampleSheet(launcher, args[0], args[1])
 	}
-	if err := eg.Wait(); err != nil {
+	if err := launcher.eg.Wait(); err != nil {
 		fmt.Println(err)
 	}
+	if !dryrunFlag && len(rss.Notifications) > 0 {
+		utils.Notify(&rss, utils.NewBatchNotificationEvent(outputDirectoryPath, collectNotificationSummary(outputDirectoryPath)))
+	}
 
 	fmt.Println("fin")
+	return true
+}
+
+/*
+ * Counts of samples in loaded sample sheet, for notification.
+ */
+func collectNotificationSummary(outputDirectoryPath string) *utils.NotificationSummary {
+	return utils.NewNotificationSummary(utils.CollectStatusReport(outputDirectoryPath, snapshotSampleSheet(), &rss, toolVersionString(), 0))
+}
 
+/*
+ * Handle SIGINT and SIGTERM while samples are running.
+ *   first signal: returned context is cancelled. new samples are not started and
+ *                 running toil-cwl-runner receive SIGTERM.
+ *   second signal: running toil-cwl-runner and their children are killed.
+ */
+func handleCancelSignals() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signalChannel := make(chan os.Signal, 2)
+	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		received := 0
+		for sig := range signalChannel {
+			received += 1
+			if received == 1 {
+				fmt.Printf("Received %s. Stop launching new samples and stop running samples.\n", sig)
+				fmt.Println("To kill running samples immediately, send signal again.")
+				cancel()
+			} else {
+				fmt.Printf("Received %s again. Kill running samples.\n", sig)
+				utils.KillRunningProcessGroups()
+			}
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signalChannel)
+		close(signalChannel)
+		cancel()
+	}
 }
@@ -0,0 +1,248 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/copier"
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"golang.org/x/sync/errgroup"
+)
+
+// ss.SampleList is appended in watch mode while status server reads it
+var sampleListMutex sync.RWMutex
+
+/*
+ * Return copy of loaded sample sheet.
+ */
+func snapshotSampleSheet() *utils.SimpleSchema {
+	sampleListMutex.RLock()
+	defer sampleListMutex.RUnlock()
+	return &utils.SimpleSchema{Name: ss.Name, SampleList: append([]*utils.Sample{}, ss.SampleList...)}
+}
+
+/*
+ * Launch samples of `run` and track them.
+ * Launched sample is not launched again by the same `run`, even if it is failed,
+ * so failed sample in watch mode is not executed forever. Retry is done by retry policy.
+ */
+type sampleLauncher struct {
+	ctx                 context.Context
+	eg                  errgroup.Group
+	outputDirectoryPath string
+	execOptions         *utils.ExecOptions
+	foundToilCWLRunner  bool
+
+	mutex    sync.Mutex
+	launched map[string]bool
+	running  map[string]bool
+	failed   map[string]bool
+}
+
+func newSampleLauncher(ctx context.Context, outputDirectoryPath string, execOptions *utils.ExecOptions, foundToilCWLRunner bool) *sampleLauncher {
+	return &sampleLauncher{
+		ctx:                 ctx,
+		outputDirectoryPath: outputDirectoryPath,
+		execOptions:         execOptions,
+		foundToilCWLRunner:  foundToilCWLRunner,
+		launched:            map[string]bool{},
+		running:             map[string]bool{},
+		failed:              map[string]bool{},
+	}
+}
+
+/*
+ * Launch samples whose results are missing.
+ * firstIndex is index of sampleList[0] in sample sheet, used in messages.
+ * Return value: number of samples to be executed.
+ */
+func (l *sampleLauncher) launchSamples(sampleList []*utils.Sample, firstIndex int, currentTime string) int {
+	executeCount := 0
+	for j, s := range sampleList {
+		i := firstIndex + j
+		if l.isLaunched(s.SampleId) {
+			continue
+		}
+		// sample id has something missing. sample id executes
+		isExecute := !utils.CheckResultFiles(l.outputDirectoryPath, s, l.execOptions.DeepCheck)
+		if !isExecute && utils.IsStaleResult(l.outputDirectoryPath, s, &rss, toolVersionString()) {
+			// results are exists, but workflow, config or inputs are changed after execution
+			if rerunStaleFlag {
+				isExecute = true
+			} else {
+				fmt.Printf("index: %d, SampleId: %s is stale. To execute again, use --rerun-stale\n", i, s.SampleId)
+			}
+		}
+		if isExecute && !dryrunFlag && l.foundToilCWLRunner {
+			// other `run` may execute this sample, e.g. lock is broken
+			claimed, owner, err := utils.ClaimSample(l.outputDirectoryPath, s.SampleId)
+			if err != nil {
+				fmt.Println(err)
+				isExecute = false
+			} else if !claimed {
+				fmt.Printf("index: %d, SampleId: %s is claimed by %s. skip\n", i, s.SampleId, owner)
+				isExecute = false
+			}
+		}
+		if isExecute {
+			executeCount += 1
+			fmt.Printf("index: %d, SampleId: %s will be Execute new.\n", i, s.SampleId)
+			if !dryrunFlag {
+				// check toil-cwl-runner is exists or not
+				if l.foundToilCWLRunner {
+					// only exec when toil-cwl-runner is found
+					var sampleForExecCWL utils.Sample
+					copier.Copy(&sampleForExecCWL, s)
+					l.setLaunched(sampleForExecCWL.SampleId)
+					l.eg.Go(func() error {
+						defer utils.ReleaseSampleClaim(l.outputDirectoryPath, sampleForExecCWL.SampleId)
+						utils.ExecCWL(l.ctx, &sampleForExecCWL, &rss, currentTime, l.execOptions)
+						l.setFinished(sampleForExecCWL.SampleId, utils.CheckResultFiles(l.outputDirectoryPath, &sampleForExecCWL, l.execOptions.DeepCheck))
+						return nil
+					})
+				}
+			}
+		}
+	}
+	return executeCount
+}
+
+func (l *sampleLauncher) isLaunched(sampleId string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.launched[sampleId]
+}
+
+func (l *sampleLauncher) setLaunched(sampleId string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.launched[sampleId] = true
+	l.running[sampleId] = true
+}
+
+func (l *sampleLauncher) setFinished(sampleId string, succeeded bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.running, sampleId)
+	if !succeeded {
+		l.failed[sampleId] = true
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	result := []string{}
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+/*
+ * Update status of watch mode by launched samples and result files.
+ */
+func (l *sampleLauncher) updateWatchStatus(status *utils.WatchStatus, sampleList []*utils.Sample, invalidSampleIds map[string]bool) {
+	l.mutex.Lock()
+	status.RunningSampleIds = sortedKeys(l.running)
+	status.FailedSampleIds = sortedKeys(l.failed)
+	l.mutex.Unlock()
+	status.InvalidSampleIds = sortedKeys(invalidSampleIds)
+	status.UpdatedAt = utils.GetCurrentTime()
+	status.Total = len(sampleList) + len(status.InvalidSampleIds)
+	status.Running = len(status.RunningSampleIds)
+	status.Failed = len(status.FailedSampleIds)
+	status.Finished = 0
+	for _, s := range sampleList {
+		// failed sample may have all result files, e.g. results are broken
+		if !contains(status.RunningSampleIds, s.SampleId) && !contains(status.FailedSampleIds, s.SampleId) && utils.CheckAllResultFiles(l.outputDirectoryPath, s) {
+			status.Finished += 1
+		}
+	}
+	status.Waiting = status.Total - status.Finished - status.Running - status.Failed
+	if err := utils.WriteWatchStatus(l.outputDirectoryPath, status); err != nil {
+		fmt.Println(err)
+	}
+}
+
+/*
+ * Watch mode of `run`.
+ * Sample sheet is loaded again every watchInterval, and new samples are validated and launched.
+ * New samples with invalid files are checked again next cycle, because their files may be still copied.
+ * Continue until ctx is cancelled by SIGINT/SIGTERM.
+ */
+func watchSampleSheet(l *sampleLauncher, samplesheet_data_file string, config_data_file string) {
+	hostname, _ := os.Hostname()
+	status := &utils.WatchStatus{
+		State:       "watching",
+		Hostname:    hostname,
+		Pid:         os.Getpid(),
+		SampleSheet: samplesheet_data_file,
+		StartedAt:   utils.GetCurrentTime(),
+		Cycle:       1,
+	}
+	knownSampleIds := map[string]bool{}
+	for _, s := range ss.SampleList {
+		knownSampleIds[s.SampleId] = true
+	}
+	invalidSampleIds := map[string]bool{}
+	for {
+		status.NextCheckAt = time.Now().Add(watchInterval).Format("20060102150405")
+		l.updateWatchStatus(status, ss.SampleList, invalidSampleIds)
+		select {
+		case <-l.ctx.Done():
+			status.State = "stopped"
+			status.NextCheckAt = ""
+			l.updateWatchStatus(status, ss.SampleList, invalidSampleIds)
+			return
+		case <-time.After(watchInterval):
+		}
+		status.Cycle += 1
+		reloaded, ok := reloadSampleSheet(samplesheet_data_file)
+		if !ok {
+			fmt.Printf("Can not load sample sheet [%s]. Check again after %s\n", samplesheet_data_file, watchInterval)
+			continue
+		}
+		newSamples := utils.FindNewSamples(reloaded, knownSampleIds)
+		acceptedSamples := []*utils.Sample{}
+		for _, s := range newSamples {
+			if !checkSampleSheet(&utils.SimpleSchema{Name: reloaded.Name, SampleList: []*utils.Sample{s}}) {
+				fmt.Printf("SampleId: %s is not valid yet. Check again after %s\n", s.SampleId, watchInterval)
+				invalidSampleIds[s.SampleId] = true
+				continue
+			}
+			delete(invalidSampleIds, s.SampleId)
+			knownSampleIds[s.SampleId] = true
+			acceptedSamples = append(acceptedSamples, s)
+		}
+		if len(acceptedSamples) == 0 {
+			continue
+		}
+		fmt.Printf("%d new samples are found in [%s]\n", len(acceptedSamples), samplesheet_data_file)
+		sampleListMutex.Lock()
+		firstIndex := len(ss.SampleList)
+		ss.SampleList = append(ss.SampleList, acceptedSamples...)
+		sampleListMutex.Unlock()
+		copyFiles(l.outputDirectoryPath, samplesheet_data_file, config_data_file)
+		utils.GenerateSampleList(&ss, &rss)
+		l.launchSamples(acceptedSamples, firstIndex, utils.GetCurrentTime())
+	}
+}
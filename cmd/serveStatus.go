@@ -0,0 +1,156 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+//go:embed serve_status.html
+var serveStatusTemplateText string
+
+var serveStatusListen string
+var serveStatusLogTailLines int
+var serveStatusRefresh time.Duration
+
+// serveStatusCmd represents the serve-status command
+var serveStatusCmd = &cobra.Command{
+	Use:   "serve-status",
+	Short: "Serve job progress by HTTP",
+	Long: `Serve job progress by HTTP, same as show-job-progress.
+  /            : HTML page
+  /api/status  : JSON. status, attempts, exit codes, durations and log tail of each sample
+  /metrics     : Prometheus metrics
+Sample sheet is loaded again for each request, so samples appended by 'run --watch' are shown.
+It listens on localhost by default. Use SSH port forwarding to see it from other host.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !serveStatusMain(args) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveStatusCmd)
+
+	serveStatusCmd.Flags().StringVarP(&serveStatusListen, "listen", "", "127.0.0.1:8080", "Address to listen")
+	serveStatusCmd.Flags().IntVarP(&serveStatusLogTailLines, "log-tail-lines", "", 20, "Number of lines of toil log shown for not finished samples")
+	serveStatusCmd.Flags().DurationVarP(&serveStatusRefresh, "refresh", "", time.Minute, "Reload interval of HTML page")
+}
+
+func serveStatusMain(args []string) bool {
+	if !loadSampleSheetAndConfigFile(args) {
+		return false
+	}
+	handler, err := newStatusHandler(func() *utils.StatusReport {
+		return collectStatusReport(args[0])
+	}, false)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	fmt.Printf("Serve status of [%s] at http://%s/\n", rss.OutputDirectory.Path, serveStatusListen)
+	if err := http.ListenAndServe(serveStatusListen, handler); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
+
+/*
+ * HTTP handler of status page, status API and metrics.
+ * Status report is created by collect for each request.
+ * checksumMetrics is true in `run`, because md5 is verified only in `run` process.
+ */
+func newStatusHandler(collect func() *utils.StatusReport, checksumMetrics bool) (http.Handler, error) {
+	page, err := template.New("status").Funcs(template.FuncMap{
+		"duration": func(seconds int64) string {
+			return (time.Duration(seconds) * time.Second).String()
+		},
+	}).Parse(serveStatusTemplateText)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		report := collect()
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		utils.WriteMetrics(w, collect())
+		if checksumMetrics {
+			utils.WriteChecksumMetrics(w)
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		report := collect()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := page.Execute(w, struct {
+			Report         *utils.StatusReport
+			RefreshSeconds int
+		}{report, int(serveStatusRefresh.Seconds())})
+		if err != nil {
+			fmt.Println(err)
+		}
+	})
+	return mux, nil
+}
+
+/*
+ * Serve status and metrics while `run` is running.
+ */
+func startStatusServer(listen string, collect func() *utils.StatusReport) {
+	handler, err := newStatusHandler(collect, true)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Serve status and metrics at http://%s/\n", listen)
+	go func() {
+		if err := http.ListenAndServe(listen, handler); err != nil {
+			fmt.Printf("Can not serve status and metrics: %v\n", err)
+		}
+	}()
+}
+
+/*
+ * Collect status with the latest sample sheet.
+ * If sample sheet can not be loaded now, e.g. it is being written, loaded sample sheet is used.
+ */
+func collectStatusReport(samplesheet_data_file string) *utils.StatusReport {
+	current := &ss
+	if reloaded, ok := reloadSampleSheet(samplesheet_data_file); ok {
+		current = reloaded
+	}
+	return utils.CollectStatusReport(rss.OutputDirectory.Path, current, &rss, toolVersionString(), serveStatusLogTailLines)
+}
@@ -49,6 +49,7 @@ func init() {
 	// showJobProgressCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	showJobProgressCmd.Flags().BoolVarP(&onlynew, "only-new", "", false, "Show newly execute sample id only")
 	showJobProgressCmd.Flags().BoolVarP(&onlyfinish, "only-finish", "", false, "Show finished sample id only")
+	showJobProgressCmd.Flags().BoolVarP(&deepCheckFlag, "deep-check", "", false, "Check contents of result files of finished samples")
 }
 func contains(sampleIdList []string, sampleId string) bool {
 	for _, v := range sampleIdList {
@@ -81,23 +82,44 @@ func showJobProgress(args []string) {
 	outputDirectoryPath := rss.OutputDirectory.Path
 	// Create Sample id list will be executed
 	execSampleIdList := utils.CreateExecuteSampleIDList(outputDirectoryPath, &ss)
+	if deepCheckFlag {
+		// results exist but they are broken, so they are executed again by `run --deep-check`
+		for _, s := range ss.SampleList {
+			if !contains(execSampleIdList, s.SampleId) && !utils.CheckResultFiles(outputDirectoryPath, s, true) {
+				fmt.Printf("%s has invalid result files.\n", s.SampleId)
+				execSampleIdList = append(execSampleIdList, s.SampleId)
+			}
+		}
+	}
+	// Finished samples whose results are created from different inputs
+	staleSampleIdList := utils.CreateStaleSampleIDList(outputDirectoryPath, &ss, &rss, execSampleIdList, toolVersionString())
 	if displayfinish {
 		//
 		for _, s := range ss.SampleList {
-			if !contains(execSampleIdList, s.SampleId) {
+			if contains(staleSampleIdList, s.SampleId) {
+				fmt.Printf("%s is stale.\n", s.SampleId)
+			} else if !contains(execSampleIdList, s.SampleId) {
 				fmt.Printf("%s is finished.\n", s.SampleId)
 			}
 		}
 	}
 	// TODO display execute information
 	DisplayJobInfo(outputDirectoryPath, execSampleIdList)
+	// running samples are not finished, but they are not executed new
+	runningSampleIdList := createRunningSampleIdList(outputDirectoryPath, execSampleIdList)
 	if displaynew {
 		for _, s := range execSampleIdList {
-			fmt.Printf("%s will be Execute new.\n", s)
+			if contains(runningSampleIdList, s) {
+				fmt.Printf("%s is running.\n", s)
+			} else {
+				fmt.Printf("%s will be Execute new.\n", s)
+			}
 		}
 
 	}
 	fmt.Printf("%d / %d SampleID are finished.\n", len(ss.SampleList)-len(execSampleIdList), len(ss.SampleList))
-	fmt.Printf("%d will be executed new.\n", len(execSampleIdList))
+	fmt.Printf("%d are running.\n", len(runningSampleIdList))
+	fmt.Printf("%d will be executed new.\n", len(execSampleIdList)-len(runningSampleIdList))
+	fmt.Printf("%d are stale. To execute again, use `run --rerun-stale`\n", len(staleSampleIdList))
 
 }
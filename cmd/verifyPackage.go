@@ -0,0 +1,72 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
+	"github.com/spf13/cobra"
+)
+
+var verifyPackageRoot string
+var verifyPackageSizeOnly bool
+
+// verifyPackageCmd represents the verify-package command
+var verifyPackageCmd = &cobra.Command{
+	Use:   "verify-package [manifest]",
+	Short: "Verify result files by manifest written by package",
+	Long: `Verify existence, size, md5 and sha256 of files in manifest written by package.
+Paths in manifest are relative to the directory of manifest, or '--root' if it is set.
+Exit status is 1 if any file is missing or not match.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !verifyPackageMain(args[0]) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyPackageCmd)
+
+	verifyPackageCmd.Flags().StringVarP(&verifyPackageRoot, "root", "", "", "Directory which paths in manifest are relative to")
+	verifyPackageCmd.Flags().BoolVarP(&verifyPackageSizeOnly, "size-only", "", false, "Check existence and size only, checksums are not computed")
+}
+
+func verifyPackageMain(manifestPath string) bool {
+	if !utils.IsExistsFile(manifestPath) {
+		fmt.Printf("Manifest [%s] is not found\n", manifestPath)
+		return false
+	}
+	entries, err := utils.ReadManifest(manifestPath)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	rootDirectoryPath := verifyPackageRoot
+	if rootDirectoryPath == "" {
+		rootDirectoryPath = filepath.Dir(manifestPath)
+	}
+	problems := utils.VerifyManifest(rootDirectoryPath, entries, !verifyPackageSizeOnly)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("%d / %d files are verified.\n", len(entries)-len(problems), len(entries))
+	return len(problems) == 0
+}
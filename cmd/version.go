@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/manabuishiii/jgaworkflowspecchecker/utils"
 	"github.com/spf13/cobra"
@@ -42,3 +43,8 @@ var versionCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(versionCmd)
 }
+
+// Version string without trailing newline. This is recorded in files created by JobManager.
+func toolVersionString() string {
+	return strings.TrimSpace(utils.BuildVersionString(Version, Revision, Date))
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File in job manager directory, contains jobStore path used by toil-cwl-runner.
+const JobStorePathFileName = "toil.jobstore.txt"
+
+/*
+ * List job manager directories of the sample.
+ * Each `run` creates outputDirectoryPath/jobManager/<currentTime>/<sampleId>.
+ * Return value: directories sorted by timestamp, the latest is first.
+ */
+func ListSampleAttemptDirectories(outputDirectoryPath string, sampleId string) []string {
+	result := []string{}
+	jobManagerExecutedFiles, err := ioutil.ReadDir(filepath.Join(outputDirectoryPath, "jobManager"))
+	if err != nil {
+		return result
+	}
+	SortByFileNameOrderDesc(jobManagerExecutedFiles)
+	for _, jobManagerTimestampDirectory := range jobManagerExecutedFiles {
+		if !jobManagerTimestampDirectory.IsDir() {
+			continue
+		}
+		sampleIdPath := filepath.Join(outputDirectoryPath, "jobManager", jobManagerTimestampDirectory.Name(), sampleId)
+		if fileinfo, err := os.Stat(sampleIdPath); err == nil && fileinfo.IsDir() {
+			result = append(result, sampleIdPath)
+		}
+	}
+	return result
+}
+
+/*
+ * Return first line of exitcode file. If file can not be read, return empty string.
+ */
+func GetExitCodeContent(exitcodeFilePath string) string {
+	exitCodeFile, err := os.Open(exitcodeFilePath)
+	if err != nil {
+		return ""
+	}
+	defer exitCodeFile.Close()
+	scanner := bufio.NewScanner(exitCodeFile)
+	scanner.Scan()
+	return scanner.Text()
+}
+
+/*
+ * Return jobStore path used at the job manager directory.
+ * Old version does not record jobStore path, in that case jobStore is under the directory.
+ */
+func GetAttemptJobStore(jobManagerDirectory string) string {
+	raw, err := ioutil.ReadFile(filepath.Join(jobManagerDirectory, JobStorePathFileName))
+	if err != nil || strings.TrimSpace(string(raw)) == "" {
+		return filepath.Join(jobManagerDirectory, "jobStore")
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+/*
+ * Check jobStore can be used by `toil-cwl-runner --restart`.
+ * toil file jobStore has config.pickle. (files/shared/config.pickle at recent toil)
+ */
+func IsUsableJobStore(jobStoreDir string) bool {
+	if fileinfo, err := os.Stat(jobStoreDir); err != nil || !fileinfo.IsDir() {
+		return false
+	}
+	for _, configFile := range []string{"files/shared/config.pickle", "config.pickle"} {
+		if IsExistsFile(filepath.Join(jobStoreDir, configFile)) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Find jobStore of the most recent failed execution of the sample.
+ * Execution at currentTime is this execution itself, so it is skipped.
+ * Return value: jobStore path, empty string if not found or not usable.
+ */
+func FindResumableJobStore(outputDirectoryPath string, sampleId string, currentTime string) string {
+	for _, attemptDirectory := range ListSampleAttemptDirectories(outputDirectoryPath, sampleId) {
+		if filepath.Base(filepath.Dir(attemptDirectory)) == currentTime {
+			continue
+		}
+		// exitcode 0 means the latest execution is successfully finished, nothing to restart.
+		// exitcode file is missing means execution is killed, so it is treated as fail.
+		if GetExitCodeContent(filepath.Join(attemptDirectory, "toil.exitcode.txt")) == "0" {
+			return ""
+		}
+		jobStoreDir := GetAttemptJobStore(attemptDirectory)
+		if !IsUsableJobStore(jobStoreDir) {
+			return ""
+		}
+		return jobStoreDir
+	}
+	return ""
+}
+
+/*
+ * Check toil stderr whether toil can not use the jobStore for restart.
+ */
+func IsJobStoreError(stderrFilePath string) bool {
+	raw, err := ioutil.ReadFile(stderrFilePath)
+	if err != nil {
+		return false
+	}
+	for _, message := range []string{"NoSuchJobStoreException", "nothing to restart"} {
+		if strings.Contains(string(raw), message) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// create outputDirectoryPath/jobManager/<timestamp>/<sampleId> with exitcode and jobStore
+func createTestAttempt(t *testing.T, outputDirectoryPath string, timestamp string, sampleId string, exitCode string, usableJobStore bool) string {
+	attemptDirectory := filepath.Join(outputDirectoryPath, "jobManager", timestamp, sampleId)
+	assert.NoError(t, os.MkdirAll(filepath.Join(attemptDirectory, "jobStore", "files", "shared"), 0755))
+	if exitCode != "" {
+		ioutil.WriteFile(filepath.Join(attemptDirectory, "toil.exitcode.txt"), []byte(exitCode+"\n"), 0644)
+	}
+	if usableJobStore {
+		ioutil.WriteFile(filepath.Join(attemptDirectory, "jobStore", "files", "shared", "config.pickle"), []byte("dummy"), 0644)
+	}
+	return attemptDirectory
+}
+
+func Test_ListSampleAttemptDirectories(t *testing.T) {
+	result := ListSampleAttemptDirectories("../test", "XX00001")
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "../test/jobManager/20211101145001/XX00001", result[0], "the latest is first")
+	assert.Equal(t, "../test/jobManager/20211101143242/XX00001", result[1])
+}
+
+func Test_ListSampleAttemptDirectories_no_jobManager(t *testing.T) {
+	result := ListSampleAttemptDirectories(t.TempDir(), "XX00001")
+	assert.Equal(t, 0, len(result), "never executed")
+}
+
+func Test_FindResumableJobStore_failed(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	createTestAttempt(t, outputDirectoryPath, "20211101140000", "XX00001", "1", true)
+	attemptDirectory := createTestAttempt(t, outputDirectoryPath, "20211101150000", "XX00001", "1", true)
+	result := FindResumableJobStore(outputDirectoryPath, "XX00001", "20211101160000")
+	assert.Equal(t, filepath.Join(attemptDirectory, "jobStore"), result, "the latest failed jobStore")
+}
+
+func Test_FindResumableJobStore_skip_current(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	attemptDirectory := createTestAttempt(t, outputDirectoryPath, "20211101140000", "XX00001", "1", true)
+	createTestAttempt(t, outputDirectoryPath, "20211101150000", "XX00001", "", false)
+	result := FindResumableJobStore(outputDirectoryPath, "XX00001", "20211101150000")
+	assert.Equal(t, filepath.Join(attemptDirectory, "jobStore"), result, "current execution is skipped")
+}
+
+func Test_FindResumableJobStore_recorded_jobstore(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	firstAttemptDirectory := createTestAttempt(t, outputDirectoryPath, "20211101140000", "XX00001", "1", true)
+	attemptDirectory := createTestAttempt(t, outputDirectoryPath, "20211101150000", "XX00001", "1", false)
+	ioutil.WriteFile(filepath.Join(attemptDirectory, JobStorePathFileName), []byte(filepath.Join(firstAttemptDirectory, "jobStore")+"\n"), 0644)
+	result := FindResumableJobStore(outputDirectoryPath, "XX00001", "20211101160000")
+	assert.Equal(t, filepath.Join(firstAttemptDirectory, "jobStore"), result, "restarted execution uses jobStore of first execution")
+}
+
+func Test_FindResumableJobStore_unusable(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	createTestAttempt(t, outputDirectoryPath, "20211101150000", "XX00001", "1", false)
+	result := FindResumableJobStore(outputDirectoryPath, "XX00001", "20211101160000")
+	assert.Equal(t, "", result, "jobStore does not have config")
+}
+
+func Test_FindResumableJobStore_success(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	createTestAttempt(t, outputDirectoryPath, "20211101140000", "XX00001", "1", true)
+	createTestAttempt(t, outputDirectoryPath, "20211101150000", "XX00001", "0", true)
+	result := FindResumableJobStore(outputDirectoryPath, "XX00001", "20211101160000")
+	assert.Equal(t, "", result, "the latest execution is successfully finished")
+}
+
+func Test_createToilCwlRunnerArguments_restart(t *testing.T) {
+	result := createToilCwlRunnerArguments("out/XX00001", "jm/XX00001", "old/XX00001/jobStore", "XX00001", "per-sample.cwl", true)
+	assert.Contains(t, result, "--restart")
+	assert.Contains(t, result, "old/XX00001/jobStore")
+	assert.Equal(t, "jm/XX00001/job-file.yaml", result[len(result)-1], "job file is last argument")
+}
+
+func Test_createToilCwlRunnerArguments_new(t *testing.T) {
+	result := createToilCwlRunnerArguments("out/XX00001", "jm/XX00001", "jm/XX00001/jobStore", "XX00001", "per-sample.cwl", false)
+	assert.NotContains(t, result, "--restart")
+	assert.Equal(t, "per-sample.cwl", result[len(result)-2], "workflow file is before job file")
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Default failure rules. Rules are checked in this order.
+//go:embed failure_rules.json
+var defaultFailureRulesBytes []byte
+
+// Categories which are not defined by failure rules.
+const (
+	FailureCategoryCancelled = "cancelled"
+	FailureCategoryUnknown   = "unknown"
+)
+
+/*
+ * Rule to classify failure by toil stderr and toil log file.
+ * `failure_rules` in config file are checked before default rules.
+ */
+type FailureRule struct {
+	Category    string   `json:"category"`
+	Description string   `json:"description"`
+	Hint        string   `json:"hint"`
+	Patterns    []string `json:"patterns"`
+
+	compiled []*regexp.Regexp
+}
+
+/*
+ * Result of failure analysis of an execution.
+ */
+type Diagnosis struct {
+	SampleId            string `json:"sample_id"`
+	JobManagerDirectory string `json:"jobmanager_directory"`
+	ExitCode            string `json:"exit_code"`
+	Category            string `json:"category"`
+	Description         string `json:"description"`
+	Hint                string `json:"hint"`
+	// first line matched the rule, and its location
+	MatchedLine     string `json:"matched_line"`
+	MatchedFile     string `json:"matched_file"`
+	MatchedLineNo   int    `json:"matched_line_no"`
+	FailingStep     string `json:"failing_step"`
+	FailingStepLine string `json:"failing_step_line"`
+}
+
+func (r *FailureRule) compile() error {
+	r.compiled = []*regexp.Regexp{}
+	for _, pattern := range r.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern [%s] of failure rule [%s]: %v", pattern, r.Category, err)
+		}
+		r.compiled = append(r.compiled, re)
+	}
+	return nil
+}
+
+func (r *FailureRule) match(line string) bool {
+	for _, re := range r.compiled {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Return failure rules in config file followed by default rules.
+ */
+func LoadFailureRules(rss *ReferenceSchema) ([]*FailureRule, error) {
+	rules := []*FailureRule{}
+	for i, rule := range rss.FailureRules {
+		if rule.Category == "" {
+			return nil, fmt.Errorf("failure_rules[%d] has no category", i)
+		}
+		userRule := *rule
+		rules = append(rules, &userRule)
+	}
+	var defaultRules []*FailureRule
+	if err := json.Unmarshal(defaultFailureRulesBytes, &defaultRules); err != nil {
+		return nil, err
+	}
+	rules = append(rules, defaultRules...)
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// Failing step messages of cwltool and toil
+var failingStepRes = []*regexp.Regexp{
+	// cwltool: [step bwa_mem] completed permanentFail
+	regexp.MustCompile(`\[(?:step|job|workflow) ([^\]\s]+)\] (?:completed )?permanentFail`),
+	// toil: 'file:///.../per-sample.cwl#bwa_mem' kind-CWLJob/instance-xxxx ... failed
+	regexp.MustCompile(`'[^'\s]*#([^'\s]+)' kind-\S+.*(?i:fail)`),
+	// toil: Job 'bwa_mem' kind-CWLJob/instance-xxxx ... failed
+	regexp.MustCompile(`(?i)job '([^'\s]+)' kind-\S+.*fail`),
+}
+
+func findFailingStep(line string) string {
+	for _, re := range failingStepRes {
+		if match := re.FindStringSubmatch(line); match != nil {
+			// step of sub workflow is written as workflow/step
+			return match[1]
+		}
+	}
+	return ""
+}
+
+/*
+ * Classify failure of the execution in the job manager directory.
+ * toil stderr and toil log file are scanned, and the first rule in order which matches any line is used.
+ * Failing CWL step is the first step reported as failed in toil log file or stderr.
+ */
+func DiagnoseAttempt(jobManagerDirectory string, sampleId string, rules []*FailureRule) *Diagnosis {
+	diagnosis := &Diagnosis{
+		SampleId:            sampleId,
+		JobManagerDirectory: jobManagerDirectory,
+		ExitCode:            GetExitCodeContent(filepath.Join(jobManagerDirectory, "toil.exitcode.txt")),
+		Category:            FailureCategoryUnknown,
+	}
+	matchedRuleIndex := len(rules)
+	for _, fn := range []string{createLogFilePath(jobManagerDirectory, sampleId), filepath.Join(jobManagerDirectory, "toil.stderr.txt")} {
+		f, err := os.Open(fn)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		lineNo := 0
+		for scanner.Scan() {
+			lineNo += 1
+			line := scanner.Text()
+			if diagnosis.FailingStep == "" {
+				if step := findFailingStep(line); step != "" {
+					diagnosis.FailingStep = step
+					diagnosis.FailingStepLine = strings.TrimSpace(line)
+				}
+			}
+			for i := 0; i < matchedRuleIndex; i++ {
+				if rules[i].match(line) {
+					matchedRuleIndex = i
+					diagnosis.MatchedLine = strings.TrimSpace(line)
+					diagnosis.MatchedFile = fn
+					diagnosis.MatchedLineNo = lineNo
+					break
+				}
+			}
+		}
+		f.Close()
+	}
+	if matchedRuleIndex < len(rules) {
+		rule := rules[matchedRuleIndex]
+		diagnosis.Category = rule.Category
+		diagnosis.Description = rule.Description
+		diagnosis.Hint = rule.Hint
+	}
+	if IsExistsFile(filepath.Join(jobManagerDirectory, CancelledFileName)) {
+		// cancelled execution fails by signal, so log messages are not the cause
+		diagnosis.Category = FailureCategoryCancelled
+		diagnosis.Description = "Execution is cancelled at " + GetExitCodeContent(filepath.Join(jobManagerDirectory, CancelledFileName))
+		diagnosis.Hint = "Execute run again, or run --resume to restart from jobStore"
+	}
+	return diagnosis
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestFailedAttempt(t *testing.T, stderr string, log string) string {
+	attemptDirectory := createTestAttempt(t, t.TempDir(), "20211101145001", "XX00001", "1", false)
+	os.MkdirAll(filepath.Join(attemptDirectory, "logs"), 0755)
+	ioutil.WriteFile(filepath.Join(attemptDirectory, "toil.stderr.txt"), []byte(stderr), 0644)
+	ioutil.WriteFile(createLogFilePath(attemptDirectory, "XX00001"), []byte(log), 0644)
+	return attemptDirectory
+}
+
+func Test_LoadFailureRules(t *testing.T) {
+	rss := &ReferenceSchema{FailureRules: []*FailureRule{{Category: "site_specific", Patterns: []string{"lustre"}}}}
+	rules, err := LoadFailureRules(rss)
+	assert.NoError(t, err)
+	assert.Equal(t, "site_specific", rules[0].Category, "user rules are checked first")
+	assert.True(t, len(rules) > 1)
+
+	_, err = LoadFailureRules(&ReferenceSchema{FailureRules: []*FailureRule{{Category: "broken", Patterns: []string{"("}}}})
+	assert.Error(t, err)
+	_, err = LoadFailureRules(&ReferenceSchema{FailureRules: []*FailureRule{{Patterns: []string{"x"}}}})
+	assert.Error(t, err, "category is required")
+}
+
+func Test_DiagnoseAttempt(t *testing.T) {
+	rules, _ := LoadFailureRules(&ReferenceSchema{})
+	for _, test := range []struct {
+		stderr   string
+		log      string
+		category string
+	}{
+		{"", "java.lang.OutOfMemoryError: Java heap space\n", "out_of_memory"},
+		{"OSError: [Errno 28] No space left on device\n", "", "disk_full"},
+		{"", "FATAL:   Unable to handle docker://broadinstitute/gatk:4.2 uri: failed to get checksum\n", "container_pull_failure"},
+		{"", "slurmstepd: error: *** JOB 1234 ON node01 CANCELLED AT 2021-11-01T14:50:01 DUE TO PREEMPTION ***\n", "slurm_preemption"},
+		{"", "Missing required secondary file 'ref.fa.fai'\n", "missing_secondary_files"},
+		{"Traceback\nsomething happened\n", "", FailureCategoryUnknown},
+	} {
+		attemptDirectory := createTestFailedAttempt(t, test.stderr, test.log)
+		diagnosis := DiagnoseAttempt(attemptDirectory, "XX00001", rules)
+		assert.Equal(t, test.category, diagnosis.Category, test.stderr+test.log)
+		assert.Equal(t, "1", diagnosis.ExitCode)
+	}
+}
+
+func Test_DiagnoseAttempt_rule_order(t *testing.T) {
+	rules, _ := LoadFailureRules(&ReferenceSchema{})
+	// disk full is found first, but out of memory rule has priority
+	attemptDirectory := createTestFailedAttempt(t, "", "No space left on device\nKilled: oom-kill event\n")
+	diagnosis := DiagnoseAttempt(attemptDirectory, "XX00001", rules)
+	assert.Equal(t, "out_of_memory", diagnosis.Category)
+	assert.Equal(t, 2, diagnosis.MatchedLineNo)
+	assert.Equal(t, createLogFilePath(attemptDirectory, "XX00001"), diagnosis.MatchedFile)
+}
+
+func Test_DiagnoseAttempt_failing_step(t *testing.T) {
+	rules, _ := LoadFailureRules(&ReferenceSchema{})
+	log := "INFO [step bwa_mem] start\n" +
+		"ERROR [step samtools_sort] completed permanentFail\n" +
+		"ERROR [step markdup] completed permanentFail\n"
+	diagnosis := DiagnoseAttempt(createTestFailedAttempt(t, "", log), "XX00001", rules)
+	assert.Equal(t, "samtools_sort", diagnosis.FailingStep)
+
+	stderr := "WARNING 'file:///work/per-sample.cwl#haplotypecaller' kind-CWLJob/instance-2l_8kq1a v1 failed with exit value 1\n"
+	diagnosis = DiagnoseAttempt(createTestFailedAttempt(t, stderr, ""), "XX00001", rules)
+	assert.Equal(t, "haplotypecaller", diagnosis.FailingStep)
+}
+
+func Test_DiagnoseAttempt_cancelled(t *testing.T) {
+	rules, _ := LoadFailureRules(&ReferenceSchema{})
+	attemptDirectory := createTestFailedAttempt(t, "", "Killed\n")
+	ioutil.WriteFile(filepath.Join(attemptDirectory, CancelledFileName), []byte("20211101145001\n"), 0644)
+	diagnosis := DiagnoseAttempt(attemptDirectory, "XX00001", rules)
+	assert.Equal(t, FailureCategoryCancelled, diagnosis.Category)
+}
@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+/*
+ * Multipliers to total FASTQ size of a sample, to estimate disk space used by the sample.
+ * Multiplier which is 0 is not counted.
+ */
+type DiskSpacePolicy struct {
+	// outputDirectoryPath/sampleId/runId.bam
+	BamMultiplier float64 `json:"bam_multiplier"`
+	// outputDirectoryPath/sampleId/sampleId.cram
+	CramMultiplier float64 `json:"cram_multiplier"`
+	// outputDirectoryPath/sampleId/sampleId.*.g.vcf.gz
+	GvcfMultiplier float64 `json:"gvcf_multiplier"`
+	// intermediate files in jobStore while running
+	JobStoreMultiplier float64 `json:"job_store_multiplier"`
+	// free space in container_cache_directory for container images which are not cached yet, not multiplied
+	ContainerCacheGb float64 `json:"container_cache_gb"`
+}
+
+/*
+ * Return disk space policy from config. If not specified, sizes for 30x WGS with gzipped FASTQ are used.
+ */
+func GetDiskSpacePolicy(rss *ReferenceSchema) *DiskSpacePolicy {
+	if rss.DiskSpace == nil {
+		return &DiskSpacePolicy{
+			BamMultiplier:      1.2,
+			CramMultiplier:     0.5,
+			GvcfMultiplier:     0.2,
+			JobStoreMultiplier: 3,
+			ContainerCacheGb:   20,
+		}
+	}
+	return rss.DiskSpace
+}
+
+type SampleDiskEstimate struct {
+	SampleId      string `json:"sample_id"`
+	FastqBytes    int64  `json:"fastq_bytes"`
+	BamBytes      int64  `json:"bam_bytes"`
+	CramBytes     int64  `json:"cram_bytes"`
+	GvcfBytes     int64  `json:"gvcf_bytes"`
+	JobStoreBytes int64  `json:"job_store_bytes"`
+}
+
+func (e *SampleDiskEstimate) OutputBytes() int64 {
+	return e.BamBytes + e.CramBytes + e.GvcfBytes
+}
+
+/*
+ * Required and available space of a file system.
+ * Usages are what use the file system, such as output, jobStore and container cache.
+ */
+type FilesystemSpace struct {
+	Paths          []string `json:"paths"`
+	Usages         []string `json:"usages"`
+	RequiredBytes  int64    `json:"required_bytes"`
+	AvailableBytes int64    `json:"available_bytes"`
+	Sufficient     bool     `json:"sufficient"`
+	ErrorMessage   string   `json:"error,omitempty"`
+}
+
+type DiskSpaceReport struct {
+	Samples     []SampleDiskEstimate `json:"samples"`
+	Filesystems []FilesystemSpace    `json:"filesystems"`
+	Sufficient  bool                 `json:"sufficient"`
+}
+
+/*
+ * Total size of FASTQ files of the sample. Missing file is not counted.
+ */
+func FastqBytes(s *Sample) int64 {
+	total := int64(0)
+	for _, r := range s.RunList {
+		for _, fn := range []string{r.FQ1, r.FQ2} {
+			if fn == "" {
+				continue
+			}
+			if fileinfo, err := os.Stat(fn); err == nil {
+				total += fileinfo.Size()
+			}
+		}
+	}
+	return total
+}
+
+func EstimateSampleDiskSpace(s *Sample, policy *DiskSpacePolicy) SampleDiskEstimate {
+	fastq := FastqBytes(s)
+	return SampleDiskEstimate{
+		SampleId:      s.SampleId,
+		FastqBytes:    fastq,
+		BamBytes:      int64(float64(fastq) * policy.BamMultiplier),
+		CramBytes:     int64(float64(fastq) * policy.CramMultiplier),
+		GvcfBytes:     int64(float64(fastq) * policy.GvcfMultiplier),
+		JobStoreBytes: int64(float64(fastq) * policy.JobStoreMultiplier),
+	}
+}
+
+/*
+ * Available space for unprivileged user and device of the file system of the path.
+ * If the path does not exist yet, its nearest existing parent is used.
+ */
+func AvailableDiskSpace(path string) (int64, uint64, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	for {
+		if _, err := os.Stat(abs); err == nil {
+			break
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			break
+		}
+		abs = parent
+	}
+	fileinfo, err := os.Stat(abs)
+	if err != nil {
+		return 0, 0, err
+	}
+	var statfs syscall.Statfs_t
+	if err := syscall.Statfs(abs, &statfs); err != nil {
+		return 0, 0, err
+	}
+	device := uint64(0)
+	if stat, ok := fileinfo.Sys().(*syscall.Stat_t); ok {
+		device = uint64(stat.Dev)
+	}
+	return int64(statfs.Bavail) * int64(statfs.Bsize), device, nil
+}
+
+/*
+ * Whether space in container_cache_directory is required, that is some images of the workflow are not cached yet.
+ * If images can not be discovered, such as remote workflow, space is required.
+ */
+func isContainerCacheSpaceRequired(rss *ReferenceSchema) bool {
+	if rss.WorkflowFile == nil {
+		return true
+	}
+	images, err := DiscoverDockerImages(WorkflowDirectory(rss.WorkflowFile.Path))
+	if err != nil {
+		return true
+	}
+	return len(MissingCachedImages(rss.ContainerCacheDirectory.Path, images, ContainerImageFormatSingularity)) > 0
+}
+
+type diskSpaceRequirement struct {
+	usage string
+	path  string
+	bytes int64
+}
+
+/*
+ * Estimate disk space used by the samples and check free space of output, jobStore and container cache.
+ * Space of container cache is required only if some images are not cached yet.
+ * Space of all samples is required at once, because samples are executed in parallel.
+ * Requirements on the same file system are summed up.
+ */
+func CheckDiskSpace(rss *ReferenceSchema, samples []*Sample) *DiskSpaceReport {
+	policy := GetDiskSpacePolicy(rss)
+	report := &DiskSpaceReport{Samples: []SampleDiskEstimate{}, Filesystems: []FilesystemSpace{}, Sufficient: true}
+	outputBytes := int64(0)
+	jobStoreBytes := int64(0)
+	for _, s := range samples {
+		estimate := EstimateSampleDiskSpace(s, policy)
+		outputBytes += estimate.OutputBytes()
+		jobStoreBytes += estimate.JobStoreBytes
+		report.Samples = append(report.Samples, estimate)
+	}
+	requirements := []diskSpaceRequirement{
+		{"output", rss.OutputDirectory.Path, outputBytes},
+		{"jobStore", filepath.Join(rss.OutputDirectory.Path, "jobManager"), jobStoreBytes},
+	}
+	if rss.ContainerCacheDirectory != nil && isContainerCacheSpaceRequired(rss) {
+		requirements = append(requirements, diskSpaceRequirement{"container cache", rss.ContainerCacheDirectory.Path, int64(policy.ContainerCacheGb * (1 << 30))})
+	}
+	devices := map[uint64]int{}
+	for _, requirement := range requirements {
+		available, device, err := AvailableDiskSpace(requirement.path)
+		if err != nil {
+			report.Filesystems = append(report.Filesystems, FilesystemSpace{
+				Paths:         []string{requirement.path},
+				Usages:        []string{requirement.usage},
+				RequiredBytes: requirement.bytes,
+				ErrorMessage:  err.Error(),
+			})
+			report.Sufficient = false
+			continue
+		}
+		i, ok := devices[device]
+		if !ok {
+			i = len(report.Filesystems)
+			devices[device] = i
+			report.Filesystems = append(report.Filesystems, FilesystemSpace{Paths: []string{}, Usages: []string{}, AvailableBytes: available})
+		}
+		fs := &report.Filesystems[i]
+		fs.Paths = append(fs.Paths, requirement.path)
+		fs.Usages = append(fs.Usages, requirement.usage)
+		fs.RequiredBytes += requirement.bytes
+	}
+	for i := range report.Filesystems {
+		fs := &report.Filesystems[i]
+		if fs.ErrorMessage != "" {
+			continue
+		}
+		fs.Sufficient = fs.AvailableBytes >= fs.RequiredBytes
+		report.Sufficient = report.Sufficient && fs.Sufficient
+	}
+	return report
+}
+
+/*
+ * Human readable size, such as 1.5 GiB.
+ */
+func FormatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit += 1
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", n, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+func DisplayDiskSpaceReport(report *DiskSpaceReport) {
+	fastqBytes := int64(0)
+	for _, estimate := range report.Samples {
+		fastqBytes += estimate.FastqBytes
+	}
+	fmt.Printf("Disk space for [%d] samples (FASTQ %s)\n", len(report.Samples), FormatBytes(fastqBytes))
+	for _, fs := range report.Filesystems {
+		for i := range fs.Paths {
+			fmt.Printf("  %s: [%s]\n", fs.Usages[i], fs.Paths[i])
+		}
+		if fs.ErrorMessage != "" {
+			fmt.Printf("    required: %s, available: unknown (%s)\n", FormatBytes(fs.RequiredBytes), fs.ErrorMessage)
+			continue
+		}
+		fmt.Printf("    required: %s, available: %s [%t]\n", FormatBytes(fs.RequiredBytes), FormatBytes(fs.AvailableBytes), fs.Sufficient)
+	}
+	if report.Sufficient {
+		fmt.Println("Disk space is sufficient.")
+	} else {
+		fmt.Println("Disk space is insufficient.")
+	}
+}
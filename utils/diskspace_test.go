@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EstimateSampleDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	fq1 := filepath.Join(dir, "run1_1.fq.gz")
+	fq2 := filepath.Join(dir, "run1_2.fq.gz")
+	ioutil.WriteFile(fq1, make([]byte, 600), 0644)
+	ioutil.WriteFile(fq2, make([]byte, 400), 0644)
+	s := &Sample{SampleId: "XX00000", RunList: []*Run{
+		{RunId: "run1", RunData: RunData{FQ1: fq1, FQ2: fq2}},
+		// missing file is not counted
+		{RunId: "run2", RunData: RunData{FQ1: filepath.Join(dir, "missing.fq.gz")}},
+	}}
+	estimate := EstimateSampleDiskSpace(s, &DiskSpacePolicy{BamMultiplier: 1.2, CramMultiplier: 0.5, GvcfMultiplier: 0.2, JobStoreMultiplier: 3})
+	assert.Equal(t, int64(1000), estimate.FastqBytes)
+	assert.Equal(t, int64(1200), estimate.BamBytes)
+	assert.Equal(t, int64(500), estimate.CramBytes)
+	assert.Equal(t, int64(200), estimate.GvcfBytes)
+	assert.Equal(t, int64(1900), estimate.OutputBytes())
+	assert.Equal(t, int64(3000), estimate.JobStoreBytes)
+}
+
+func Test_CheckDiskSpace(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	rss.WorkflowFile.Path = filepath.Join(createTestWorkflowDirectory(t), "Workflows", "per-sample.cwl")
+	rss.ContainerCacheDirectory.Path = filepath.Join(rss.OutputDirectory.Path, "cache")
+	rss.DiskSpace = &DiskSpacePolicy{BamMultiplier: 1, JobStoreMultiplier: 1}
+	report := CheckDiskSpace(rss, ss.SampleList)
+	assert.True(t, report.Sufficient)
+	assert.Equal(t, len(ss.SampleList), len(report.Samples))
+	// output, jobStore and container cache are on the same file system
+	assert.Equal(t, 1, len(report.Filesystems))
+	assert.Equal(t, []string{"output", "jobStore", "container cache"}, report.Filesystems[0].Usages)
+	fastqBytes := int64(0)
+	for _, estimate := range report.Samples {
+		fastqBytes += estimate.FastqBytes
+	}
+	assert.Equal(t, 2*fastqBytes, report.Filesystems[0].RequiredBytes)
+
+	rss.DiskSpace = &DiskSpacePolicy{ContainerCacheGb: 1 << 30}
+	report = CheckDiskSpace(rss, ss.SampleList)
+	assert.False(t, report.Sufficient)
+	assert.False(t, report.Filesystems[0].Sufficient)
+
+	// container cache is not required if all images are cached
+	cache := t.TempDir()
+	rss.ContainerCacheDirectory.Path = cache
+	images, err := DiscoverDockerImages(WorkflowDirectory(rss.WorkflowFile.Path))
+	assert.NoError(t, err)
+	for _, image := range images {
+		ioutil.WriteFile(filepath.Join(cache, CachedImageFileName(image, ContainerImageFormatSingularity)), []byte("dummy sif"), 0644)
+	}
+	report = CheckDiskSpace(rss, ss.SampleList)
+	assert.True(t, report.Sufficient)
+	assert.Equal(t, []string{"output", "jobStore"}, report.Filesystems[0].Usages)
+}
+
+func Test_GetDiskSpacePolicy(t *testing.T) {
+	rss := &ReferenceSchema{}
+	assert.Equal(t, 3.0, GetDiskSpacePolicy(rss).JobStoreMultiplier)
+	rss.DiskSpace = &DiskSpacePolicy{BamMultiplier: 2}
+	assert.Equal(t, 0.0, GetDiskSpacePolicy(rss).JobStoreMultiplier)
+}
+
+func Test_FormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", FormatBytes(512))
+	assert.Equal(t, "1.5 KiB", FormatBytes(1536))
+	assert.Equal(t, "2.0 GiB", FormatBytes(2<<30))
+}
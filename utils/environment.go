@@ -0,0 +1,341 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout of external commands to get versions and Slurm partitions
+const environmentCommandTimeout = 10 * time.Second
+
+/*
+ * External command used by jobmanager or workflow.
+ * Path is empty if the command is not found.
+ */
+type ToolInfo struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	Version      string `json:"version"`
+	ErrorMessage string `json:"error,omitempty"`
+}
+
+/*
+ * Slurm partition in `sinfo --summarize`.
+ */
+type SlurmPartition struct {
+	Name           string `json:"name"`
+	Default        bool   `json:"default"`
+	Available      bool   `json:"available"`
+	TimeLimit      string `json:"time_limit"`
+	AllocatedNodes int    `json:"allocated_nodes"`
+	IdleNodes      int    `json:"idle_nodes"`
+	OtherNodes     int    `json:"other_nodes"`
+	TotalNodes     int    `json:"total_nodes"`
+}
+
+/*
+ * Execution environment recognized by jobmanager.
+ */
+type EnvironmentReport struct {
+	WorkflowFileExists  bool             `json:"workflow_file_exists"`
+	ToilCWLRunnerExists bool             `json:"toil_cwl_runner_exists"`
+	InVirtualenv        bool             `json:"in_virtualenv"`
+	InPythonVirtualenv  bool             `json:"in_python_virtualenv"`
+	InCondaEnv          bool             `json:"in_conda_env"`
+	SbatchExists        bool             `json:"sbatch_exists"`
+	SingularityExists   bool             `json:"singularity_exists"`
+	Tools               []ToolInfo       `json:"tools,omitempty"`
+	SlurmPartitions     []SlurmPartition `json:"slurm_partitions,omitempty"`
+	SlurmErrorMessage   string           `json:"slurm_error,omitempty"`
+}
+
+/*
+ * Environment, files for execution and disk space, and whether `run` can execute samples.
+ */
+type ReadinessReport struct {
+	ToolVersion  string             `json:"tool_version"`
+	Environment  *EnvironmentReport `json:"environment"`
+	MissingFiles []string           `json:"missing_files"`
+	DiskSpace    *DiskSpaceReport   `json:"disk_space"`
+	// images in dockerPull of the workflow, and images not cached
+	RequiredImages []string `json:"required_images"`
+	MissingImages  []string `json:"missing_images"`
+	Ready          bool     `json:"ready"`
+	Problems       []string `json:"problems"`
+}
+
+// Run command with timeout, and return the first line of its output.
+func commandFirstLine(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), environmentCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0])
+	if err != nil {
+		if line != "" {
+			return "", fmt.Errorf("%v: %s", err, line)
+		}
+		return "", err
+	}
+	return line, nil
+}
+
+/*
+ * Path and version of the command. The first name found in PATH is used.
+ */
+func CollectToolInfo(names []string, versionArgs ...string) ToolInfo {
+	info := ToolInfo{Name: names[0]}
+	for _, name := range names {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			continue
+		}
+		info.Name = name
+		info.Path = path
+		if info.Version, err = commandFirstLine(path, versionArgs...); err != nil {
+			info.ErrorMessage = err.Error()
+		}
+		return info
+	}
+	info.ErrorMessage = fmt.Sprintf("%s is not found", strings.Join(names, " or "))
+	return info
+}
+
+/*
+ * Parse output of `sinfo --noheader --summarize --format=%P|%a|%l|%F`, such as
+ *   debug*|up|infinite|0/2/0/2
+ */
+func ParseSinfoSummary(out string) ([]SlurmPartition, error) {
+	partitions := []SlurmPartition{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid sinfo line [%s]", line)
+		}
+		nodes := strings.Split(fields[3], "/")
+		if len(nodes) != 4 {
+			return nil, fmt.Errorf("invalid node counts [%s]", fields[3])
+		}
+		counts := make([]int, 4)
+		for i, n := range nodes {
+			count, err := strconv.Atoi(n)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node counts [%s]", fields[3])
+			}
+			counts[i] = count
+		}
+		partitions = append(partitions, SlurmPartition{
+			Name:           strings.TrimSuffix(fields[0], "*"),
+			Default:        strings.HasSuffix(fields[0], "*"),
+			Available:      fields[1] == "up",
+			TimeLimit:      fields[2],
+			AllocatedNodes: counts[0],
+			IdleNodes:      counts[1],
+			OtherNodes:     counts[2],
+			TotalNodes:     counts[3],
+		})
+	}
+	return partitions, nil
+}
+
+/*
+ * Slurm partitions by sinfo.
+ */
+func CollectSlurmPartitions() ([]SlurmPartition, error) {
+	if _, err := exec.LookPath("sinfo"); err != nil {
+		return []SlurmPartition{}, fmt.Errorf("sinfo is not found")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), environmentCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "sinfo", "--noheader", "--summarize", "--format=%P|%a|%l|%F").Output()
+	if err != nil {
+		return []SlurmPartition{}, fmt.Errorf("sinfo failed: %v", err)
+	}
+	return ParseSinfoSummary(string(out))
+}
+
+/*
+ * Execution environment by checking commands in PATH and environment values.
+ * This is cheap, so `run` records it in each invocation.
+ * Versions and Slurm partitions are collected by CollectToolsAndPartitions.
+ */
+func CollectEnvironmentReport(rss *ReferenceSchema) *EnvironmentReport {
+	return &EnvironmentReport{
+		WorkflowFileExists:  IsExistsWorkflowFile(rss.WorkflowFile.Path),
+		ToilCWLRunnerExists: IsExistsToilCWLRunner(),
+		InVirtualenv:        IsInVirtualenv(),
+		InPythonVirtualenv:  IsInPythonVirtualenv(),
+		InCondaEnv:          IsInCondaEnv(),
+		SbatchExists:        IsExistsSbatch(),
+		SingularityExists:   IsExistsSingularity(),
+	}
+}
+
+/*
+ * Collect versions of tools and Slurm partitions by external commands.
+ * Commands are executed in parallel, so it takes environmentCommandTimeout at most.
+ */
+func (env *EnvironmentReport) CollectToolsAndPartitions() {
+	commands := []struct {
+		names []string
+		args  []string
+	}{
+		{[]string{"toil-cwl-runner"}, []string{"--version"}},
+		{[]string{"singularity"}, []string{"--version"}},
+		{[]string{"sbatch"}, []string{"--version"}},
+		{[]string{"python3", "python"}, []string{"--version"}},
+	}
+	env.Tools = make([]ToolInfo, len(commands))
+	var wg sync.WaitGroup
+	for i, command := range commands {
+		i, command := i, command
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			env.Tools[i] = CollectToolInfo(command.names, command.args...)
+		}()
+	}
+	partitions, err := CollectSlurmPartitions()
+	wg.Wait()
+	env.SlurmPartitions = partitions
+	if err != nil {
+		env.SlurmErrorMessage = err.Error()
+	}
+}
+
+/*
+ * Files which are required to execute workflow and missing.
+ * Same files are checked by CheckAndDisplayFilesForExecute, without display.
+ */
+func MissingFilesForExecute(rss *ReferenceSchema) []string {
+	missing := []string{}
+	if rss.WorkflowFile != nil && !IsExistsWorkflowFile(rss.WorkflowFile.Path) {
+		missing = append(missing, rss.WorkflowFile.Path)
+	}
+	files := []string{}
+	if rss.Reference != nil {
+		files = append(files, SecondaryFilePaths(rss.Reference.Path)...)
+	}
+	for _, fn := range files {
+		if !IsExistsFile(fn) {
+			missing = append(missing, fn)
+		}
+	}
+	for _, f := range RequiredFilesForExecute(rss) {
+		if f.Path == "" {
+			missing = append(missing, f.Name+" is not specified")
+		} else if !IsExistsFile(f.Path) {
+			missing = append(missing, f.Path)
+		}
+	}
+	return missing
+}
+
+/*
+ * Decide whether `run` can execute samples.
+ * toil-cwl-runner, singularity and sbatch are required, because samples are executed by Slurm with Singularity.
+ * diskSpace may be nil if samples are not known.
+ */
+func NewReadinessReport(toolVersion string, env *EnvironmentReport, missingFiles []string, diskSpace *DiskSpaceReport) *ReadinessReport {
+	report := &ReadinessReport{
+		ToolVersion:  toolVersion,
+		Environment:  env,
+		MissingFiles: missingFiles,
+		DiskSpace:    diskSpace,
+		Problems:     []string{},
+	}
+	addProblem := func(ok bool, problem string) {
+		if !ok {
+			report.AddProblem(problem)
+		}
+	}
+	addProblem(env.WorkflowFileExists, "workflow file is missing")
+	addProblem(env.ToilCWLRunnerExists, "toil-cwl-runner is not found")
+	addProblem(env.SingularityExists, "singularity is not found")
+	addProblem(env.SbatchExists, "sbatch is not found")
+	available := false
+	for _, p := range env.SlurmPartitions {
+		available = available || p.Available
+	}
+	if env.SlurmErrorMessage != "" {
+		addProblem(false, env.SlurmErrorMessage)
+	} else {
+		addProblem(available, "no Slurm partition is available")
+	}
+	addProblem(len(missingFiles) == 0, fmt.Sprintf("%d files for workflow execution are missing", len(missingFiles)))
+	if diskSpace != nil {
+		addProblem(diskSpace.Sufficient, "disk space is insufficient")
+	}
+	report.Ready = len(report.Problems) == 0
+	return report
+}
+
+func (r *ReadinessReport) SetCachedImages(images []string, missing []string) {
+	r.RequiredImages = images
+	r.MissingImages = missing
+	if len(missing) > 0 {
+		r.AddProblem(fmt.Sprintf("%d container images are not cached", len(missing)))
+	}
+}
+
+func (r *ReadinessReport) AddProblem(problem string) {
+	r.Problems = append(r.Problems, problem)
+	r.Ready = false
+}
+
+func DisplayJobManagerRecoginition(report *ReadinessReport) {
+	env := report.Environment
+	fmt.Printf("Workflow file is exists [%t]\n", env.WorkflowFileExists)
+	fmt.Printf("toil-cwl-runner is exists [%t]\n", env.ToilCWLRunnerExists)
+	fmt.Printf("Using Virtualenv if true set TOIL_CHECK_ENV=True [%t]\n", env.InVirtualenv)
+
+	fmt.Printf("  Using Python virtualenv [%t]\n", env.InPythonVirtualenv)
+	fmt.Printf("  Using Conda virtual env [%t]\n", env.InCondaEnv)
+	fmt.Printf("sbatch(slurm) is exists [%t]\n", env.SbatchExists)
+	fmt.Printf("singularity is exists [%t]\n", env.SingularityExists)
+	fmt.Println("Versions")
+	for _, tool := range env.Tools {
+		if tool.ErrorMessage != "" {
+			fmt.Printf("  %s: unknown (%s)\n", tool.Name, tool.ErrorMessage)
+		} else {
+			fmt.Printf("  %s: %s\n", tool.Name, tool.Version)
+		}
+	}
+	fmt.Println("Slurm partitions")
+	if env.SlurmErrorMessage != "" {
+		fmt.Printf("  unknown (%s)\n", env.SlurmErrorMessage)
+	}
+	for _, p := range env.SlurmPartitions {
+		fmt.Printf("  %s: available [%t] default [%t] time limit: %s nodes(allocated/idle/other/total): %d/%d/%d/%d\n",
+			p.Name, p.Available, p.Default, p.TimeLimit, p.AllocatedNodes, p.IdleNodes, p.OtherNodes, p.TotalNodes)
+	}
+	for _, fn := range report.MissingFiles {
+		fmt.Printf("Missing file [%s]\n", fn)
+	}
+	if len(report.MissingFiles) == 0 {
+		fmt.Println("All files for workflow Execution are found.")
+	} else {
+		fmt.Println("Some files for workflow Execution are missing.")
+	}
+	if report.RequiredImages != nil {
+		fmt.Printf("Container images [%d] cached [%d]\n", len(report.RequiredImages), len(report.RequiredImages)-len(report.MissingImages))
+		for _, image := range report.MissingImages {
+			fmt.Printf("  not cached: %s\n", image)
+		}
+	}
+	if report.DiskSpace != nil {
+		DisplayDiskSpaceReport(report.DiskSpace)
+	}
+	for _, problem := range report.Problems {
+		fmt.Printf("Problem: %s\n", problem)
+	}
+	fmt.Printf("Ready to run [%t]\n", report.Ready)
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseSinfoSummary(t *testing.T) {
+	partitions, err := ParseSinfoSummary("debug*|up|infinite|0/2/0/2\ngpu|down|1-00:00:00|1/0/3/4\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []SlurmPartition{
+		{Name: "debug", Default: true, Available: true, TimeLimit: "infinite", AllocatedNodes: 0, IdleNodes: 2, OtherNodes: 0, TotalNodes: 2},
+		{Name: "gpu", Default: false, Available: false, TimeLimit: "1-00:00:00", AllocatedNodes: 1, IdleNodes: 0, OtherNodes: 3, TotalNodes: 4},
+	}, partitions)
+
+	_, err = ParseSinfoSummary("debug*|up|infinite\n")
+	assert.Error(t, err)
+	_, err = ParseSinfoSummary("debug*|up|infinite|0/2/x/2\n")
+	assert.Error(t, err)
+}
+
+func Test_CollectToolInfo(t *testing.T) {
+	info := CollectToolInfo([]string{"nosuch-jobmanager-command", "sh"}, "-c", "echo 1.2.3; echo second line")
+	assert.Equal(t, "sh", info.Name)
+	assert.NotEmpty(t, info.Path)
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Empty(t, info.ErrorMessage)
+
+	info = CollectToolInfo([]string{"nosuch-jobmanager-command"}, "--version")
+	assert.Empty(t, info.Path)
+	assert.NotEmpty(t, info.ErrorMessage)
+}
+
+func Test_CollectToolsAndPartitions(t *testing.T) {
+	binDirectory := t.TempDir()
+	for _, name := range []string{"toil-cwl-runner", "singularity", "sbatch", "python3", "sinfo"} {
+		script := "#!/bin/sh\nsleep 1\necho " + name + " 1.0\n"
+		if name == "sinfo" {
+			script = "#!/bin/sh\nsleep 1\necho 'debug*|up|infinite|0/2/0/2'\n"
+		}
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(binDirectory, name), []byte(script), 0755))
+	}
+	t.Setenv("PATH", binDirectory+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, rss := loadTestSampleSheetAndConfigFile(t)
+	env := CollectEnvironmentReport(rss)
+	assert.Empty(t, env.Tools)
+	assert.Empty(t, env.SlurmPartitions)
+
+	// commands are executed in parallel
+	start := time.Now()
+	env.CollectToolsAndPartitions()
+	assert.Less(t, time.Since(start), 4*time.Second)
+	assert.Len(t, env.Tools, 4)
+	for _, tool := range env.Tools {
+		assert.Equal(t, tool.Name+" 1.0", tool.Version)
+	}
+	assert.Len(t, env.SlurmPartitions, 1)
+	assert.Empty(t, env.SlurmErrorMessage)
+}
+
+func Test_NewReadinessReport(t *testing.T) {
+	env := &EnvironmentReport{
+		WorkflowFileExists:  true,
+		ToilCWLRunnerExists: true,
+		SbatchExists:        true,
+		SingularityExists:   true,
+		SlurmPartitions:     []SlurmPartition{{Name: "debug", Available: false}, {Name: "main", Available: true}},
+	}
+	report := NewReadinessReport("Version: 1.0.0-abc (built at 2021-11-01)", env, []string{}, &DiskSpaceReport{Sufficient: true})
+	assert.True(t, report.Ready)
+	assert.Equal(t, []string{}, report.Problems)
+
+	report.AddProblem("sample sheet or config file is invalid")
+	assert.False(t, report.Ready)
+
+	env.SlurmPartitions = []SlurmPartition{{Name: "debug", Available: false}}
+	env.SingularityExists = false
+	report = NewReadinessReport("", env, []string{"/ref/case1.fasta.fai"}, &DiskSpaceReport{Sufficient: false})
+	assert.False(t, report.Ready)
+	assert.Equal(t, []string{
+		"singularity is not found",
+		"no Slurm partition is available",
+		"1 files for workflow execution are missing",
+		"disk space is insufficient",
+	}, report.Problems)
+}
+
+func Test_MissingFilesForExecute(t *testing.T) {
+	_, rss := loadTestSampleSheetAndConfigFile(t)
+	missing := MissingFilesForExecute(rss)
+	// workflow file is found, secondary files of reference are missing
+	assert.NotContains(t, missing, rss.WorkflowFile.Path)
+	assert.Contains(t, missing, rss.Reference.Path+".fai")
+
+	// same files as CheckOutputReference
+	rss.Dbsnp = &PathOnlyObject{Path: rss.Dbsnp.Path + ".missing"}
+	rss.Mills = nil
+	assert.False(t, CheckOutputReference(rss))
+	missing = MissingFilesForExecute(rss)
+	assert.Contains(t, missing, rss.Dbsnp.Path)
+	assert.Contains(t, missing, "mills is not specified")
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Fingerprint file name. Created in job manager directory and sample result directory.
+const FingerprintFileName = "jobmanager-fingerprint.json"
+
+/*
+ * Fingerprint records what produced the results of the sample.
+ * ToolVersion and CreatedAt are recorded for information only,
+ * they are not used to decide the results are stale.
+ */
+type Fingerprint struct {
+	JobFileDigest      string `json:"job_file_digest"`
+	FastqMd5Digest     string `json:"fastq_md5_digest"`
+	ReferenceDigest    string `json:"reference_digest"`
+	WorkflowFileDigest string `json:"workflow_file_digest"`
+	ToolVersion        string `json:"tool_version"`
+	CreatedAt          string `json:"created_at"`
+}
+
+func Sha256File(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func sha256String(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+ * Digest of workflow file.
+ * Path starts http:// or https:// , can not read file. so URL itself is used.
+ */
+func WorkflowFileDigest(workflowFilePath string) (string, error) {
+	if strings.HasPrefix(workflowFilePath, "http://") || strings.HasPrefix(workflowFilePath, "https://") {
+		return "url:" + workflowFilePath, nil
+	}
+	digest, err := Sha256File(workflowFilePath)
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + digest, nil
+}
+
+/*
+ * Digest of reference file.
+ * Reference file is too large to read every time, so path, size and modification time are used.
+ */
+func referenceDigest(referencePath string) string {
+	fileinfo, err := os.Stat(referencePath)
+	if err != nil {
+		return sha256String(referencePath)
+	}
+	return sha256String(fmt.Sprintf("%s\t%d\t%d", referencePath, fileinfo.Size(), fileinfo.ModTime().Unix()))
+}
+
+func fastqMd5Digest(s *Sample) string {
+	var builder strings.Builder
+	for _, r := range s.RunList {
+		builder.WriteString(fmt.Sprintf("%s\t%s\t%s\n", r.RunId, r.RunData.FQ1_MD5, r.RunData.FQ2_MD5))
+	}
+	return sha256String(builder.String())
+}
+
+func CreateFingerprint(s *Sample, rss *ReferenceSchema, toolVersion string) (*Fingerprint, error) {
+	workflowDigest, err := WorkflowFileDigest(rss.WorkflowFile.Path)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := Fingerprint{
+		JobFileDigest:      sha256String(CreateJobFileContent(s, rss)),
+		FastqMd5Digest:     fastqMd5Digest(s),
+		ReferenceDigest:    referenceDigest(rss.Reference.Path),
+		WorkflowFileDigest: workflowDigest,
+		ToolVersion:        toolVersion,
+		CreatedAt:          GetCurrentTime(),
+	}
+	return &fingerprint, nil
+}
+
+/*
+ * Return true when both fingerprint are created from same inputs.
+ */
+func (f *Fingerprint) IsSameInputs(other *Fingerprint) bool {
+	return f.JobFileDigest == other.JobFileDigest &&
+		f.FastqMd5Digest == other.FastqMd5Digest &&
+		f.ReferenceDigest == other.ReferenceDigest &&
+		f.WorkflowFileDigest == other.WorkflowFileDigest
+}
+
+func WriteFingerprint(filePath string, fingerprint *Fingerprint) error {
+	data, err := json.MarshalIndent(fingerprint, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filePath, data, 0644)
+}
+
+func ReadFingerprint(filePath string) (*Fingerprint, error) {
+	raw, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var fingerprint Fingerprint
+	if err := json.Unmarshal(raw, &fingerprint); err != nil {
+		return nil, err
+	}
+	return &fingerprint, nil
+}
+
+// outputDirectoryPath/sampleId/jobmanager-fingerprint.json
+func ResultFingerprintFilePath(outputDirectoryPath string, sampleId string) string {
+	return filepath.Join(outputDirectoryPath, sampleId, FingerprintFileName)
+}
+
+/*
+ * Check results of the sample are created from current inputs.
+ * Return value:
+ *   true: recorded fingerprint is different from current inputs
+ *   false: same inputs, or fingerprint is not recorded (results created by old version)
+ */
+func IsStaleResult(outputDirectoryPath string, s *Sample, rss *ReferenceSchema, toolVersion string) bool {
+	recorded, err := ReadFingerprint(ResultFingerprintFilePath(outputDirectoryPath, s.SampleId))
+	if err != nil {
+		return false
+	}
+	current, err := CreateFingerprint(s, rss, toolVersion)
+	if err != nil {
+		fmt.Printf("Can not create fingerprint SampleId[%s]: %v\n", s.SampleId, err)
+		return false
+	}
+	return !recorded.IsSameInputs(current)
+}
+
+/*
+ * Create stale sample id list.
+ * Samples in execSampleIdList are not finished, so they are not checked.
+ */
+func CreateStaleSampleIDList(outputDirectoryPath string, ss *SimpleSchema, rss *ReferenceSchema, execSampleIdList []string, toolVersion string) []string {
+	result := []string{}
+	for _, s := range ss.SampleList {
+		isNotFinished := false
+		for _, sampleId := range execSampleIdList {
+			if sampleId == s.SampleId {
+				isNotFinished = true
+				break
+			}
+		}
+		if isNotFinished {
+			continue
+		}
+		if IsStaleResult(outputDirectoryPath, s, rss, toolVersion) {
+			result = append(result, s.SampleId)
+		}
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTestSampleSheetAndConfigFile(t *testing.T) (*SimpleSchema, *ReferenceSchema) {
+	var ss SimpleSchema
+	var rss ReferenceSchema
+	raw, err := ioutil.ReadFile("../test/datafiles/samplesheet_2run-test.json")
+	assert.NoError(t, err, "read sample sheet")
+	assert.NoError(t, json.Unmarshal(raw, &ss), "parse sample sheet")
+	rraw, err := ioutil.ReadFile("../test/datafiles/configfile_1run-test.json")
+	assert.NoError(t, err, "read config file")
+	assert.NoError(t, json.Unmarshal(rraw, &rss), "parse config file")
+	rss.WorkflowFile.Path = "../test/samplefiles/dummy.workflow.cwl"
+	rss.OutputDirectory.Path = t.TempDir()
+	return &ss, &rss
+}
+
+func Test_WorkflowFileDigest_url(t *testing.T) {
+	result, err := WorkflowFileDigest("https://example.com/per-sample.cwl")
+	assert.NoError(t, err)
+	assert.Equal(t, "url:https://example.com/per-sample.cwl", result, "URL is used as digest")
+}
+
+func Test_WorkflowFileDigest_missing(t *testing.T) {
+	_, err := WorkflowFileDigest("../test/samplefiles/nosucha.workflow.cwl")
+	assert.Error(t, err, "Workflow file MUST be missing")
+}
+
+func Test_IsStaleResult_fingerprint_missing(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	result := IsStaleResult(rss.OutputDirectory.Path, ss.SampleList[0], rss, "dev")
+	assert.False(t, result, "Results without fingerprint are not stale")
+}
+
+func Test_IsStaleResult_same_inputs(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	s := ss.SampleList[0]
+	os.MkdirAll(filepath.Join(rss.OutputDirectory.Path, s.SampleId), 0755)
+	fingerprint, err := CreateFingerprint(s, rss, "dev")
+	assert.NoError(t, err)
+	WriteFingerprint(ResultFingerprintFilePath(rss.OutputDirectory.Path, s.SampleId), fingerprint)
+	// tool version is not used to decide stale
+	result := IsStaleResult(rss.OutputDirectory.Path, s, rss, "0.19.0")
+	assert.False(t, result, "Same inputs are not stale")
+}
+
+func Test_IsStaleResult_fastq_md5_changed(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	s := ss.SampleList[0]
+	os.MkdirAll(filepath.Join(rss.OutputDirectory.Path, s.SampleId), 0755)
+	fingerprint, _ := CreateFingerprint(s, rss, "dev")
+	WriteFingerprint(ResultFingerprintFilePath(rss.OutputDirectory.Path, s.SampleId), fingerprint)
+	s.RunList[0].RunData.FQ1_MD5 = "39a870a194a787550b6b5d1f49629236"
+	result := IsStaleResult(rss.OutputDirectory.Path, s, rss, "dev")
+	assert.True(t, result, "FASTQ md5 is changed")
+}
+
+func Test_IsStaleResult_config_changed(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	s := ss.SampleList[0]
+	os.MkdirAll(filepath.Join(rss.OutputDirectory.Path, s.SampleId), 0755)
+	fingerprint, _ := CreateFingerprint(s, rss, "dev")
+	WriteFingerprint(ResultFingerprintFilePath(rss.OutputDirectory.Path, s.SampleId), fingerprint)
+	rss.Cores = rss.Cores + 1
+	result := IsStaleResult(rss.OutputDirectory.Path, s, rss, "dev")
+	assert.True(t, result, "cores in config file is changed")
+}
+
+func Test_CreateStaleSampleIDList(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	for _, s := range ss.SampleList {
+		os.MkdirAll(filepath.Join(rss.OutputDirectory.Path, s.SampleId), 0755)
+		fingerprint, _ := CreateFingerprint(s, rss, "dev")
+		WriteFingerprint(ResultFingerprintFilePath(rss.OutputDirectory.Path, s.SampleId), fingerprint)
+	}
+	rss.WorkflowFile.Path = "../test/testfile.txt"
+	// second sample is not finished
+	result := CreateStaleSampleIDList(rss.OutputDirectory.Path, ss, rss, []string{ss.SampleList[1].SampleId}, "dev")
+	assert.Equal(t, []string{ss.SampleList[0].SampleId}, result, "workflow file is changed")
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Interval to update heartbeat in process file.
+const HeartbeatInterval = 30 * time.Second
+
+// Execution on other host is treated as running while heartbeat is newer than this.
+const HeartbeatTimeout = 3 * HeartbeatInterval
+
+/*
+ * Heartbeat of running execution.
+ * Process file is written when execution starts, and updated periodically until Stop.
+ */
+type attemptHeartbeat struct {
+	mutex               sync.Mutex
+	jobManagerDirectory string
+	record              ProcessRecord
+	stop                chan struct{}
+	stopped             sync.WaitGroup
+}
+
+func startHeartbeat(jobManagerDirectory string) *attemptHeartbeat {
+	hostname, _ := os.Hostname()
+	currentTime := GetCurrentTime()
+	h := &attemptHeartbeat{
+		jobManagerDirectory: jobManagerDirectory,
+		record: ProcessRecord{
+			Hostname:      hostname,
+			JobManagerPid: os.Getpid(),
+			StartedAt:     currentTime,
+			HeartbeatAt:   currentTime,
+		},
+		stop: make(chan struct{}),
+	}
+	h.write()
+	h.stopped.Add(1)
+	go func() {
+		defer h.stopped.Done()
+		ticker := time.NewTicker(HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+				h.mutex.Lock()
+				h.record.HeartbeatAt = GetCurrentTime()
+				h.mutex.Unlock()
+				h.write()
+			}
+		}
+	}()
+	return h
+}
+
+func (h *attemptHeartbeat) write() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	WriteProcessRecord(h.jobManagerDirectory, &h.record)
+}
+
+/*
+ * Record started toil-cwl-runner.
+ */
+func (h *attemptHeartbeat) setProcess(pid int, pgid int) {
+	h.mutex.Lock()
+	h.record.Pid = pid
+	h.record.Pgid = pgid
+	h.mutex.Unlock()
+	h.write()
+}
+
+func (h *attemptHeartbeat) Stop() {
+	close(h.stop)
+	h.stopped.Wait()
+}
+
+func parseCurrentTime(currentTime string) (time.Time, error) {
+	return time.ParseInLocation("20060102150405", currentTime, time.Local)
+}
+
+/*
+ * Check execution in the job manager directory is running.
+ * Heartbeat is checked, and on this host, process of JobManager or toil-cwl-runner is also checked.
+ * Heartbeat is required even on this host, because pid of crashed JobManager may be reused by other process.
+ * Return value: true if running, and process record if recorded.
+ */
+func IsAttemptRunning(jobManagerDirectory string) (bool, *ProcessRecord) {
+	if IsExistsFile(filepath.Join(jobManagerDirectory, "toil.exitcode.txt")) {
+		return false, nil
+	}
+	record, err := ReadProcessRecord(jobManagerDirectory)
+	if err != nil {
+		return false, nil
+	}
+	heartbeatAt, err := parseCurrentTime(record.HeartbeatAt)
+	if err != nil || time.Since(heartbeatAt) >= HeartbeatTimeout {
+		return false, record
+	}
+	hostname, _ := os.Hostname()
+	if record.Hostname == hostname {
+		if record.JobManagerPid > 0 && isProcessAlive(record.JobManagerPid) {
+			return true, record
+		}
+		if record.Pgid > 0 && IsProcessGroupAlive(record.Pgid) {
+			return true, record
+		}
+		return false, record
+	}
+	return true, record
+}
+
+func isProcessAlive(pid int) bool {
+	err := syscall.Kill(pid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+/*
+ * Elapsed time from start of the execution.
+ */
+func (r *ProcessRecord) Elapsed() time.Duration {
+	startedAt, err := parseCurrentTime(r.StartedAt)
+	if err != nil {
+		return 0
+	}
+	return time.Since(startedAt).Truncate(time.Second)
+}
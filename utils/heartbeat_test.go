@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_startHeartbeat(t *testing.T) {
+	jobManagerDirectory := t.TempDir()
+	heartbeat := startHeartbeat(jobManagerDirectory)
+	heartbeat.setProcess(123, 123)
+	heartbeat.Stop()
+	record, err := ReadProcessRecord(jobManagerDirectory)
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getpid(), record.JobManagerPid)
+	assert.Equal(t, 123, record.Pid)
+	assert.NotEqual(t, "", record.StartedAt)
+}
+
+func Test_IsAttemptRunning_this_process(t *testing.T) {
+	jobManagerDirectory := t.TempDir()
+	hostname, _ := os.Hostname()
+	WriteProcessRecord(jobManagerDirectory, &ProcessRecord{Hostname: hostname, JobManagerPid: os.Getpid(), StartedAt: GetCurrentTime(), HeartbeatAt: GetCurrentTime()})
+	result, record := IsAttemptRunning(jobManagerDirectory)
+	assert.True(t, result, "JobManager process is alive")
+	assert.Equal(t, hostname, record.Hostname)
+}
+
+func Test_IsAttemptRunning_exitcode_exists(t *testing.T) {
+	jobManagerDirectory := t.TempDir()
+	hostname, _ := os.Hostname()
+	WriteProcessRecord(jobManagerDirectory, &ProcessRecord{Hostname: hostname, JobManagerPid: os.Getpid(), StartedAt: GetCurrentTime(), HeartbeatAt: GetCurrentTime()})
+	ioutil.WriteFile(filepath.Join(jobManagerDirectory, "toil.exitcode.txt"), []byte("1\n"), 0644)
+	result, _ := IsAttemptRunning(jobManagerDirectory)
+	assert.False(t, result, "execution is finished")
+}
+
+func Test_IsAttemptRunning_this_host_heartbeat_timeout(t *testing.T) {
+	jobManagerDirectory := t.TempDir()
+	hostname, _ := os.Hostname()
+	heartbeatAt := time.Now().Add(-2 * HeartbeatTimeout).Format("20060102150405")
+	// pid of crashed JobManager is reused by this process
+	WriteProcessRecord(jobManagerDirectory, &ProcessRecord{Hostname: hostname, JobManagerPid: os.Getpid(), Pgid: os.Getpid(), StartedAt: "20211101145001", HeartbeatAt: heartbeatAt})
+	result, record := IsAttemptRunning(jobManagerDirectory)
+	assert.False(t, result, "heartbeat is old")
+	assert.Equal(t, hostname, record.Hostname)
+}
+
+func Test_IsAttemptRunning_not_recorded(t *testing.T) {
+	result, record := IsAttemptRunning(t.TempDir())
+	assert.False(t, result, "executed by old version or killed before start")
+	assert.Nil(t, record)
+}
+
+func Test_IsAttemptRunning_other_host_heartbeat(t *testing.T) {
+	jobManagerDirectory := t.TempDir()
+	WriteProcessRecord(jobManagerDirectory, &ProcessRecord{Hostname: "no-such-host.example.com", JobManagerPid: 1, StartedAt: "20211101145001", HeartbeatAt: GetCurrentTime()})
+	result, _ := IsAttemptRunning(jobManagerDirectory)
+	assert.True(t, result, "heartbeat is new")
+}
+
+func Test_IsAttemptRunning_other_host_heartbeat_timeout(t *testing.T) {
+	jobManagerDirectory := t.TempDir()
+	heartbeatAt := time.Now().Add(-2 * HeartbeatTimeout).Format("20060102150405")
+	WriteProcessRecord(jobManagerDirectory, &ProcessRecord{Hostname: "no-such-host.example.com", JobManagerPid: 1, StartedAt: "20211101145001", HeartbeatAt: heartbeatAt})
+	result, _ := IsAttemptRunning(jobManagerDirectory)
+	assert.False(t, result, "heartbeat is old")
+}
+
+func Test_ProcessRecord_Elapsed(t *testing.T) {
+	record := ProcessRecord{StartedAt: time.Now().Add(-90 * time.Second).Format("20060102150405")}
+	elapsed := record.Elapsed()
+	assert.True(t, elapsed >= 89*time.Second && elapsed <= 91*time.Second, "about 90 seconds")
+}
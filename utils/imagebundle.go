@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// The first entry of image bundle
+const ImageBundleManifestFileName = "images-manifest.json"
+
+// Directory of image files in image bundle
+const imageBundleImageDirectory = "images"
+
+// Status of image in import-images
+const (
+	ImportStatusImported = "imported"
+	ImportStatusExists   = "exists"
+	ImportStatusFailed   = "failed"
+)
+
+/*
+ * Cached image file in image bundle.
+ * File is the file name in container_cache_directory.
+ */
+type ImageBundleEntry struct {
+	Image  string `json:"image"`
+	Format string `json:"format"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+type ImageBundleManifest struct {
+	CreatedAt   string             `json:"created_at"`
+	ToolVersion string             `json:"tool_version"`
+	Images      []ImageBundleEntry `json:"images"`
+}
+
+type ImportResult struct {
+	Image        string `json:"image"`
+	File         string `json:"file"`
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error,omitempty"`
+}
+
+/*
+ * Cached files of the images in container cache directory, both Singularity and Docker images.
+ * Return value: entries without size and digest, and images which are not cached in any format
+ */
+func CachedImageEntries(containerCacheDirectory string, images []string) ([]ImageBundleEntry, []string) {
+	entries := []ImageBundleEntry{}
+	missing := []string{}
+	for _, image := range images {
+		found := false
+		for _, format := range []string{ContainerImageFormatSingularity, ContainerImageFormatDocker} {
+			fn := CachedImageFileName(image, format)
+			if IsExistsFile(filepath.Join(containerCacheDirectory, fn)) {
+				entries = append(entries, ImageBundleEntry{Image: image, Format: format, File: fn})
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, image)
+		}
+	}
+	return entries, missing
+}
+
+// copy file to w, and return its sha256
+func copyWithSha256(w io.Writer, r io.Reader) (int64, string, error) {
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(w, hash), r)
+	return written, hex.EncodeToString(hash.Sum(nil)), err
+}
+
+func writeImageBundleFile(tw *tar.Writer, containerCacheDirectory string, entry *ImageBundleEntry) error {
+	f, err := os.Open(filepath.Join(containerCacheDirectory, entry.File))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    path.Join(imageBundleImageDirectory, entry.File),
+		Mode:    0644,
+		Size:    entry.Size,
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, digest, err := copyWithSha256(tw, io.LimitReader(f, entry.Size))
+	if err != nil {
+		return err
+	}
+	if digest != entry.Sha256 {
+		return fmt.Errorf("[%s] is changed while writing image bundle", entry.File)
+	}
+	return nil
+}
+
+/*
+ * Write image bundle: tar of manifest and cached image files.
+ * Manifest is the first entry, so images can be verified while importing.
+ * Written to temporary file and renamed, so broken bundle is not left by failure.
+ */
+func WriteImageBundle(fn string, containerCacheDirectory string, entries []ImageBundleEntry, toolVersion string) (*ImageBundleManifest, error) {
+	manifest := &ImageBundleManifest{
+		CreatedAt:   time.Now().Format(time.RFC3339),
+		ToolVersion: toolVersion,
+		Images:      []ImageBundleEntry{},
+	}
+	for _, entry := range entries {
+		fileinfo, err := os.Stat(filepath.Join(containerCacheDirectory, entry.File))
+		if err != nil {
+			return nil, err
+		}
+		entry.Size = fileinfo.Size()
+		if entry.Sha256, err = Sha256File(filepath.Join(containerCacheDirectory, entry.File)); err != nil {
+			return nil, err
+		}
+		manifest.Images = append(manifest.Images, entry)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tmp := fn + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+	tw := tar.NewWriter(f)
+	err = tw.WriteHeader(&tar.Header{Name: ImageBundleManifestFileName, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()})
+	if err == nil {
+		_, err = tw.Write(data)
+	}
+	for i := 0; err == nil && i < len(manifest.Images); i++ {
+		err = writeImageBundleFile(tw, containerCacheDirectory, &manifest.Images[i])
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return manifest, os.Rename(tmp, fn)
+}
+
+// Extract image file to temporary file, and rename it if size and digest are match
+func importImageFile(r io.Reader, dst string, entry *ImageBundleEntry) error {
+	tmp := dst + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	written, digest, err := copyWithSha256(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written != entry.Size || digest != entry.Sha256 {
+		return fmt.Errorf("digest is not match. expected: %d sha256:%s actual: %d sha256:%s", entry.Size, entry.Sha256, written, digest)
+	}
+	return os.Rename(tmp, dst)
+}
+
+/*
+ * Import images in image bundle to container cache directory, with digest verification.
+ * Existing file with the same digest is kept. Existing file with different digest is replaced only if force is true.
+ * Return value: results in the order of manifest. error if the bundle can not be read.
+ */
+func ImportImageBundle(fn string, containerCacheDirectory string, force bool) ([]ImportResult, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	header, err := tr.Next()
+	if err != nil || header.Name != ImageBundleManifestFileName {
+		return nil, fmt.Errorf("[%s] is not image bundle. %s is missing", fn, ImageBundleManifestFileName)
+	}
+	manifest := &ImageBundleManifest{}
+	if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("[%s] has invalid manifest: %v", fn, err)
+	}
+	if err := os.MkdirAll(containerCacheDirectory, 0755); err != nil {
+		return nil, err
+	}
+	results := make([]ImportResult, len(manifest.Images))
+	index := map[string]int{}
+	for i, entry := range manifest.Images {
+		results[i] = ImportResult{Image: entry.Image, File: filepath.Join(containerCacheDirectory, entry.File)}
+		// file name in manifest must not point outside of cache directory
+		if entry.File != filepath.Base(entry.File) || entry.File == "." || entry.File == ".." {
+			results[i].Status = ImportStatusFailed
+			results[i].ErrorMessage = fmt.Sprintf("invalid file name [%s]", entry.File)
+			continue
+		}
+		index[path.Join(imageBundleImageDirectory, entry.File)] = i
+	}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[header.Name]
+		if !ok || results[i].Status != "" {
+			// not in manifest, or duplicated
+			continue
+		}
+		entry := &manifest.Images[i]
+		result := &results[i]
+		if IsExistsFile(result.File) {
+			digest, err := Sha256File(result.File)
+			if err == nil && digest == entry.Sha256 {
+				result.Status = ImportStatusExists
+				continue
+			}
+			if !force {
+				result.Status = ImportStatusFailed
+				result.ErrorMessage = "different file exists. to replace, use --force"
+				continue
+			}
+		}
+		if err := importImageFile(tr, result.File, entry); err != nil {
+			result.Status = ImportStatusFailed
+			result.ErrorMessage = err.Error()
+			continue
+		}
+		result.Status = ImportStatusImported
+	}
+	for i := range results {
+		if results[i].Status == "" {
+			results[i].Status = ImportStatusFailed
+			results[i].ErrorMessage = "missing in image bundle"
+		}
+	}
+	return results, nil
+}
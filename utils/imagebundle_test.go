@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestImageBundle(t *testing.T) (string, []string) {
+	cache := t.TempDir()
+	images := []string{"quay.io/biocontainers/bwa:0.7.17", "broadinstitute/gatk:4.1.0.0", "example/missing:1.0"}
+	ioutil.WriteFile(filepath.Join(cache, CachedImageFileName(images[0], ContainerImageFormatSingularity)), []byte("sif-image-content-bwa"), 0644)
+	ioutil.WriteFile(filepath.Join(cache, CachedImageFileName(images[1], ContainerImageFormatSingularity)), []byte("sif-image-content-gatk"), 0644)
+	ioutil.WriteFile(filepath.Join(cache, CachedImageFileName(images[1], ContainerImageFormatDocker)), []byte("docker-save-gatk"), 0644)
+	entries, missing := CachedImageEntries(cache, images)
+	assert.Equal(t, []string{"example/missing:1.0"}, missing)
+	assert.Equal(t, 3, len(entries))
+
+	bundle := filepath.Join(t.TempDir(), "images.tar")
+	manifest, err := WriteImageBundle(bundle, cache, entries, "Version: 1.0.0-abc (built at 2021-11-01)")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(manifest.Images))
+	assert.Equal(t, int64(len("sif-image-content-bwa")), manifest.Images[0].Size)
+	sha256, _ := Sha256File(filepath.Join(cache, manifest.Images[0].File))
+	assert.Equal(t, sha256, manifest.Images[0].Sha256)
+	assert.Equal(t, ContainerImageFormatDocker, manifest.Images[2].Format)
+	return bundle, images
+}
+
+func Test_ImportImageBundle(t *testing.T) {
+	bundle, images := createTestImageBundle(t)
+	cache := filepath.Join(t.TempDir(), "cache")
+	results, err := ImportImageBundle(bundle, cache, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(results))
+	for _, r := range results {
+		assert.Equal(t, ImportStatusImported, r.Status, r.File)
+	}
+	raw, _ := ioutil.ReadFile(filepath.Join(cache, CachedImageFileName(images[0], ContainerImageFormatSingularity)))
+	assert.Equal(t, "sif-image-content-bwa", string(raw))
+	assert.Equal(t, []string{}, MissingCachedImages(cache, images[:2], ContainerImageFormatSingularity))
+
+	// same files are kept, different file is replaced only with force
+	different := filepath.Join(cache, CachedImageFileName(images[1], ContainerImageFormatDocker))
+	ioutil.WriteFile(different, []byte("other image"), 0644)
+	results, err = ImportImageBundle(bundle, cache, false)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportStatusExists, results[0].Status)
+	assert.Equal(t, ImportStatusFailed, results[2].Status)
+	raw, _ = ioutil.ReadFile(different)
+	assert.Equal(t, "other image", string(raw))
+	results, err = ImportImageBundle(bundle, cache, true)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportStatusImported, results[2].Status)
+	raw, _ = ioutil.ReadFile(different)
+	assert.Equal(t, "docker-save-gatk", string(raw))
+}
+
+func Test_ImportImageBundle_broken(t *testing.T) {
+	bundle, images := createTestImageBundle(t)
+	raw, _ := ioutil.ReadFile(bundle)
+	i := bytes.Index(raw, []byte("sif-image-content-bwa"))
+	assert.True(t, i > 0)
+	raw[i] = 'S'
+	ioutil.WriteFile(bundle, raw, 0644)
+
+	cache := t.TempDir()
+	results, err := ImportImageBundle(bundle, cache, false)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportStatusFailed, results[0].Status)
+	assert.Contains(t, results[0].ErrorMessage, "digest is not match")
+	assert.Equal(t, ImportStatusImported, results[1].Status)
+	// broken image is not placed
+	assert.Equal(t, []string{images[0]}, MissingCachedImages(cache, images[:2], ContainerImageFormatSingularity))
+	files, _ := ioutil.ReadDir(cache)
+	assert.Equal(t, 2, len(files), "temporary file is removed")
+
+	notBundle := filepath.Join(t.TempDir(), "not-bundle.tar")
+	ioutil.WriteFile(notBundle, []byte("not tar"), 0644)
+	_, err = ImportImageBundle(notBundle, cache, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Format of cached container images in container_cache_directory.
+const (
+	ContainerImageFormatSingularity = "singularity"
+	ContainerImageFormatDocker      = "docker"
+)
+
+/*
+ * Directory which has CWL files of the workflow.
+ * workflow_file is assumed to be jga-analysis/per-sample/Workflows/per-sample.cwl,
+ * so the directory is jga-analysis/per-sample
+ */
+func WorkflowDirectory(workflowFilePath string) string {
+	return filepath.Dir(filepath.Dir(workflowFilePath))
+}
+
+/*
+ * Collect dockerPull of DockerRequirement in requirements or hints, in both map and array form.
+ */
+func collectDockerPull(node interface{}, images map[string]bool) {
+	switch v := node.(type) {
+	case map[interface{}]interface{}:
+		if v["class"] == "DockerRequirement" {
+			if image, ok := v["dockerPull"].(string); ok && image != "" {
+				images[image] = true
+			}
+		}
+		if requirement, ok := v["DockerRequirement"].(map[interface{}]interface{}); ok {
+			if image, ok := requirement["dockerPull"].(string); ok && image != "" {
+				images[image] = true
+			}
+		}
+		for _, child := range v {
+			collectDockerPull(child, images)
+		}
+	case []interface{}:
+		for _, child := range v {
+			collectDockerPull(child, images)
+		}
+	}
+}
+
+/*
+ * Docker images required by CWL files (*.cwl) under the workflow directory.
+ * Return value: sorted image names without duplicates
+ */
+func DiscoverDockerImages(workflowDirectory string) ([]string, error) {
+	if strings.HasPrefix(workflowDirectory, "http://") || strings.HasPrefix(workflowDirectory, "https://") {
+		return nil, fmt.Errorf("images of remote workflow [%s] can not be discovered", workflowDirectory)
+	}
+	images := map[string]bool{}
+	err := filepath.Walk(workflowDirectory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".cwl" {
+			return nil
+		}
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var document interface{}
+		if err := yaml.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("[%s] is not valid CWL: %v", path, err)
+		}
+		collectDockerPull(document, images)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for image := range images {
+		result = append(result, image)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+/*
+ * File name of cached image in container_cache_directory.
+ *   singularity: "/" is replaced by "_", with suffix .sif, as cwltool names images in CWL_SINGULARITY_CACHE
+ *   docker: "/" is removed, with suffix .tar
+ */
+func CachedImageFileName(image string, format string) string {
+	if format == ContainerImageFormatDocker {
+		return strings.ReplaceAll(image, "/", "") + ".tar"
+	}
+	return strings.ReplaceAll(image, "/", "_") + ".sif"
+}
+
+/*
+ * Images which are not cached in container cache directory.
+ */
+func MissingCachedImages(containerCacheDirectory string, images []string, format string) []string {
+	missing := []string{}
+	for _, image := range images {
+		if !IsExistsFile(filepath.Join(containerCacheDirectory, CachedImageFileName(image, format))) {
+			missing = append(missing, image)
+		}
+	}
+	return missing
+}
+
+// Status of image in pull-container-images
+const (
+	PullStatusPulled = "pulled"
+	PullStatusCached = "cached"
+	PullStatusFailed = "failed"
+)
+
+type PullResult struct {
+	Image        string        `json:"image"`
+	File         string        `json:"file"`
+	Status       string        `json:"status"`
+	ErrorMessage string        `json:"error,omitempty"`
+	Elapsed      time.Duration `json:"elapsed"`
+}
+
+/*
+ * Commands to save the image to file.
+ *   singularity: singularity pull
+ *   docker: docker pull and docker save
+ */
+func pullImageCommands(image string, fn string, format string) [][]string {
+	if format == ContainerImageFormatDocker {
+		return [][]string{
+			{"docker", "pull", image},
+			{"docker", "save", "-o", fn, image},
+		}
+	}
+	return [][]string{
+		{"singularity", "pull", "--force", "--name", fn, "docker://" + image},
+	}
+}
+
+// the last non-empty line of command output, for error message
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+/*
+ * Pull the image and save it in container cache directory.
+ * Image is saved to temporary file and renamed, so broken image is not left by failure.
+ * Cached image is not pulled unless force is true.
+ */
+func PullImage(ctx context.Context, image string, containerCacheDirectory string, format string, force bool) PullResult {
+	fn := filepath.Join(containerCacheDirectory, CachedImageFileName(image, format))
+	result := PullResult{Image: image, File: fn}
+	if !force && IsExistsFile(fn) {
+		result.Status = PullStatusCached
+		return result
+	}
+	started := time.Now()
+	fail := func(err error) PullResult {
+		result.Status = PullStatusFailed
+		result.ErrorMessage = err.Error()
+		result.Elapsed = time.Since(started)
+		return result
+	}
+	if err := os.MkdirAll(containerCacheDirectory, 0755); err != nil {
+		return fail(err)
+	}
+	tmp := fn + ".tmp"
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+	for _, command := range pullImageCommands(image, tmp, format) {
+		out, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+		if err != nil {
+			if line := lastLine(out); line != "" {
+				err = fmt.Errorf("%s %s: %v: %s", command[0], command[1], err, line)
+			} else {
+				err = fmt.Errorf("%s %s: %v", command[0], command[1], err)
+			}
+			return fail(err)
+		}
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		return fail(err)
+	}
+	result.Status = PullStatusPulled
+	result.Elapsed = time.Since(started)
+	return result
+}
+
+/*
+ * Pull images in parallel. At most jobs images are pulled at once.
+ * Return value: results in the same order as images
+ */
+func PullImages(ctx context.Context, images []string, containerCacheDirectory string, format string, force bool, jobs int) []PullResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+	results := make([]PullResult, len(images))
+	semaphore := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, image := range images {
+		i, image := i, image
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			results[i] = PullImage(ctx, image, containerCacheDirectory, format, force)
+		}()
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestWorkflowDirectory(t *testing.T) string {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "Workflows"), 0755)
+	os.MkdirAll(filepath.Join(dir, "Tools"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "Workflows", "per-sample.cwl"), []byte(`cwlVersion: v1.0
+class: Workflow
+requirements:
+  - class: SubworkflowFeatureRequirement
+steps: {}
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "Tools", "bwa-mem.cwl"), []byte(`cwlVersion: v1.0
+class: CommandLineTool
+requirements:
+  - class: DockerRequirement
+    dockerPull: quay.io/biocontainers/bwa:0.7.17--pl5.22.0_2
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "Tools", "samtools.cwl"), []byte(`cwlVersion: v1.0
+class: CommandLineTool
+hints:
+  DockerRequirement:
+    dockerPull: 'quay.io/biocontainers/samtools:1.10--h2e538c0_3'
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "Tools", "packed.cwl"), []byte(`{"cwlVersion": "v1.0", "$graph": [
+  {"class": "CommandLineTool", "id": "#samtools", "requirements": [{"class": "DockerRequirement", "dockerPull": "quay.io/biocontainers/samtools:1.10--h2e538c0_3"}]},
+  {"class": "CommandLineTool", "id": "#gatk", "hints": [{"class": "DockerRequirement", "dockerPull": "broadinstitute/gatk:4.1.0.0"}]}
+]}
+`), 0644)
+	// not CWL file
+	ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("dockerPull: example/not-used:1.0\n"), 0644)
+	return dir
+}
+
+func Test_DiscoverDockerImages(t *testing.T) {
+	dir := createTestWorkflowDirectory(t)
+	assert.Equal(t, dir, WorkflowDirectory(filepath.Join(dir, "Workflows", "per-sample.cwl")))
+	images, err := DiscoverDockerImages(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"broadinstitute/gatk:4.1.0.0",
+		"quay.io/biocontainers/bwa:0.7.17--pl5.22.0_2",
+		"quay.io/biocontainers/samtools:1.10--h2e538c0_3",
+	}, images)
+
+	ioutil.WriteFile(filepath.Join(dir, "Tools", "broken.cwl"), []byte("class: [\n"), 0644)
+	_, err = DiscoverDockerImages(dir)
+	assert.Error(t, err)
+	_, err = DiscoverDockerImages("https://example.com/per-sample")
+	assert.Error(t, err)
+}
+
+func Test_MissingCachedImages(t *testing.T) {
+	image := "quay.io/biocontainers/bwa:0.7.17--pl5.22.0_2"
+	assert.Equal(t, "quay.io_biocontainers_bwa:0.7.17--pl5.22.0_2.sif", CachedImageFileName(image, ContainerImageFormatSingularity))
+	assert.Equal(t, "quay.iobiocontainersbwa:0.7.17--pl5.22.0_2.tar", CachedImageFileName(image, ContainerImageFormatDocker))
+
+	cache := t.TempDir()
+	ioutil.WriteFile(filepath.Join(cache, CachedImageFileName(image, ContainerImageFormatSingularity)), []byte("dummy sif"), 0644)
+	images := []string{image, "broadinstitute/gatk:4.1.0.0"}
+	assert.Equal(t, []string{"broadinstitute/gatk:4.1.0.0"}, MissingCachedImages(cache, images, ContainerImageFormatSingularity))
+	assert.Equal(t, images, MissingCachedImages(cache, images, ContainerImageFormatDocker))
+
+	report := NewReadinessReport("", &EnvironmentReport{}, []string{}, nil)
+	report.SetCachedImages(images, []string{"broadinstitute/gatk:4.1.0.0"})
+	assert.False(t, report.Ready)
+	assert.Contains(t, report.Problems, "1 container images are not cached")
+}
+
+// singularity which creates --name file, and fails for image containing "broken"
+func setTestSingularity(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --name) shift; NAME="$1" ;;
+    docker://*) IMAGE="$1" ;;
+  esac
+  shift
+done
+case "$IMAGE" in
+  *broken*) echo "FATAL: manifest unknown" >&2; exit 255 ;;
+esac
+echo "$IMAGE" > "$NAME"
+`
+	ioutil.WriteFile(filepath.Join(dir, "singularity"), []byte(script), 0755)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func Test_PullImages(t *testing.T) {
+	setTestSingularity(t)
+	cache := filepath.Join(t.TempDir(), "cache")
+	images := []string{"quay.io/biocontainers/bwa:0.7.17", "example/broken:1.0", "broadinstitute/gatk:4.1.0.0"}
+	results := PullImages(context.Background(), images, cache, ContainerImageFormatSingularity, false, 2)
+	assert.Equal(t, 3, len(results))
+	for i, r := range results {
+		assert.Equal(t, images[i], r.Image)
+	}
+	assert.Equal(t, PullStatusPulled, results[0].Status)
+	assert.Equal(t, filepath.Join(cache, "quay.io_biocontainers_bwa:0.7.17.sif"), results[0].File)
+	raw, _ := ioutil.ReadFile(results[0].File)
+	assert.Equal(t, "docker://quay.io/biocontainers/bwa:0.7.17\n", string(raw))
+	assert.Equal(t, PullStatusFailed, results[1].Status)
+	assert.Contains(t, results[1].ErrorMessage, "manifest unknown")
+	assert.False(t, IsExistsFile(results[1].File))
+	assert.False(t, IsExistsFile(results[1].File+".tmp"))
+
+	// cached images are not pulled again unless force
+	ioutil.WriteFile(results[0].File, []byte("cached"), 0644)
+	results = PullImages(context.Background(), images[:1], cache, ContainerImageFormatSingularity, false, 2)
+	assert.Equal(t, PullStatusCached, results[0].Status)
+	results = PullImages(context.Background(), images[:1], cache, ContainerImageFormatSingularity, true, 2)
+	assert.Equal(t, PullStatusPulled, results[0].Status)
+}
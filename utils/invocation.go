@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Directory in jobManager/<currentTime> where invocation of `run` is recorded.
+const InvocationDirectoryName = "invocation"
+
+const InvocationFileName = "invocation.json"
+
+/*
+ * Record of a `run` invocation. It is written once and not modified,
+ * so each execution can be reproduced by `replay` even if sample sheet or config file is changed later.
+ * SampleSheetFile and ConfigFile are file names of the copies in the invocation directory.
+ */
+type Invocation struct {
+	ToolVersion      string             `json:"tool_version"`
+	StartedAt        string             `json:"started_at"`
+	Args             []string           `json:"args"`
+	SampleSheetFile  string             `json:"sample_sheet_file"`
+	ConfigFile       string             `json:"config_file"`
+	Flags            map[string]string  `json:"flags"`
+	Environment      *EnvironmentReport `json:"environment"`
+	Hostname         string             `json:"hostname"`
+	WorkingDirectory string             `json:"working_directory"`
+	// jobManager directory of the replayed invocation, if this is executed by `replay`
+	ReplayOf string `json:"replay_of,omitempty"`
+}
+
+func NewInvocation(toolVersion string, sampleSheetFile string, configFile string, flags map[string]string, env *EnvironmentReport) *Invocation {
+	hostname, _ := os.Hostname()
+	cwd, _ := os.Getwd()
+	return &Invocation{
+		ToolVersion:      toolVersion,
+		StartedAt:        time.Now().Format(time.RFC3339),
+		Args:             os.Args,
+		SampleSheetFile:  filepath.Base(sampleSheetFile),
+		ConfigFile:       filepath.Base(configFile),
+		Flags:            flags,
+		Environment:      env,
+		Hostname:         hostname,
+		WorkingDirectory: cwd,
+	}
+}
+
+/*
+ * Copy sample sheet and config file to jobManagerDirectory/invocation and write invocation.json.
+ * Written files are read only.
+ */
+func WriteInvocation(jobManagerDirectory string, invocation *Invocation, sampleSheetFile string, configFile string) error {
+	dir := filepath.Join(jobManagerDirectory, InvocationDirectoryName)
+	if IsExistsFile(filepath.Join(dir, InvocationFileName)) {
+		return fmt.Errorf("invocation is already recorded in [%s]", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if invocation.SampleSheetFile == invocation.ConfigFile {
+		return fmt.Errorf("sample sheet and config file have the same name [%s]", invocation.SampleSheetFile)
+	}
+	for src, name := range map[string]string{sampleSheetFile: invocation.SampleSheetFile, configFile: invocation.ConfigFile} {
+		dst := filepath.Join(dir, name)
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+		if err := os.Chmod(dst, 0444); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(invocation, "", "  ")
+	if err != nil {
+		return err
+	}
+	fn := filepath.Join(dir, InvocationFileName)
+	if err := ioutil.WriteFile(fn, data, 0444); err != nil {
+		return err
+	}
+	return os.Chmod(fn, 0444)
+}
+
+/*
+ * Return invocation.json path from jobManager/<currentTime>, its invocation directory or invocation.json itself.
+ */
+func InvocationFilePath(path string) string {
+	if fileinfo, err := os.Stat(path); err == nil && fileinfo.IsDir() {
+		if IsExistsFile(filepath.Join(path, InvocationFileName)) {
+			return filepath.Join(path, InvocationFileName)
+		}
+		return filepath.Join(path, InvocationDirectoryName, InvocationFileName)
+	}
+	return path
+}
+
+/*
+ * Read invocation record.
+ * SampleSheetFile and ConfigFile of returned value are absolute paths of the copies.
+ */
+func ReadInvocation(path string) (*Invocation, error) {
+	fn, err := filepath.Abs(InvocationFilePath(path))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	invocation := &Invocation{}
+	if err := json.Unmarshal(raw, invocation); err != nil {
+		return nil, fmt.Errorf("[%s] is not invocation record: %v", fn, err)
+	}
+	if invocation.SampleSheetFile == "" || invocation.ConfigFile == "" {
+		return nil, fmt.Errorf("[%s] has no sample sheet or config file", fn)
+	}
+	dir := filepath.Dir(fn)
+	invocation.SampleSheetFile = filepath.Join(dir, invocation.SampleSheetFile)
+	invocation.ConfigFile = filepath.Join(dir, invocation.ConfigFile)
+	for _, copied := range []string{invocation.SampleSheetFile, invocation.ConfigFile} {
+		if !IsExistsFile(copied) {
+			return nil, fmt.Errorf("[%s] is missing", copied)
+		}
+	}
+	return invocation, nil
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WriteAndReadInvocation(t *testing.T) {
+	jobManagerDirectory := filepath.Join(t.TempDir(), "jobManager", "20211101143242")
+	sampleSheetFile := "../test/datafiles/samplesheet_2run-test.json"
+	configFile := "../test/datafiles/configfile_1run-test.json"
+	flags := map[string]string{"resume": "true", "cancel-timeout": "2m0s"}
+	invocation := NewInvocation("Version: 1.0.0-abc (built at 2021-11-01)", sampleSheetFile, configFile, flags, &EnvironmentReport{ToilCWLRunnerExists: true})
+	assert.NoError(t, WriteInvocation(jobManagerDirectory, invocation, sampleSheetFile, configFile))
+
+	dir := filepath.Join(jobManagerDirectory, InvocationDirectoryName)
+	for _, fn := range []string{InvocationFileName, "samplesheet_2run-test.json", "configfile_1run-test.json"} {
+		fileinfo, err := os.Stat(filepath.Join(dir, fn))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0444), fileinfo.Mode().Perm(), fn)
+	}
+	// invocation is not overwritten
+	assert.Error(t, WriteInvocation(jobManagerDirectory, invocation, sampleSheetFile, configFile))
+
+	// jobManager directory, invocation directory and invocation.json
+	for _, path := range []string{jobManagerDirectory, dir, filepath.Join(dir, InvocationFileName)} {
+		read, err := ReadInvocation(path)
+		assert.NoError(t, err, path)
+		assert.Equal(t, filepath.Join(dir, "samplesheet_2run-test.json"), read.SampleSheetFile)
+		assert.Equal(t, filepath.Join(dir, "configfile_1run-test.json"), read.ConfigFile)
+		assert.Equal(t, flags, read.Flags)
+		assert.Equal(t, invocation.ToolVersion, read.ToolVersion)
+		assert.True(t, read.Environment.ToilCWLRunnerExists)
+	}
+	sha256Original, _ := Sha256File(configFile)
+	sha256Copied, _ := Sha256File(filepath.Join(dir, "configfile_1run-test.json"))
+	assert.Equal(t, sha256Original, sha256Copied)
+}
+
+func Test_ReadInvocation_missing(t *testing.T) {
+	_, err := ReadInvocation(t.TempDir())
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+// Lock file of output directory. Only one `run` processes the output directory.
+const OutputDirectoryLockFileName = "jobmanager.lock"
+
+// Directory under jobManager directory, contains claim file of each sample.
+const SampleClaimDirectoryName = "claims"
+
+/*
+ * Owner of output directory lock or sample claim.
+ */
+type LockOwner struct {
+	Owner     string `json:"owner"`
+	Hostname  string `json:"hostname"`
+	Pid       int    `json:"pid"`
+	StartedAt string `json:"started_at"`
+}
+
+func (o *LockOwner) String() string {
+	return fmt.Sprintf("%s@%s pid %d since %s", o.Owner, o.Hostname, o.Pid, o.StartedAt)
+}
+
+func newLockOwner() *LockOwner {
+	owner := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+	hostname, _ := os.Hostname()
+	return &LockOwner{
+		Owner:     owner,
+		Hostname:  hostname,
+		Pid:       os.Getpid(),
+		StartedAt: GetCurrentTime(),
+	}
+}
+
+/*
+ * Lock owner process is finished.
+ * Process on other host can not be checked, so it is not stale.
+ */
+func (o *LockOwner) IsStale() bool {
+	hostname, _ := os.Hostname()
+	return o.Hostname == hostname && !isProcessAlive(o.Pid)
+}
+
+func (o *LockOwner) isMine() bool {
+	hostname, _ := os.Hostname()
+	return o.Hostname == hostname && o.Pid == os.Getpid()
+}
+
+func readLockOwner(lockFilePath string) (*LockOwner, error) {
+	raw, err := ioutil.ReadFile(lockFilePath)
+	if err != nil {
+		return nil, err
+	}
+	var owner LockOwner
+	if err := json.Unmarshal(raw, &owner); err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
+
+/*
+ * Create lock file exclusively.
+ * If the lock file exists and it is stale or breakLock is set, it is replaced.
+ * Return value: current owner of the lock and true if this process gets the lock.
+ */
+func acquireLockFile(lockFilePath string, breakLock bool) (*LockOwner, bool, error) {
+	me := newLockOwner()
+	data, err := json.MarshalIndent(me, "", "  ")
+	if err != nil {
+		return nil, false, err
+	}
+	for retry := 0; retry < 2; retry++ {
+		file, err := os.OpenFile(lockFilePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			defer file.Close()
+			if _, err := file.Write(data); err != nil {
+				return nil, false, err
+			}
+			return me, true, nil
+		}
+		if !os.IsExist(err) {
+			return nil, false, err
+		}
+		owner, err := readLockOwner(lockFilePath)
+		if err != nil {
+			// broken lock file, such as killed while writing
+			owner = &LockOwner{}
+		}
+		if owner.isMine() {
+			return owner, true, nil
+		}
+		if !breakLock && !owner.IsStale() {
+			return owner, false, nil
+		}
+		fmt.Printf("Remove lock file [%s] of %s\n", lockFilePath, owner)
+		if err := os.Remove(lockFilePath); err != nil && !os.IsNotExist(err) {
+			return owner, false, err
+		}
+	}
+	owner, _ := readLockOwner(lockFilePath)
+	return owner, false, nil
+}
+
+/*
+ * Remove lock file if this process owns it.
+ */
+func releaseLockFile(lockFilePath string) {
+	owner, err := readLockOwner(lockFilePath)
+	if err != nil || !owner.isMine() {
+		return
+	}
+	os.Remove(lockFilePath)
+}
+
+func OutputDirectoryLockFilePath(outputDirectoryPath string) string {
+	return filepath.Join(outputDirectoryPath, OutputDirectoryLockFileName)
+}
+
+/*
+ * Lock output directory for `run`.
+ * Stale lock, which owner process is finished on this host, is removed automatically.
+ * Lock of running process or other host is removed only when breakLock is set.
+ */
+func AcquireOutputDirectoryLock(outputDirectoryPath string, breakLock bool) error {
+	lockFilePath := OutputDirectoryLockFilePath(outputDirectoryPath)
+	owner, acquired, err := acquireLockFile(lockFilePath, breakLock)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return fmt.Errorf("output directory [%s] is locked by %s. If it is not running, use --break-lock", outputDirectoryPath, owner)
+	}
+	return nil
+}
+
+func ReleaseOutputDirectoryLock(outputDirectoryPath string) {
+	releaseLockFile(OutputDirectoryLockFilePath(outputDirectoryPath))
+}
+
+func sampleClaimFilePath(outputDirectoryPath string, sampleId string) string {
+	return filepath.Join(outputDirectoryPath, "jobManager", SampleClaimDirectoryName, sampleId+".json")
+}
+
+/*
+ * Claim the sample before execution, so other `run` does not execute same sample.
+ * Return value: true if claimed. If false, current owner of the claim is returned.
+ */
+func ClaimSample(outputDirectoryPath string, sampleId string) (bool, *LockOwner, error) {
+	if err := os.MkdirAll(filepath.Dir(sampleClaimFilePath(outputDirectoryPath, sampleId)), 0755); err != nil {
+		return false, nil, err
+	}
+	owner, acquired, err := acquireLockFile(sampleClaimFilePath(outputDirectoryPath, sampleId), false)
+	return acquired, owner, err
+}
+
+func ReleaseSampleClaim(outputDirectoryPath string, sampleId string) {
+	releaseLockFile(sampleClaimFilePath(outputDirectoryPath, sampleId))
+}
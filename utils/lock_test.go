@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestLockFile(t *testing.T, lockFilePath string, owner *LockOwner) {
+	data, _ := json.Marshal(owner)
+	if err := ioutil.WriteFile(lockFilePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pid of finished process
+func finishedPid(t *testing.T) int {
+	c := exec.Command("true")
+	if err := c.Run(); err != nil {
+		t.Skip("true command is not found")
+	}
+	return c.Process.Pid
+}
+
+func Test_AcquireOutputDirectoryLock(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	assert.NoError(t, AcquireOutputDirectoryLock(outputDirectoryPath, false))
+	owner, err := readLockOwner(OutputDirectoryLockFilePath(outputDirectoryPath))
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getpid(), owner.Pid)
+	assert.NoError(t, AcquireOutputDirectoryLock(outputDirectoryPath, false), "lock of this process")
+	ReleaseOutputDirectoryLock(outputDirectoryPath)
+	assert.False(t, IsExistsFile(OutputDirectoryLockFilePath(outputDirectoryPath)))
+}
+
+func Test_AcquireOutputDirectoryLock_locked_by_other_host(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	other := &LockOwner{Owner: "someone", Hostname: "no-such-host.example.com", Pid: 1, StartedAt: "20211101145001"}
+	writeTestLockFile(t, OutputDirectoryLockFilePath(outputDirectoryPath), other)
+	err := AcquireOutputDirectoryLock(outputDirectoryPath, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "someone@no-such-host.example.com")
+	// not removed by other process
+	ReleaseOutputDirectoryLock(outputDirectoryPath)
+	assert.True(t, IsExistsFile(OutputDirectoryLockFilePath(outputDirectoryPath)))
+
+	assert.NoError(t, AcquireOutputDirectoryLock(outputDirectoryPath, true), "--break-lock")
+	owner, _ := readLockOwner(OutputDirectoryLockFilePath(outputDirectoryPath))
+	assert.Equal(t, os.Getpid(), owner.Pid)
+}
+
+func Test_AcquireOutputDirectoryLock_stale(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	hostname, _ := os.Hostname()
+	writeTestLockFile(t, OutputDirectoryLockFilePath(outputDirectoryPath), &LockOwner{Owner: "someone", Hostname: hostname, Pid: finishedPid(t), StartedAt: "20211101145001"})
+	assert.NoError(t, AcquireOutputDirectoryLock(outputDirectoryPath, false), "owner process is finished")
+}
+
+func Test_ClaimSample(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	claimed, _, err := ClaimSample(outputDirectoryPath, "Sample1")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	ReleaseSampleClaim(outputDirectoryPath, "Sample1")
+	assert.False(t, IsExistsFile(sampleClaimFilePath(outputDirectoryPath, "Sample1")))
+
+	writeTestLockFile(t, sampleClaimFilePath(outputDirectoryPath, "Sample2"), &LockOwner{Owner: "someone", Hostname: "no-such-host.example.com", Pid: 1})
+	claimed, owner, err := ClaimSample(outputDirectoryPath, "Sample2")
+	assert.NoError(t, err)
+	assert.False(t, claimed, "claimed by other run")
+	assert.Equal(t, "someone", owner.Owner)
+	assert.Equal(t, []string{}, ListSampleAttemptDirectories(outputDirectoryPath, "Sample2"), "claims directory is not attempt")
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of log file in job manager directory.
+const (
+	LogKindStdout = "stdout"
+	LogKindStderr = "stderr"
+	LogKindToil   = "toil"
+)
+
+// Interval to check new lines of followed log file.
+const FollowLogInterval = time.Second
+
+/*
+ * Return job manager directory of the attempt of the sample.
+ * attempt starts from 1 for the first execution. 0 is the latest execution.
+ */
+func ResolveAttemptDirectory(outputDirectoryPath string, sampleId string, attempt int) (string, error) {
+	// the latest is first
+	attemptDirectories := ListSampleAttemptDirectories(outputDirectoryPath, sampleId)
+	if len(attemptDirectories) == 0 {
+		return "", fmt.Errorf("SampleId [%s] is never executed", sampleId)
+	}
+	if attempt == 0 {
+		return attemptDirectories[0], nil
+	}
+	if attempt < 0 || attempt > len(attemptDirectories) {
+		return "", fmt.Errorf("SampleId [%s] has %d attempts. attempt %d is not found", sampleId, len(attemptDirectories), attempt)
+	}
+	return attemptDirectories[len(attemptDirectories)-attempt], nil
+}
+
+/*
+ * Return log file path of the kind in the job manager directory.
+ */
+func LogFilePath(jobManagerDirectory string, sampleId string, kind string) string {
+	switch kind {
+	case LogKindStdout:
+		return filepath.Join(jobManagerDirectory, "toil.stdout.txt")
+	case LogKindStderr:
+		return filepath.Join(jobManagerDirectory, "toil.stderr.txt")
+	default:
+		return createLogFilePath(jobManagerDirectory, sampleId)
+	}
+}
+
+/*
+ * Write lines of the log file to w.
+ * If re is not nil, only matched lines are written with line number.
+ * If tailLines is positive, only last tailLines lines are written.
+ * Last line without newline is still written by toil. It is written only if partialLastLine is true,
+ * otherwise it is left for FollowLog, so the line is written once as a whole.
+ * Return value: size and number of complete lines, used as the start position to follow.
+ */
+func WriteLog(w io.Writer, fn string, re *regexp.Regexp, tailLines int, partialLastLine bool) (int64, int, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	var offset int64
+	lineNo := 0
+	tail := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			break
+		}
+		number := lineNo + 1
+		if strings.HasSuffix(line, "\n") {
+			offset += int64(len(line))
+			lineNo = number
+		} else {
+			// last line is still written. it is not counted in offset and number of lines
+			if !partialLastLine {
+				break
+			}
+			line += "\n"
+		}
+		if re != nil {
+			if !re.MatchString(line) {
+				continue
+			}
+			line = fmt.Sprintf("%d:%s", number, line)
+		}
+		if tailLines > 0 {
+			tail = append(tail, line)
+			if len(tail) > tailLines {
+				tail = tail[1:]
+			}
+			continue
+		}
+		io.WriteString(w, line)
+	}
+	for _, line := range tail {
+		io.WriteString(w, line)
+	}
+	return offset, lineNo, nil
+}
+
+/*
+ * Write lines appended to the log file after offset, until ctx is cancelled or finished returns true.
+ * If re is not nil, only matched lines are written with line number. lineNo is number of lines before offset.
+ */
+func FollowLog(ctx context.Context, w io.Writer, fn string, offset int64, lineNo int, re *regexp.Regexp, finished func() bool) {
+	buffer := ""
+	writeLine := func(line string) {
+		lineNo += 1
+		if re == nil {
+			io.WriteString(w, line)
+		} else if re.MatchString(line) {
+			io.WriteString(w, fmt.Sprintf("%d:%s", lineNo, line))
+		}
+	}
+	for {
+		// check finished before read, so lines written before finish are not lost
+		isFinished := finished != nil && finished()
+		f, err := os.Open(fn)
+		if err == nil {
+			if fileinfo, err := f.Stat(); err == nil && fileinfo.Size() < offset {
+				// file is truncated, such as restarted attempt
+				offset = 0
+				lineNo = 0
+			}
+			f.Seek(offset, io.SeekStart)
+			raw, _ := ioutil.ReadAll(f)
+			f.Close()
+			offset += int64(len(raw))
+			buffer += string(raw)
+			for {
+				index := strings.IndexByte(buffer, '\n')
+				if index < 0 {
+					break
+				}
+				line := buffer[:index+1]
+				buffer = buffer[index+1:]
+				writeLine(line)
+			}
+		}
+		if isFinished {
+			if buffer != "" {
+				writeLine(buffer + "\n")
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(FollowLogInterval):
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ResolveAttemptDirectory(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	first := createTestAttempt(t, outputDirectoryPath, "20211101143242", "XX00001", "1", false)
+	second := createTestAttempt(t, outputDirectoryPath, "20211101145001", "XX00001", "0", false)
+	result, err := ResolveAttemptDirectory(outputDirectoryPath, "XX00001", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, second, result, "latest")
+	result, _ = ResolveAttemptDirectory(outputDirectoryPath, "XX00001", 1)
+	assert.Equal(t, first, result, "first execution")
+	_, err = ResolveAttemptDirectory(outputDirectoryPath, "XX00001", 3)
+	assert.Error(t, err)
+	_, err = ResolveAttemptDirectory(outputDirectoryPath, "XX00002", 0)
+	assert.Error(t, err, "never executed")
+}
+
+func Test_LogFilePath(t *testing.T) {
+	assert.Equal(t, "dir/toil.stderr.txt", LogFilePath("dir", "XX00001", LogKindStderr))
+	assert.Equal(t, "dir/toil.stdout.txt", LogFilePath("dir", "XX00001", LogKindStdout))
+	assert.Equal(t, "dir/logs/XX00001.log", LogFilePath("dir", "XX00001", LogKindToil))
+}
+
+func Test_WriteLog(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "toil.log")
+	ioutil.WriteFile(fn, []byte("INFO start\nERROR bwa failed\nINFO retry\nERROR sort failed"), 0644)
+	var buffer bytes.Buffer
+	offset, lineNo, err := WriteLog(&buffer, fn, nil, 0, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "INFO start\nERROR bwa failed\nINFO retry\nERROR sort failed\n", buffer.String())
+	assert.Equal(t, int64(39), offset, "last line is still written")
+	assert.Equal(t, 3, lineNo)
+
+	buffer.Reset()
+	WriteLog(&buffer, fn, regexp.MustCompile("ERROR"), 0, true)
+	assert.Equal(t, "2:ERROR bwa failed\n4:ERROR sort failed\n", buffer.String())
+
+	buffer.Reset()
+	WriteLog(&buffer, fn, nil, 2, true)
+	assert.Equal(t, "INFO retry\nERROR sort failed\n", buffer.String())
+
+	_, _, err = WriteLog(&buffer, fn+".missing", nil, 0, true)
+	assert.Error(t, err)
+}
+
+func Test_FollowLog(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "toil.log")
+	ioutil.WriteFile(fn, []byte("INFO start\n"), 0644)
+	var buffer bytes.Buffer
+	offset, lineNo, _ := WriteLog(&buffer, fn, nil, 0, false)
+	buffer.Reset()
+	f, _ := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("ERROR failed\nINFO end")
+	f.Close()
+	checked := 0
+	FollowLog(context.Background(), &buffer, fn, offset, lineNo, regexp.MustCompile("ERROR|end"), func() bool {
+		checked += 1
+		return true
+	})
+	assert.Equal(t, "2:ERROR failed\n3:INFO end\n", buffer.String())
+	assert.Equal(t, 1, checked)
+}
+
+func Test_FollowLog_half_written_line(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "toil.log")
+	ioutil.WriteFile(fn, []byte("INFO start\nERROR bwa"), 0644)
+	var buffer bytes.Buffer
+	offset, lineNo, _ := WriteLog(&buffer, fn, regexp.MustCompile("ERROR"), 0, false)
+	assert.Equal(t, "", buffer.String(), "half-written line is left for FollowLog")
+	assert.Equal(t, int64(11), offset)
+	assert.Equal(t, 1, lineNo)
+	f, _ := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(" failed\nERROR sort failed\n")
+	f.Close()
+	FollowLog(context.Background(), &buffer, fn, offset, lineNo, regexp.MustCompile("ERROR"), func() bool { return true })
+	assert.Equal(t, "2:ERROR bwa failed\n3:ERROR sort failed\n", buffer.String())
+}
+
+func Test_FollowLog_cancel(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "toil.log")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var buffer bytes.Buffer
+	FollowLog(ctx, &buffer, fn, 0, 0, nil, func() bool { return false })
+	assert.Equal(t, "", buffer.String(), "file is not created yet")
+}
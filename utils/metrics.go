@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// Buckets of wall time histogram in seconds. toil-cwl-runner of a sample takes hours.
+var WallTimeBucketSeconds = []float64{900, 1800, 3600, 7200, 14400, 28800, 43200, 86400, 172800, 345600}
+
+// bytes read by Md5File in this process
+var checksumBytes int64
+
+func addChecksumBytes(n int64) {
+	atomic.AddInt64(&checksumBytes, n)
+}
+
+/*
+ * Return total bytes of files verified by md5 in this process.
+ */
+func ChecksumBytes() int64 {
+	return atomic.LoadInt64(&checksumBytes)
+}
+
+/*
+ * Write metrics in Prometheus text exposition format.
+ * Sample metrics are derived from the status report, so they are same as `show-job-progress`.
+ * Wall time and exit codes are counted for finished attempts in jobManager directories.
+ */
+func WriteMetrics(w io.Writer, report *StatusReport) {
+	fmt.Fprintln(w, "# HELP jobmanager_samples_total Number of samples in sample sheet.")
+	fmt.Fprintln(w, "# TYPE jobmanager_samples_total gauge")
+	fmt.Fprintf(w, "jobmanager_samples_total %d\n", report.Total)
+
+	fmt.Fprintln(w, "# HELP jobmanager_samples Number of samples by status. not_started samples are queued for execution.")
+	fmt.Fprintln(w, "# TYPE jobmanager_samples gauge")
+	for _, status := range []struct {
+		name  string
+		count int
+	}{
+		{SampleStatusFinished, report.Finished},
+		{SampleStatusStale, report.Stale},
+		{SampleStatusRunning, report.Running},
+		{SampleStatusFailed, report.Failed},
+		{SampleStatusCancelled, report.Cancelled},
+		{SampleStatusNotStarted, report.NotStarted},
+	} {
+		fmt.Fprintf(w, "jobmanager_samples{status=%q} %d\n", status.name, status.count)
+	}
+
+	attempts := 0
+	exitCodeCounts := map[string]int{}
+	successDurations := []float64{}
+	failureDurations := []float64{}
+	for _, sample := range report.Samples {
+		attempts += len(sample.Attempts)
+		for _, attempt := range sample.Attempts {
+			if attempt.ExitCode == "" {
+				// running or killed
+				continue
+			}
+			exitCodeCounts[attempt.ExitCode] += 1
+			if attempt.ExitCode == "0" {
+				successDurations = append(successDurations, float64(attempt.DurationSeconds))
+			} else {
+				failureDurations = append(failureDurations, float64(attempt.DurationSeconds))
+			}
+		}
+	}
+	fmt.Fprintln(w, "# HELP jobmanager_attempts_total Number of toil-cwl-runner executions recorded in jobManager directories.")
+	fmt.Fprintln(w, "# TYPE jobmanager_attempts_total counter")
+	fmt.Fprintf(w, "jobmanager_attempts_total %d\n", attempts)
+
+	fmt.Fprintln(w, "# HELP jobmanager_toil_exit_codes_total Number of finished toil-cwl-runner executions by exit code.")
+	fmt.Fprintln(w, "# TYPE jobmanager_toil_exit_codes_total counter")
+	exitCodes := []string{}
+	for exitCode := range exitCodeCounts {
+		exitCodes = append(exitCodes, exitCode)
+	}
+	sort.Strings(exitCodes)
+	for _, exitCode := range exitCodes {
+		fmt.Fprintf(w, "jobmanager_toil_exit_codes_total{exit_code=%q} %d\n", exitCode, exitCodeCounts[exitCode])
+	}
+
+	fmt.Fprintln(w, "# HELP jobmanager_sample_wall_time_seconds Wall time of finished toil-cwl-runner executions of each sample.")
+	fmt.Fprintln(w, "# TYPE jobmanager_sample_wall_time_seconds histogram")
+	writeHistogram(w, "jobmanager_sample_wall_time_seconds", `result="success"`, WallTimeBucketSeconds, successDurations)
+	writeHistogram(w, "jobmanager_sample_wall_time_seconds", `result="failure"`, WallTimeBucketSeconds, failureDurations)
+}
+
+/*
+ * Write metrics of md5 verification in this process.
+ * Only `run` verifies input files, so this is written by `run --metrics-listen`, not by `serve-status`.
+ */
+func WriteChecksumMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP jobmanager_checksum_bytes_total Bytes of input files verified by md5 in this run process.")
+	fmt.Fprintln(w, "# TYPE jobmanager_checksum_bytes_total counter")
+	fmt.Fprintf(w, "jobmanager_checksum_bytes_total %d\n", ChecksumBytes())
+}
+
+func writeHistogram(w io.Writer, name string, labels string, buckets []float64, values []float64) {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	for _, bucket := range buckets {
+		count := 0
+		for _, value := range values {
+			if value <= bucket {
+				count += 1
+			}
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", name, labels, strconv.FormatFloat(bucket, 'g', -1, 64), count)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, len(values))
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, len(values))
+}
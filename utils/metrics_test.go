@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WriteMetrics(t *testing.T) {
+	report := &StatusReport{
+		Total:      3,
+		Finished:   1,
+		Failed:     1,
+		NotStarted: 1,
+		Samples: []SampleStatus{
+			{SampleId: "XX00001", Status: SampleStatusFinished, Attempts: []AttemptStatus{{ExitCode: "0", DurationSeconds: 3000}, {ExitCode: "1", DurationSeconds: 100}}},
+			{SampleId: "XX00002", Status: SampleStatusFailed, Attempts: []AttemptStatus{{ExitCode: "1", DurationSeconds: 200}, {Killed: true}}},
+			{SampleId: "XX00003", Status: SampleStatusNotStarted},
+		},
+	}
+	var buffer bytes.Buffer
+	WriteMetrics(&buffer, report)
+	metrics := buffer.String()
+	assert.Contains(t, metrics, "jobmanager_samples_total 3\n")
+	assert.Contains(t, metrics, "jobmanager_samples{status=\"not_started\"} 1\n")
+	assert.Contains(t, metrics, "jobmanager_attempts_total 4\n")
+	assert.Contains(t, metrics, "jobmanager_toil_exit_codes_total{exit_code=\"1\"} 2\n")
+	assert.Contains(t, metrics, "jobmanager_sample_wall_time_seconds_bucket{result=\"success\",le=\"1800\"} 0\n")
+	assert.Contains(t, metrics, "jobmanager_sample_wall_time_seconds_bucket{result=\"success\",le=\"3600\"} 1\n")
+	assert.Contains(t, metrics, "jobmanager_sample_wall_time_seconds_bucket{result=\"failure\",le=\"+Inf\"} 2\n")
+	assert.Contains(t, metrics, "jobmanager_sample_wall_time_seconds_sum{result=\"failure\"} 300\n")
+	assert.NotContains(t, metrics, "jobmanager_checksum_bytes_total")
+}
+
+func Test_ChecksumBytes(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "dummy.fq")
+	ioutil.WriteFile(fn, []byte("0123456789"), 0644)
+	before := ChecksumBytes()
+	Md5File(fn)
+	assert.Equal(t, int64(10), ChecksumBytes()-before)
+	var buffer bytes.Buffer
+	WriteChecksumMetrics(&buffer)
+	assert.Contains(t, buffer.String(), "jobmanager_checksum_bytes_total ")
+}
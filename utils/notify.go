@@ -0,0 +1,312 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Events of notification hooks.
+const (
+	NotifyEventSampleSuccess = "sample_success"
+	NotifyEventSampleFailure = "sample_failure"
+	NotifyEventBatchComplete = "batch_complete"
+)
+
+const defaultNotificationTimeoutSeconds = 60
+
+const defaultNotificationSubject = "[JobManager] {{.Event}}{{if .SampleId}} {{.SampleId}}{{end}}"
+
+/*
+ * Notification hook. `notifications` in config file.
+ * Payload is sent by command, webhook and mail, which are specified.
+ */
+type NotificationHook struct {
+	Events         []string `json:"events"`
+	Command        string   `json:"command"`
+	WebhookUrl     string   `json:"webhook_url"`
+	MailTo         []string `json:"mail_to"`
+	MailFrom       string   `json:"mail_from"`
+	SmtpServer     string   `json:"smtp_server"`
+	Sendmail       string   `json:"sendmail"`
+	Subject        string   `json:"subject"`
+	Template       string   `json:"template"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+/*
+ * Counts of samples when the event is fired.
+ */
+type NotificationSummary struct {
+	Total      int `json:"total"`
+	Finished   int `json:"finished"`
+	Stale      int `json:"stale"`
+	Running    int `json:"running"`
+	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+	NotStarted int `json:"not_started"`
+}
+
+/*
+ * Payload of notification. Sample fields are empty for batch_complete.
+ */
+type NotificationEvent struct {
+	Event               string               `json:"event"`
+	Time                string               `json:"time"`
+	Hostname            string               `json:"hostname"`
+	OutputDirectory     string               `json:"output_directory"`
+	SampleId            string               `json:"sample_id,omitempty"`
+	ExitCode            string               `json:"exit_code,omitempty"`
+	Attempts            int                  `json:"attempts,omitempty"`
+	Message             string               `json:"message,omitempty"`
+	JobManagerDirectory string               `json:"jobmanager_directory,omitempty"`
+	StdoutPath          string               `json:"stdout_path,omitempty"`
+	StderrPath          string               `json:"stderr_path,omitempty"`
+	LogPath             string               `json:"log_path,omitempty"`
+	Summary             *NotificationSummary `json:"summary,omitempty"`
+}
+
+func NewNotificationSummary(report *StatusReport) *NotificationSummary {
+	return &NotificationSummary{
+		Total:      report.Total,
+		Finished:   report.Finished,
+		Stale:      report.Stale,
+		Running:    report.Running,
+		Failed:     report.Failed,
+		Cancelled:  report.Cancelled,
+		NotStarted: report.NotStarted,
+	}
+}
+
+/*
+ * Create event of finished sample.
+ */
+func NewSampleNotificationEvent(event string, outputDirectoryPath string, sampleId string, exitCode int, attempts int, jobManagerDirectory string, message string) *NotificationEvent {
+	e := newNotificationEvent(event, outputDirectoryPath)
+	e.SampleId = sampleId
+	e.ExitCode = strconv.Itoa(exitCode)
+	e.Attempts = attempts
+	e.Message = message
+	if jobManagerDirectory != "" {
+		e.JobManagerDirectory, _ = filepath.Abs(jobManagerDirectory)
+		e.StdoutPath = filepath.Join(e.JobManagerDirectory, "toil.stdout.txt")
+		e.StderrPath = filepath.Join(e.JobManagerDirectory, "toil.stderr.txt")
+		e.LogPath = createLogFilePath(e.JobManagerDirectory, sampleId)
+	}
+	return e
+}
+
+func NewBatchNotificationEvent(outputDirectoryPath string, summary *NotificationSummary) *NotificationEvent {
+	e := newNotificationEvent(NotifyEventBatchComplete, outputDirectoryPath)
+	e.Summary = summary
+	return e
+}
+
+func newNotificationEvent(event string, outputDirectoryPath string) *NotificationEvent {
+	hostname, _ := os.Hostname()
+	outputDirectoryAbs, _ := filepath.Abs(outputDirectoryPath)
+	return &NotificationEvent{
+		Event:           event,
+		Time:            GetCurrentTime(),
+		Hostname:        hostname,
+		OutputDirectory: outputDirectoryAbs,
+	}
+}
+
+var notificationTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+/*
+ * Check hooks have destination, known events and valid templates.
+ */
+func ValidateNotificationHooks(hooks []*NotificationHook) error {
+	for i, hook := range hooks {
+		if hook.Command == "" && hook.WebhookUrl == "" && len(hook.MailTo) == 0 {
+			return fmt.Errorf("notifications[%d] has no command, webhook_url and mail_to", i)
+		}
+		for _, event := range hook.Events {
+			if event != NotifyEventSampleSuccess && event != NotifyEventSampleFailure && event != NotifyEventBatchComplete {
+				return fmt.Errorf("notifications[%d] has unknown event [%s]", i, event)
+			}
+		}
+		for _, text := range []string{hook.Template, hook.Subject} {
+			if _, err := template.New("notification").Funcs(notificationTemplateFuncs).Parse(text); err != nil {
+				return fmt.Errorf("notifications[%d] has invalid template: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (hook *NotificationHook) isTarget(event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (hook *NotificationHook) timeout() time.Duration {
+	if hook.TimeoutSeconds <= 0 {
+		return defaultNotificationTimeoutSeconds * time.Second
+	}
+	return time.Duration(hook.TimeoutSeconds) * time.Second
+}
+
+func executeNotificationTemplate(text string, defaultText string, event *NotificationEvent) (string, error) {
+	if text == "" {
+		text = defaultText
+	}
+	t, err := template.New("notification").Funcs(notificationTemplateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	if err := t.Execute(&buffer, event); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+/*
+ * Payload of the hook. If template is not specified, payload is the event in JSON.
+ */
+func (hook *NotificationHook) Payload(event *NotificationEvent) (string, error) {
+	if hook.Template == "" {
+		data, err := json.MarshalIndent(event, "", "  ")
+		return string(data) + "\n", err
+	}
+	return executeNotificationTemplate(hook.Template, "", event)
+}
+
+/*
+ * Fire hooks of the event in config file.
+ * Failure of hook is displayed, and it does not affect execution of samples.
+ */
+func Notify(rss *ReferenceSchema, event *NotificationEvent) {
+	for _, hook := range rss.Notifications {
+		if !hook.isTarget(event.Event) {
+			continue
+		}
+		if err := hook.Fire(event); err != nil {
+			fmt.Printf("Notification of %s %s is failed: %v\n", event.Event, event.SampleId, err)
+		}
+	}
+}
+
+/*
+ * Send payload to command, webhook and mail of the hook.
+ */
+func (hook *NotificationHook) Fire(event *NotificationEvent) error {
+	payload, err := hook.Payload(event)
+	if err != nil {
+		return err
+	}
+	errorMessages := []string{}
+	if hook.Command != "" {
+		if err := hook.runCommand(event, payload); err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("command: %v", err))
+		}
+	}
+	if hook.WebhookUrl != "" {
+		if err := hook.postWebhook(payload); err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("webhook: %v", err))
+		}
+	}
+	if len(hook.MailTo) > 0 {
+		if err := hook.sendMail(event, payload); err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("mail: %v", err))
+		}
+	}
+	if len(errorMessages) > 0 {
+		return fmt.Errorf("%s", strings.Join(errorMessages, ", "))
+	}
+	return nil
+}
+
+func (hook *NotificationHook) runCommand(event *NotificationEvent, payload string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hook.timeout())
+	defer cancel()
+	c := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	c.Stdin = strings.NewReader(payload)
+	c.Env = append(os.Environ(),
+		"JOBMANAGER_EVENT="+event.Event,
+		"JOBMANAGER_SAMPLE_ID="+event.SampleId,
+		"JOBMANAGER_EXIT_CODE="+event.ExitCode,
+		"JOBMANAGER_DIRECTORY="+event.JobManagerDirectory,
+		"JOBMANAGER_OUTPUT_DIRECTORY="+event.OutputDirectory,
+	)
+	output, err := c.CombinedOutput()
+	if len(output) > 0 {
+		fmt.Print(string(output))
+	}
+	return err
+}
+
+func (hook *NotificationHook) postWebhook(payload string) error {
+	contentType := "application/json"
+	if hook.Template != "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	client := &http.Client{Timeout: hook.timeout()}
+	response, err := client.Post(hook.WebhookUrl, contentType, strings.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("%s returns %s", hook.WebhookUrl, response.Status)
+	}
+	return nil
+}
+
+func (hook *NotificationHook) sendMail(event *NotificationEvent, payload string) error {
+	subject, err := executeNotificationTemplate(hook.Subject, defaultNotificationSubject, event)
+	if err != nil {
+		return err
+	}
+	from := hook.MailFrom
+	if from == "" {
+		user := os.Getenv("USER")
+		from = user + "@" + event.Hostname
+	}
+	message := "From: " + from + "\r\n" +
+		"To: " + strings.Join(hook.MailTo, ", ") + "\r\n" +
+		"Subject: " + strings.TrimSpace(subject) + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + payload
+	if hook.SmtpServer != "" {
+		return smtp.SendMail(hook.SmtpServer, nil, from, hook.MailTo, []byte(message))
+	}
+	sendmail := hook.Sendmail
+	if sendmail == "" {
+		sendmail = "sendmail"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hook.timeout())
+	defer cancel()
+	c := exec.CommandContext(ctx, sendmail, append([]string{"-i", "-f", from}, hook.MailTo...)...)
+	c.Stdin = strings.NewReader(message)
+	output, err := c.CombinedOutput()
+	if err != nil && len(output) > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return err
+}
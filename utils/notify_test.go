@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidateNotificationHooks(t *testing.T) {
+	assert.NoError(t, ValidateNotificationHooks([]*NotificationHook{{Command: "true"}}))
+	assert.Error(t, ValidateNotificationHooks([]*NotificationHook{{}}), "no destination")
+	assert.Error(t, ValidateNotificationHooks([]*NotificationHook{{Command: "true", Events: []string{"sample_start"}}}), "unknown event")
+	assert.Error(t, ValidateNotificationHooks([]*NotificationHook{{Command: "true", Template: "{{.SampleId"}}), "invalid template")
+}
+
+func Test_NotificationHook_Payload(t *testing.T) {
+	event := NewSampleNotificationEvent(NotifyEventSampleFailure, "/tmp/out", "XX00001", 1, 2, "/tmp/out/jobManager/20211101145001/XX00001", "")
+	payload, err := (&NotificationHook{}).Payload(event)
+	assert.NoError(t, err)
+	var decoded NotificationEvent
+	assert.NoError(t, json.Unmarshal([]byte(payload), &decoded))
+	assert.Equal(t, "XX00001", decoded.SampleId)
+	assert.Equal(t, "1", decoded.ExitCode)
+	assert.Equal(t, "/tmp/out/jobManager/20211101145001/XX00001/logs/XX00001.log", decoded.LogPath)
+
+	payload, err = (&NotificationHook{Template: "{{.SampleId}} exit {{.ExitCode}} {{json .Attempts}}"}).Payload(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "XX00001 exit 1 2", payload)
+}
+
+func Test_Notify_webhook(t *testing.T) {
+	received := []NotificationEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event NotificationEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received = append(received, event)
+	}))
+	defer server.Close()
+	rss := &ReferenceSchema{Notifications: []*NotificationHook{{Events: []string{NotifyEventBatchComplete}, WebhookUrl: server.URL}}}
+	Notify(rss, NewSampleNotificationEvent(NotifyEventSampleSuccess, "/tmp/out", "XX00001", 0, 1, "", ""))
+	Notify(rss, NewBatchNotificationEvent("/tmp/out", &NotificationSummary{Total: 2, Finished: 1, Failed: 1}))
+	assert.Equal(t, 1, len(received), "sample_success is not target")
+	assert.Equal(t, NotifyEventBatchComplete, received[0].Event)
+	assert.Equal(t, 1, received[0].Summary.Failed)
+}
+
+func Test_NotificationHook_Fire_webhook_error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	err := (&NotificationHook{WebhookUrl: server.URL}).Fire(NewBatchNotificationEvent("/tmp/out", nil))
+	assert.Error(t, err)
+}
+
+func Test_NotificationHook_Fire_command(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "notification.txt")
+	hook := &NotificationHook{Command: "cat > " + outputFile + "; echo $JOBMANAGER_EVENT >> " + outputFile, Template: "{{.SampleId}}\n"}
+	assert.NoError(t, hook.Fire(NewSampleNotificationEvent(NotifyEventSampleSuccess, "/tmp/out", "XX00001", 0, 1, "", "")))
+	raw, _ := ioutil.ReadFile(outputFile)
+	assert.Equal(t, "XX00001\nsample_success\n", string(raw))
+}
+
+func Test_NotificationHook_Fire_sendmail(t *testing.T) {
+	directory := t.TempDir()
+	// sendmail stand-in records arguments and message
+	sendmail := filepath.Join(directory, "sendmail")
+	ioutil.WriteFile(sendmail, []byte("#!/bin/sh\necho \"$@\" > "+directory+"/args.txt\ncat > "+directory+"/message.txt\n"), 0755)
+	hook := &NotificationHook{MailTo: []string{"user@example.com"}, MailFrom: "jobmanager@example.com", Sendmail: sendmail}
+	assert.NoError(t, hook.Fire(NewSampleNotificationEvent(NotifyEventSampleFailure, "/tmp/out", "XX00001", 1, 1, "", "")))
+	args, _ := ioutil.ReadFile(filepath.Join(directory, "args.txt"))
+	assert.Equal(t, "-i -f jobmanager@example.com user@example.com\n", string(args))
+	message, _ := ioutil.ReadFile(filepath.Join(directory, "message.txt"))
+	assert.True(t, strings.Contains(string(message), "Subject: [JobManager] sample_failure XX00001\r\n"))
+	assert.True(t, strings.Contains(string(message), "\"sample_id\": \"XX00001\""))
+}
+
+func Test_ExecCWL_notification_without_toil(t *testing.T) {
+	if IsExistsToilCWLRunner() {
+		t.Skip("toil-cwl-runner is installed")
+	}
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	outputFile := filepath.Join(t.TempDir(), "notification.txt")
+	rss.Notifications = []*NotificationHook{{Command: "cat >> " + outputFile, Template: "{{.Event}} {{.SampleId}} {{.Summary.Total}}\n"}}
+	opts := &ExecOptions{Summary: func() *NotificationSummary { return &NotificationSummary{Total: 2} }}
+	ExecCWL(context.Background(), ss.SampleList[0], rss, GetCurrentTime(), opts)
+	raw, _ := ioutil.ReadFile(outputFile)
+	assert.Equal(t, "sample_failure "+ss.SampleList[0].SampleId+" 2\n", string(raw))
+	os.Remove(outputFile)
+}
@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Manifest of packaged result files, written in delivery directory or output directory.
+const ManifestFileName = "manifest.tsv"
+
+// How result files are placed in delivery directory.
+const (
+	DeliveryModeNone     = "none"
+	DeliveryModeHardlink = "hardlink"
+	DeliveryModeCopy     = "copy"
+)
+
+var manifestHeader = []string{"path", "size", "md5", "sha256"}
+
+/*
+ * Result file in manifest.
+ * Path is relative to the directory of manifest, such as sampleId/sampleId.cram
+ */
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Md5    string `json:"md5"`
+	Sha256 string `json:"sha256"`
+}
+
+/*
+ * Return result files of the sample, relative to output directory.
+ * These are the files checked by CheckAllResultFiles.
+ */
+func ListResultFiles(s *Sample) []string {
+	result := []string{}
+	for _, extension := range ResultFileExtensionsPrefixSampleId {
+		result = append(result, filepath.Join(s.SampleId, s.SampleId+extension))
+	}
+	for _, r := range s.RunList {
+		for _, extension := range ResultFileExtensionsPrefixRunId {
+			result = append(result, filepath.Join(s.SampleId, r.RunId+extension))
+		}
+	}
+	return result
+}
+
+/*
+ * Compute size, md5 and sha256 of the file in one read.
+ */
+func ChecksumFile(fn string) (*ManifestEntry, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), f)
+	if err != nil {
+		return nil, err
+	}
+	addChecksumBytes(written)
+	return &ManifestEntry{
+		Size:   written,
+		Md5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		Sha256: hex.EncodeToString(sha256Hash.Sum(nil)),
+	}, nil
+}
+
+/*
+ * Read manifest. Missing manifest is empty.
+ */
+func ReadManifest(fn string) ([]ManifestEntry, error) {
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return []ManifestEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []ManifestEntry{}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo += 1
+		line := scanner.Text()
+		if lineNo == 1 && line == strings.Join(manifestHeader, "\t") || line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != len(manifestHeader) {
+			return nil, fmt.Errorf("%s:%d: invalid manifest line", fn, lineNo)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid size [%s]", fn, lineNo, fields[1])
+		}
+		entries = append(entries, ManifestEntry{Path: fields[0], Size: size, Md5: fields[2], Sha256: fields[3]})
+	}
+	return entries, scanner.Err()
+}
+
+/*
+ * Write manifest sorted by path.
+ * Written to temporary file and renamed, so the manifest is not broken by interruption.
+ */
+func WriteManifest(fn string, entries []ManifestEntry) error {
+	sorted := append([]ManifestEntry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Path < sorted[j].Path
+	})
+	tmp := fn + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, strings.Join(manifestHeader, "\t"))
+	for _, entry := range sorted {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", entry.Path, entry.Size, entry.Md5, entry.Sha256)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+/*
+ * Replace entries of the samples in manifest.
+ */
+func MergeManifest(entries []ManifestEntry, sampleIds []string, sampleEntries []ManifestEntry) []ManifestEntry {
+	replaced := map[string]bool{}
+	for _, sampleId := range sampleIds {
+		replaced[sampleId] = true
+	}
+	result := []ManifestEntry{}
+	for _, entry := range entries {
+		if !replaced[strings.SplitN(filepath.ToSlash(entry.Path), "/", 2)[0]] {
+			result = append(result, entry)
+		}
+	}
+	return append(result, sampleEntries...)
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+/*
+ * Place the result file in delivery directory.
+ * Hard link falls back to copy, e.g. delivery directory is on another file system.
+ */
+func DeliverFile(src string, dst string, mode string) error {
+	if mode == DeliveryModeNone {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if srcInfo, err := os.Stat(src); err == nil {
+		if dstInfo, err := os.Stat(dst); err == nil && os.SameFile(srcInfo, dstInfo) {
+			return nil
+		}
+	}
+	if mode == DeliveryModeHardlink {
+		os.Remove(dst)
+		if err := os.Link(src, dst); err == nil {
+			return nil
+		}
+	}
+	return copyFile(src, dst)
+}
+
+/*
+ * Compute checksums of result files of the sample, and place them in delivery directory.
+ * Return value: manifest entries relative to delivery directory.
+ */
+func PackageSample(outputDirectoryPath string, s *Sample, deliveryDirectoryPath string, mode string) ([]ManifestEntry, error) {
+	entries := []ManifestEntry{}
+	for _, resultFile := range ListResultFiles(s) {
+		src := filepath.Join(outputDirectoryPath, resultFile)
+		entry, err := ChecksumFile(src)
+		if err != nil {
+			return nil, err
+		}
+		entry.Path = filepath.ToSlash(resultFile)
+		if err := DeliverFile(src, filepath.Join(deliveryDirectoryPath, resultFile), mode); err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+/*
+ * Verify files in manifest. Paths are relative to rootDirectoryPath.
+ * If checksum is false, only existence and size are checked.
+ * Return value: problems found, one for each invalid file. Empty if all files are valid.
+ */
+func VerifyManifest(rootDirectoryPath string, entries []ManifestEntry, checksum bool) []string {
+	problems := []string{}
+	for _, entry := range entries {
+		fn := filepath.Join(rootDirectoryPath, filepath.FromSlash(entry.Path))
+		fileinfo, err := os.Stat(fn)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Missing file [%s]", fn))
+			continue
+		}
+		if fileinfo.Size() != entry.Size {
+			problems = append(problems, fmt.Sprintf("Size is not match [%s] expected: %d actual: %d", fn, entry.Size, fileinfo.Size()))
+			continue
+		}
+		if !checksum {
+			continue
+		}
+		actual, err := ChecksumFile(fn)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if actual.Md5 != entry.Md5 || actual.Sha256 != entry.Sha256 {
+			problems = append(problems, fmt.Sprintf("Checksum is not match [%s] expected: %s %s actual: %s %s", fn, entry.Md5, entry.Sha256, actual.Md5, actual.Sha256))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestResultFiles(t *testing.T, outputDirectoryPath string, s *Sample) {
+	for _, resultFile := range ListResultFiles(s) {
+		fn := filepath.Join(outputDirectoryPath, resultFile)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, []byte(filepath.Base(fn)+"\n"), 0644))
+	}
+}
+
+func Test_ListResultFiles(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	s := ss.SampleList[0]
+	resultFiles := ListResultFiles(s)
+	assert.Equal(t, len(ResultFileExtensionsPrefixSampleId)+len(s.RunList)*len(ResultFileExtensionsPrefixRunId), len(resultFiles))
+	assert.Contains(t, resultFiles, filepath.Join(s.SampleId, s.SampleId+".cram"))
+	assert.Contains(t, resultFiles, filepath.Join(s.SampleId, s.RunList[0].RunId+".bam"))
+	createTestResultFiles(t, rss.OutputDirectory.Path, s)
+	assert.True(t, CheckAllResultFiles(rss.OutputDirectory.Path, s), "same files as CheckAllResultFiles")
+}
+
+func Test_ChecksumFile(t *testing.T) {
+	entry, err := ChecksumFile("../test/testfile.txt")
+	assert.NoError(t, err)
+	md5, _ := Md5File("../test/testfile.txt")
+	assert.Equal(t, md5, entry.Md5)
+	assert.Equal(t, 64, len(entry.Sha256))
+}
+
+func Test_Manifest(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), ManifestFileName)
+	entries, err := ReadManifest(fn)
+	assert.NoError(t, err)
+	assert.Equal(t, []ManifestEntry{}, entries, "missing manifest is empty")
+	entries = []ManifestEntry{
+		{Path: "XX00002/XX00002.cram", Size: 10, Md5: "m2", Sha256: "s2"},
+		{Path: "XX00001/XX00001.cram", Size: 20, Md5: "m1", Sha256: "s1"},
+	}
+	assert.NoError(t, WriteManifest(fn, entries))
+	read, err := ReadManifest(fn)
+	assert.NoError(t, err)
+	assert.Equal(t, []ManifestEntry{entries[1], entries[0]}, read, "sorted by path")
+
+	merged := MergeManifest(read, []string{"XX00002"}, []ManifestEntry{{Path: "XX00002/XX00002.cram", Size: 30, Md5: "m3", Sha256: "s3"}})
+	assert.Equal(t, []ManifestEntry{entries[1], {Path: "XX00002/XX00002.cram", Size: 30, Md5: "m3", Sha256: "s3"}}, merged)
+
+	ioutil.WriteFile(fn, []byte("path\tsize\nbroken\n"), 0644)
+	_, err = ReadManifest(fn)
+	assert.Error(t, err)
+}
+
+func Test_PackageSample_and_VerifyManifest(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	out := rss.OutputDirectory.Path
+	s := ss.SampleList[0]
+	createTestResultFiles(t, out, s)
+	for _, mode := range []string{DeliveryModeHardlink, DeliveryModeCopy} {
+		delivery := t.TempDir()
+		entries, err := PackageSample(out, s, delivery, mode)
+		assert.NoError(t, err)
+		assert.Equal(t, len(ListResultFiles(s)), len(entries))
+		assert.Equal(t, []string{}, VerifyManifest(delivery, entries, true), mode)
+
+		cram := filepath.Join(delivery, s.SampleId, s.SampleId+".cram")
+		srcInfo, _ := os.Stat(filepath.Join(out, s.SampleId, s.SampleId+".cram"))
+		dstInfo, _ := os.Stat(cram)
+		assert.Equal(t, mode == DeliveryModeHardlink, os.SameFile(srcInfo, dstInfo), mode)
+		if mode == DeliveryModeCopy {
+			// same size, different content
+			ioutil.WriteFile(cram, []byte("XXXXXXXXXXXX\n"), 0644)
+			os.Remove(filepath.Join(delivery, s.SampleId, s.SampleId+".cram.crai"))
+			problems := VerifyManifest(delivery, entries, true)
+			assert.Equal(t, 2, len(problems), problems)
+			assert.Equal(t, 1, len(VerifyManifest(delivery, entries, false)), "size only")
+		}
+	}
+
+	entries, err := PackageSample(out, s, out, DeliveryModeNone)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, VerifyManifest(out, entries, true))
+}
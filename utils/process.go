@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// File in job manager directory, created when the execution is cancelled.
+const CancelledFileName = "jobmanager.cancelled.txt"
+
+// File in job manager directory, records running toil-cwl-runner process.
+const ProcessFileName = "jobmanager.process.json"
+
+// File in job manager directory, records Slurm job ids submitted by toil-cwl-runner.
+const SlurmJobIdsFileName = "slurm_job_ids.txt"
+
+/*
+ * toil-cwl-runner process started by JobManager.
+ * toil-cwl-runner is the leader of its own process group, so Pgid is same as Pid.
+ * Pid and Pgid are 0 until toil-cwl-runner is started.
+ */
+type ProcessRecord struct {
+	Pid           int    `json:"pid"`
+	Pgid          int    `json:"pgid"`
+	Hostname      string `json:"hostname"`
+	JobManagerPid int    `json:"jobmanager_pid"`
+	StartedAt     string `json:"started_at"`
+	HeartbeatAt   string `json:"heartbeat_at"`
+}
+
+func WriteProcessRecord(jobManagerDirectory string, record *ProcessRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(jobManagerDirectory, ProcessFileName), data, 0644)
+}
+
+func ReadProcessRecord(jobManagerDirectory string) (*ProcessRecord, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(jobManagerDirectory, ProcessFileName))
+	if err != nil {
+		return nil, err
+	}
+	var record ProcessRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+/*
+ * Check any process in the process group is running on this host.
+ */
+func IsProcessGroupAlive(pgid int) bool {
+	err := SignalProcessGroup(pgid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// Directory in job manager directory, has sbatch wrapper which records Slurm job ids.
+const SlurmWrapperDirectoryName = "bin"
+
+// Wrapper of sbatch. Job id is in sbatch output, "Submitted batch job <id>" or "<id>[;<cluster>]" with --parsable.
+const sbatchWrapperTemplate = `#!/bin/sh
+# Written by JobManager. Record Slurm job ids submitted by toil-cwl-runner.
+out=$(%s "$@")
+status=$?
+[ -n "$out" ] && printf '%%s\n' "$out"
+if [ $status -eq 0 ]; then
+	printf '%%s\n' "$out" | sed -n -e 's/^Submitted batch job \([0-9][0-9]*\).*$/\1/p' -e 's/^\([0-9][0-9]*\)\(;.*\)\{0,1\}$/\1/p' >> %s
+fi
+exit $status
+`
+
+// quote for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+/*
+ * Write sbatch wrapper in jobManagerDirectory/bin, which executes sbatch and appends submitted job id to Slurm job ids file.
+ * toil-cwl-runner uses the wrapper if the directory is the first of PATH,
+ * so job ids of the sample are recorded while it is running.
+ * Return value: directory of the wrapper
+ */
+func WriteSbatchWrapper(jobManagerDirectory string) (string, error) {
+	sbatch, err := exec.LookPath("sbatch")
+	if err != nil {
+		return "", err
+	}
+	if sbatch, err = filepath.Abs(sbatch); err != nil {
+		return "", err
+	}
+	dir, err := filepath.Abs(filepath.Join(jobManagerDirectory, SlurmWrapperDirectoryName))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	slurmJobIdsFile := filepath.Join(filepath.Dir(dir), SlurmJobIdsFileName)
+	script := fmt.Sprintf(sbatchWrapperTemplate, shellQuote(sbatch), shellQuote(slurmJobIdsFile))
+	if err := ioutil.WriteFile(filepath.Join(dir, "sbatch"), []byte(script), 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+/*
+ * Slurm job ids of the sample, recorded by sbatch wrapper.
+ * Return value: unique and sorted job ids. empty if not recorded.
+ */
+func ReadSlurmJobIds(jobManagerDirectory string) []string {
+	found := map[string]bool{}
+	raw, err := ioutil.ReadFile(filepath.Join(jobManagerDirectory, SlurmJobIdsFileName))
+	if err == nil {
+		for _, line := range strings.Split(string(raw), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				found[line] = true
+			}
+		}
+	}
+	result := []string{}
+	for jobId := range found {
+		result = append(result, jobId)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// process group ids of running toil-cwl-runner
+var runningProcessGroups = struct {
+	sync.Mutex
+	pgids map[int]bool
+}{pgids: map[int]bool{}}
+
+func registerProcessGroup(pgid int) {
+	runningProcessGroups.Lock()
+	defer runningProcessGroups.Unlock()
+	runningProcessGroups.pgids[pgid] = true
+}
+
+func unregisterProcessGroup(pgid int) {
+	runningProcessGroups.Lock()
+	defer runningProcessGroups.Unlock()
+	delete(runningProcessGroups.pgids, pgid)
+}
+
+/*
+ * Send signal to all processes in the process group.
+ */
+func SignalProcessGroup(pgid int, sig syscall.Signal) error {
+	if pgid <= 0 {
+		// kill(0) sends signal to JobManager itself
+		return fmt.Errorf("invalid process group id [%d]", pgid)
+	}
+	return syscall.Kill(-pgid, sig)
+}
+
+/*
+ * Kill all running toil-cwl-runner and their children.
+ * This is used when user sends signal again while waiting cancellation.
+ */
+func KillRunningProcessGroups() {
+	runningProcessGroups.Lock()
+	defer runningProcessGroups.Unlock()
+	for pgid := range runningProcessGroups.pgids {
+		fmt.Printf("Kill process group [%d]\n", pgid)
+		SignalProcessGroup(pgid, syscall.SIGKILL)
+	}
+}
+
+/*
+ * Start command in its own process group and wait.
+ * When ctx is cancelled, SIGTERM is sent to the process group,
+ * and SIGKILL is sent if it is still running after cancelTimeout.
+ * Return value: true if ctx is cancelled while running.
+ */
+func startAndWaitProcessGroup(ctx context.Context, c *exec.Cmd, cancelTimeout time.Duration, started func(pgid int)) (bool, error) {
+	// own process group, so signals from terminal are not sent directly to toil
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := c.Start(); err != nil {
+		return false, err
+	}
+	pgid := c.Process.Pid
+	registerProcessGroup(pgid)
+	defer unregisterProcessGroup(pgid)
+	if started != nil {
+		started(pgid)
+	}
+
+	finished := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-finished:
+			cancelled <- false
+		case <-ctx.Done():
+			SignalProcessGroup(pgid, syscall.SIGTERM)
+			cancelled <- true
+			if cancelTimeout > 0 {
+				select {
+				case <-finished:
+				case <-time.After(cancelTimeout):
+					fmt.Printf("Process group [%d] is still running after %s. Kill it\n", pgid, cancelTimeout)
+					SignalProcessGroup(pgid, syscall.SIGKILL)
+				}
+			}
+		}
+	}()
+	c.Wait()
+	close(finished)
+	return <-cancelled, nil
+}
+
+/*
+ * Send SIGTERM to the process group and wait until all processes are finished.
+ * If still running after timeout, SIGKILL is sent.
+ * Return value: true if the process group is stopped
+ */
+func StopProcessGroup(pgid int, timeout time.Duration) bool {
+	if err := SignalProcessGroup(pgid, syscall.SIGTERM); err != nil {
+		return !IsProcessGroupAlive(pgid)
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !IsProcessGroupAlive(pgid) {
+			return true
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	fmt.Printf("Process group [%d] is still running after %s. Kill it\n", pgid, timeout)
+	SignalProcessGroup(pgid, syscall.SIGKILL)
+	time.Sleep(200 * time.Millisecond)
+	return !IsProcessGroupAlive(pgid)
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_startAndWaitProcessGroup_finished(t *testing.T) {
+	c := exec.Command("sh", "-c", "exit 3")
+	cancelled, err := startAndWaitProcessGroup(context.Background(), c, time.Second, nil)
+	assert.NoError(t, err)
+	assert.False(t, cancelled, "process is finished without cancel")
+	assert.Equal(t, 3, c.ProcessState.ExitCode())
+}
+
+func Test_startAndWaitProcessGroup_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := exec.Command("sleep", "30")
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	cancelled, err := startAndWaitProcessGroup(ctx, c, 10*time.Second, nil)
+	assert.NoError(t, err)
+	assert.True(t, cancelled, "SIGTERM is sent by cancel")
+	assert.True(t, time.Since(start) < 10*time.Second, "sleep is stopped by SIGTERM")
+}
+
+func Test_startAndWaitProcessGroup_killed_after_timeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// ignore SIGTERM
+	c := exec.Command("sh", "-c", "trap '' TERM; sleep 30")
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	cancelled, err := startAndWaitProcessGroup(ctx, c, 500*time.Millisecond, nil)
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+	assert.True(t, time.Since(start) < 10*time.Second, "process group is killed after timeout")
+}
+
+func Test_KillRunningProcessGroups(t *testing.T) {
+	c := exec.Command("sh", "-c", "trap '' TERM; sleep 30")
+	time.AfterFunc(100*time.Millisecond, KillRunningProcessGroups)
+	start := time.Now()
+	cancelled, err := startAndWaitProcessGroup(context.Background(), c, 0, nil)
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+	assert.Equal(t, -1, c.ProcessState.ExitCode(), "killed by signal")
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
+
+func Test_ProcessRecord_write_and_read(t *testing.T) {
+	jobManagerDirectory := t.TempDir()
+	WriteProcessRecord(jobManagerDirectory, &ProcessRecord{Pid: 123, Pgid: 123, Hostname: "node1", JobManagerPid: 100, StartedAt: "20211101145001"})
+	record, err := ReadProcessRecord(jobManagerDirectory)
+	assert.NoError(t, err)
+	assert.Equal(t, 123, record.Pgid)
+	assert.Equal(t, "node1", record.Hostname)
+}
+
+func Test_WriteSbatchWrapper(t *testing.T) {
+	// fake sbatch which prints job id like `sbatch --parsable` or `sbatch`
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$1" in
+--parsable) echo "1002;cluster" ;;
+--fail) echo "sbatch: error: invalid partition" >&2; exit 1 ;;
+*) echo "Submitted batch job 1001" ;;
+esac
+`
+	ioutil.WriteFile(filepath.Join(dir, "sbatch"), []byte(script), 0755)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	jobManagerDirectory := t.TempDir()
+	assert.Equal(t, []string{}, ReadSlurmJobIds(jobManagerDirectory), "not recorded")
+	wrapperDirectory, err := WriteSbatchWrapper(jobManagerDirectory)
+	assert.NoError(t, err)
+	out, err := exec.Command(filepath.Join(wrapperDirectory, "sbatch"), "--parsable").Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "1002;cluster\n", string(out), "output of sbatch is passed to toil")
+	_, err = exec.Command(filepath.Join(wrapperDirectory, "sbatch"), "job.sh").Output()
+	assert.NoError(t, err)
+	_, err = exec.Command(filepath.Join(wrapperDirectory, "sbatch"), "job.sh").Output()
+	assert.NoError(t, err)
+	_, err = exec.Command(filepath.Join(wrapperDirectory, "sbatch"), "--fail").Output()
+	assert.Error(t, err, "exit status of sbatch is kept")
+	assert.Equal(t, []string{"1001", "1002"}, ReadSlurmJobIds(jobManagerDirectory), "unique and sorted")
+}
+
+func Test_StopProcessGroup(t *testing.T) {
+	c := exec.Command("sleep", "30")
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	assert.NoError(t, c.Start())
+	go c.Wait()
+	assert.True(t, IsProcessGroupAlive(c.Process.Pid))
+	result := StopProcessGroup(c.Process.Pid, 5*time.Second)
+	assert.True(t, result, "process group is stopped")
+}
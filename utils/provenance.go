@@ -0,0 +1,372 @@
+package utils
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RO-Crate metadata file, written in result directory of the sample.
+const RoCrateMetadataFileName = "ro-crate-metadata.json"
+
+// Directory in result directory where job file, sample sheet and config file are copied.
+const ProvenanceDirectoryName = "provenance"
+
+const roCrateContext = "https://w3id.org/ro/crate/1.1/context"
+const roCrateConformsTo = "https://w3id.org/ro/crate/1.1"
+
+/*
+ * Container image in container_cache_directory.
+ * Digest is image ID in manifest.json of `docker save` tar, or sha256 of Singularity image file.
+ */
+type ContainerImage struct {
+	File   string   `json:"file"`
+	Tags   []string `json:"tags"`
+	Digest string   `json:"digest"`
+}
+
+/*
+ * Read image ID and tags of `docker save` tar.
+ */
+func readDockerSaveManifest(fn string) (string, []string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	reader := tar.NewReader(f)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return "", nil, fmt.Errorf("[%s] has no manifest.json", fn)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if header.Name != "manifest.json" {
+			continue
+		}
+		var manifest []struct {
+			Config   string
+			RepoTags []string
+		}
+		if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+			return "", nil, err
+		}
+		if len(manifest) == 0 {
+			return "", nil, fmt.Errorf("[%s] has empty manifest.json", fn)
+		}
+		// Config is <image id>.json or blobs/sha256/<image id>
+		config := strings.TrimSuffix(filepath.Base(manifest[0].Config), ".json")
+		return "sha256:" + config, manifest[0].RepoTags, nil
+	}
+}
+
+/*
+ * Collect cached files of the images, which are saved by pull-container-images.
+ * Images are dockerPull of the workflow, so other images in container_cache_directory are not collected.
+ * Return value: cached images, and images which are not cached in any format
+ */
+func CollectContainerImages(containerCacheDirectoryPath string, images []string) ([]ContainerImage, []string) {
+	result := []ContainerImage{}
+	entries, missing := CachedImageEntries(containerCacheDirectoryPath, images)
+	for _, entry := range entries {
+		fn := filepath.Join(containerCacheDirectoryPath, entry.File)
+		image := ContainerImage{File: fn, Tags: []string{entry.Image}}
+		switch entry.Format {
+		case ContainerImageFormatDocker:
+			digest, tags, err := readDockerSaveManifest(fn)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			image.Digest = digest
+			if tags != nil {
+				image.Tags = tags
+			}
+		default:
+			digest, err := Sha256File(fn)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			image.Digest = "sha256:" + digest
+		}
+		result = append(result, image)
+	}
+	return result, missing
+}
+
+/*
+ * Inputs of provenance which are common to all samples.
+ */
+type ProvenanceOptions struct {
+	// sample sheet and config file copied to output directory by `run`
+	SampleSheetFile string
+	ConfigFile      string
+	ContainerImages []ContainerImage
+	// dockerPull of the workflow which is not cached, so its digest is unknown
+	MissingContainerImages []string
+	// compute md5 and sha256 of result files
+	Checksum bool
+}
+
+type roCrateEntity map[string]interface{}
+
+func roCrateId(id string) map[string]string {
+	return map[string]string{"@id": id}
+}
+
+func roCrateIds(ids []string) []map[string]string {
+	result := []map[string]string{}
+	for _, id := range ids {
+		result = append(result, roCrateId(id))
+	}
+	return result
+}
+
+// file outside of RO-Crate is identified by absolute file URI
+func fileURI(fn string) string {
+	if strings.Contains(fn, "://") {
+		return fn
+	}
+	if abs, err := filepath.Abs(fn); err == nil {
+		fn = abs
+	}
+	return "file://" + filepath.ToSlash(fn)
+}
+
+// YYYYMMDDhhmmss of job manager directory to ISO 8601
+func jobManagerTimeToISO8601(t string) string {
+	parsed, err := time.ParseInLocation("20060102150405", t, time.Local)
+	if err != nil {
+		return ""
+	}
+	return parsed.Format(time.RFC3339)
+}
+
+/*
+ * Return the latest execution of the sample which toil-cwl-runner is successfully finished.
+ */
+func latestSuccessfulAttempt(outputDirectoryPath string, sampleId string) string {
+	for _, jobManagerDirectory := range ListSampleAttemptDirectories(outputDirectoryPath, sampleId) {
+		if GetExitCodeContent(filepath.Join(jobManagerDirectory, "toil.exitcode.txt")) == "0" {
+			return jobManagerDirectory
+		}
+	}
+	return ""
+}
+
+func copyToProvenanceDirectory(src string, provenanceDirectory string) (string, error) {
+	dst := filepath.Join(provenanceDirectory, filepath.Base(src))
+	if err := copyFile(src, dst); err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(filepath.Join(ProvenanceDirectoryName, filepath.Base(src))), nil
+}
+
+/*
+ * Write RO-Crate metadata of the sample in its result directory.
+ * Job file of the latest successful execution, sample sheet and config file are copied to provenance directory.
+ * If successful execution is not found, job file is not recorded.
+ * Return value: path of RO-Crate metadata file.
+ */
+func ExportProvenance(outputDirectoryPath string, s *Sample, rss *ReferenceSchema, opts *ProvenanceOptions) (string, error) {
+	resultDirectory := filepath.Join(outputDirectoryPath, s.SampleId)
+	provenanceDirectory := filepath.Join(resultDirectory, ProvenanceDirectoryName)
+	if err := os.MkdirAll(provenanceDirectory, 0755); err != nil {
+		return "", err
+	}
+	graph := []roCrateEntity{}
+	hasPart := []string{}
+
+	// workflow and the tool which executed it
+	// If fingerprint is not recorded, e.g. results are created by old version, workflow digest and version are unknown.
+	// Current workflow and version are not used, because they may be different from what created the results.
+	fingerprint, _ := ReadFingerprint(ResultFingerprintFilePath(outputDirectoryPath, s.SampleId))
+	if fingerprint == nil {
+		fingerprint = &Fingerprint{}
+	}
+	workflowId := fileURI(rss.WorkflowFile.Path)
+	workflow := roCrateEntity{
+		"@id":                 workflowId,
+		"@type":               []string{"File", "SoftwareSourceCode", "ComputationalWorkflow"},
+		"name":                filepath.Base(rss.WorkflowFile.Path),
+		"programmingLanguage": roCrateId("#cwl"),
+	}
+	if fingerprint.WorkflowFileDigest != "" {
+		workflow["identifier"] = fingerprint.WorkflowFileDigest
+	} else {
+		workflow["description"] = "Digest of the workflow which created the results is not recorded"
+	}
+	jobManager := roCrateEntity{
+		"@id":   "#jobmanager",
+		"@type": "SoftwareApplication",
+		"name":  "jgaworkflowspecchecker",
+	}
+	if fingerprint.ToolVersion != "" {
+		jobManager["version"] = fingerprint.ToolVersion
+	} else {
+		jobManager["description"] = "Version which created the results is not recorded"
+	}
+	graph = append(graph, workflow, roCrateEntity{
+		"@id":   "#cwl",
+		"@type": "ComputerLanguage",
+		"name":  "Common Workflow Language",
+		"url":   roCrateId("https://www.commonwl.org/"),
+	}, jobManager)
+	instruments := []string{workflowId, "#jobmanager"}
+	for i, image := range opts.ContainerImages {
+		id := fmt.Sprintf("#container-%d", i+1)
+		instruments = append(instruments, id)
+		graph = append(graph, roCrateEntity{
+			"@id":        id,
+			"@type":      "ContainerImage",
+			"name":       filepath.Base(image.File),
+			"tag":        image.Tags,
+			"identifier": image.Digest,
+		})
+	}
+
+	for i, image := range opts.MissingContainerImages {
+		id := fmt.Sprintf("#container-%d", len(opts.ContainerImages)+i+1)
+		instruments = append(instruments, id)
+		graph = append(graph, roCrateEntity{
+			"@id":         id,
+			"@type":       "ContainerImage",
+			"name":        image,
+			"tag":         []string{image},
+			"description": "Image is not cached in container_cache_directory, so its digest is unknown",
+		})
+	}
+
+	// inputs
+	objects := []string{}
+	jobManagerDirectory := latestSuccessfulAttempt(outputDirectoryPath, s.SampleId)
+	if jobManagerDirectory != "" {
+		id, err := copyToProvenanceDirectory(filepath.Join(jobManagerDirectory, "job-file.yaml"), provenanceDirectory)
+		if err != nil {
+			return "", err
+		}
+		objects = append(objects, id)
+		hasPart = append(hasPart, id)
+		graph = append(graph, roCrateEntity{"@id": id, "@type": "File", "name": "CWL job file", "encodingFormat": "application/yaml"})
+	}
+	for _, f := range []struct {
+		name string
+		fn   string
+	}{{"Sample sheet", opts.SampleSheetFile}, {"Config file", opts.ConfigFile}} {
+		if f.fn == "" {
+			continue
+		}
+		id, err := copyToProvenanceDirectory(f.fn, provenanceDirectory)
+		if err != nil {
+			return "", err
+		}
+		hasPart = append(hasPart, id)
+		graph = append(graph, roCrateEntity{"@id": id, "@type": "File", "name": f.name, "encodingFormat": "application/json"})
+	}
+	for _, r := range s.RunList {
+		for _, fastq := range []struct {
+			path string
+			md5  string
+		}{{r.FQ1, r.FQ1_MD5}, {r.FQ2, r.FQ2_MD5}} {
+			if fastq.path == "" {
+				continue
+			}
+			entity := roCrateEntity{"@id": fileURI(fastq.path), "@type": "File", "name": r.RunId + " " + filepath.Base(fastq.path)}
+			if fastq.md5 != "" {
+				entity["md5"] = fastq.md5
+			}
+			objects = append(objects, fileURI(fastq.path))
+			graph = append(graph, entity)
+		}
+	}
+	references := []*PathOnlyObject{rss.Reference, rss.Dbsnp, rss.Mills, rss.KnownIndels}
+	for _, reference := range references {
+		if reference == nil || reference.Path == "" {
+			continue
+		}
+		entity := roCrateEntity{"@id": fileURI(reference.Path), "@type": "File", "name": filepath.Base(reference.Path)}
+		if fileinfo, err := os.Stat(reference.Path); err == nil {
+			entity["contentSize"] = fileinfo.Size()
+			entity["dateModified"] = fileinfo.ModTime().Format(time.RFC3339)
+		}
+		objects = append(objects, fileURI(reference.Path))
+		graph = append(graph, entity)
+	}
+
+	// outputs
+	results := []string{}
+	for _, resultFile := range ListResultFiles(s) {
+		fn := filepath.Join(outputDirectoryPath, resultFile)
+		id, _ := filepath.Rel(resultDirectory, fn)
+		id = filepath.ToSlash(id)
+		entity := roCrateEntity{"@id": id, "@type": "File"}
+		if opts.Checksum {
+			checksum, err := ChecksumFile(fn)
+			if err != nil {
+				return "", err
+			}
+			entity["contentSize"] = checksum.Size
+			entity["md5"] = checksum.Md5
+			entity["sha256"] = checksum.Sha256
+		} else if fileinfo, err := os.Stat(fn); err == nil {
+			entity["contentSize"] = fileinfo.Size()
+		}
+		results = append(results, id)
+		hasPart = append(hasPart, id)
+		graph = append(graph, entity)
+	}
+
+	action := roCrateEntity{
+		"@id":        "#run-" + s.SampleId,
+		"@type":      "CreateAction",
+		"name":       "Execution of " + filepath.Base(rss.WorkflowFile.Path) + " for " + s.SampleId,
+		"instrument": roCrateIds(instruments),
+		"object":     roCrateIds(objects),
+		"result":     roCrateIds(results),
+	}
+	if jobManagerDirectory != "" {
+		attempt := CollectAttemptStatus(jobManagerDirectory)
+		action["startTime"] = jobManagerTimeToISO8601(attempt.StartedAt)
+		action["endTime"] = jobManagerTimeToISO8601(attempt.FinishedAt)
+	} else {
+		// job file created from current config may be different from what created the results
+		action["description"] = "Successful execution is not found, so job file and execution time are unknown"
+	}
+	graph = append(graph, action)
+
+	sort.Strings(hasPart)
+	root := roCrateEntity{
+		"@id":           "./",
+		"@type":         "Dataset",
+		"name":          "Results of " + s.SampleId,
+		"datePublished": time.Now().Format(time.RFC3339),
+		"hasPart":       roCrateIds(hasPart),
+		"mainEntity":    roCrateId(workflowId),
+		"mentions":      roCrateId("#run-" + s.SampleId),
+	}
+	metadata := roCrateEntity{
+		"@id":        RoCrateMetadataFileName,
+		"@type":      "CreativeWork",
+		"conformsTo": roCrateId(roCrateConformsTo),
+		"about":      roCrateId("./"),
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"@context": roCrateContext,
+		"@graph":   append([]roCrateEntity{metadata, root}, graph...),
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	fn := filepath.Join(resultDirectory, RoCrateMetadataFileName)
+	return fn, ioutil.WriteFile(fn, data, 0644)
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestDockerSave(t *testing.T, fn string, manifest string) {
+	f, err := os.Create(fn)
+	assert.NoError(t, err)
+	defer f.Close()
+	w := tar.NewWriter(f)
+	w.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(manifest))})
+	w.Write([]byte(manifest))
+	assert.NoError(t, w.Close())
+}
+
+func Test_CollectContainerImages(t *testing.T) {
+	dir := t.TempDir()
+	bwa := "quay.io/biocontainers/bwa:0.7.17--pl5.22.0_2"
+	samtools := "quay.io/biocontainers/samtools:1.10--h2e538c0_3"
+	gatk := "broadinstitute/gatk:4.1.0.0"
+	createTestDockerSave(t, filepath.Join(dir, CachedImageFileName(samtools, ContainerImageFormatDocker)), `[{"Config":"0123abcd.json","RepoTags":["quay.io/biocontainers/samtools:1.10--h2e538c0_3"],"Layers":[]}]`)
+	ioutil.WriteFile(filepath.Join(dir, CachedImageFileName(bwa, ContainerImageFormatSingularity)), []byte("dummy sif"), 0644)
+	// image which is not used by the workflow is not collected
+	ioutil.WriteFile(filepath.Join(dir, "quay.io_biocontainers_other.sif"), []byte("other sif"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not image"), 0644)
+	images, missing := CollectContainerImages(dir, []string{bwa, samtools, gatk})
+	assert.Equal(t, 2, len(images))
+	sha256, _ := Sha256File(filepath.Join(dir, CachedImageFileName(bwa, ContainerImageFormatSingularity)))
+	assert.Equal(t, "sha256:"+sha256, images[0].Digest)
+	assert.Equal(t, []string{bwa}, images[0].Tags)
+	assert.Equal(t, "sha256:0123abcd", images[1].Digest)
+	assert.Equal(t, []string{samtools}, images[1].Tags)
+	assert.Equal(t, []string{gatk}, missing)
+}
+
+func Test_ExportProvenance(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	out := rss.OutputDirectory.Path
+	s := ss.SampleList[0]
+	createTestResultFiles(t, out, s)
+	attemptDirectory := createTestAttempt(t, out, "20211101143242", s.SampleId, "0", false)
+	ioutil.WriteFile(filepath.Join(attemptDirectory, "job-file.yaml"), []byte("reference:\n"), 0644)
+	fingerprint, err := CreateFingerprint(s, rss, "Version: 1.0.0-abc (built at 2021-11-01)")
+	assert.NoError(t, err)
+	assert.NoError(t, WriteFingerprint(ResultFingerprintFilePath(out, s.SampleId), fingerprint))
+
+	fn, err := ExportProvenance(out, s, rss, &ProvenanceOptions{
+		SampleSheetFile:        "../test/datafiles/samplesheet_2run-test.json",
+		ConfigFile:             "../test/datafiles/configfile_1run-test.json",
+		ContainerImages:        []ContainerImage{{File: "/cache/bwa.sif", Tags: []string{}, Digest: "sha256:0123"}},
+		MissingContainerImages: []string{"broadinstitute/gatk:4.1.0.0"},
+		Checksum:               true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(out, s.SampleId, RoCrateMetadataFileName), fn)
+	for _, copied := range []string{"job-file.yaml", "samplesheet_2run-test.json", "configfile_1run-test.json"} {
+		assert.True(t, IsExistsFile(filepath.Join(out, s.SampleId, ProvenanceDirectoryName, copied)), copied)
+	}
+
+	raw, err := ioutil.ReadFile(fn)
+	assert.NoError(t, err)
+	var crate struct {
+		Context string                   `json:"@context"`
+		Graph   []map[string]interface{} `json:"@graph"`
+	}
+	assert.NoError(t, json.Unmarshal(raw, &crate))
+	assert.Equal(t, roCrateContext, crate.Context)
+	entities := map[string]map[string]interface{}{}
+	for _, entity := range crate.Graph {
+		entities[entity["@id"].(string)] = entity
+	}
+	assert.Equal(t, "./", entities[RoCrateMetadataFileName]["about"].(map[string]interface{})["@id"])
+	assert.Equal(t, "Version: 1.0.0-abc (built at 2021-11-01)", entities["#jobmanager"]["version"], "version which created results")
+	assert.Equal(t, fingerprint.WorkflowFileDigest, entities[fileURI(rss.WorkflowFile.Path)]["identifier"])
+	assert.Equal(t, "sha256:0123", entities["#container-1"]["identifier"])
+	assert.Equal(t, "broadinstitute/gatk:4.1.0.0", entities["#container-2"]["name"])
+	assert.NotContains(t, entities["#container-2"], "identifier", "digest of image which is not cached is unknown")
+	cram := entities[s.SampleId+".cram"]
+	checksum, _ := ChecksumFile(filepath.Join(out, s.SampleId, s.SampleId+".cram"))
+	assert.Equal(t, checksum.Sha256, cram["sha256"])
+	assert.Equal(t, checksum.Md5, cram["md5"])
+	action := entities["#run-"+s.SampleId]
+	assert.Equal(t, len(ListResultFiles(s)), len(action["result"].([]interface{})))
+	assert.Equal(t, "2021-11-01T14:32:42", action["startTime"].(string)[:19])
+	assert.Contains(t, action["object"], map[string]interface{}{"@id": ProvenanceDirectoryName + "/job-file.yaml"})
+	assert.Contains(t, action["object"], map[string]interface{}{"@id": fileURI(s.RunList[0].FQ1)})
+}
+
+func Test_ExportProvenance_without_fingerprint(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	out := rss.OutputDirectory.Path
+	s := ss.SampleList[0]
+	// results created by old version which does not record fingerprint
+	createTestResultFiles(t, out, s)
+
+	fn, err := ExportProvenance(out, s, rss, &ProvenanceOptions{ContainerImages: []ContainerImage{}})
+	assert.NoError(t, err)
+	raw, err := ioutil.ReadFile(fn)
+	assert.NoError(t, err)
+	var crate struct {
+		Graph []map[string]interface{} `json:"@graph"`
+	}
+	assert.NoError(t, json.Unmarshal(raw, &crate))
+	entities := map[string]map[string]interface{}{}
+	for _, entity := range crate.Graph {
+		entities[entity["@id"].(string)] = entity
+	}
+	assert.NotContains(t, entities[fileURI(rss.WorkflowFile.Path)], "identifier", "digest of current workflow is not used")
+	assert.NotContains(t, entities["#jobmanager"], "version", "current version is not used")
+	assert.False(t, IsExistsFile(filepath.Join(out, s.SampleId, ProvenanceDirectoryName, "job-file.yaml")), "job file of current config is not used")
+	assert.NotContains(t, entities, ProvenanceDirectoryName+"/job-file.yaml")
+	assert.Contains(t, entities["#run-"+s.SampleId], "description")
+}
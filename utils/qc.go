@@ -0,0 +1,367 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Calling regions of the workflow. wgs_metrics and bcftools-stats are created for each region.
+var QcRegions = []string{
+	"autosome_PAR_ploidy_2",
+	"chrX_nonPAR_ploidy_1",
+	"chrX_nonPAR_ploidy_2",
+	"chrY_nonPAR_ploidy_1",
+}
+
+// Region used for coverage and Ti/Tv thresholds.
+const QcAutosomeRegion = "autosome_PAR_ploidy_2"
+
+/*
+ * Thresholds to flag outlier samples.
+ * Threshold which is 0 is not checked.
+ */
+type QcThresholds struct {
+	MinMappingRate   float64 `json:"min_mapping_rate"`
+	MaxDuplicateRate float64 `json:"max_duplicate_rate"`
+	// mean coverage of autosome_PAR_ploidy_2 region
+	MinMeanCoverage float64 `json:"min_mean_coverage"`
+	// Ti/Tv of autosome_PAR_ploidy_2 region
+	MinTiTv float64 `json:"min_titv"`
+	MaxTiTv float64 `json:"max_titv"`
+}
+
+/*
+ * Return QC thresholds from config. If not specified, thresholds for 30x WGS are used.
+ */
+func GetQcThresholds(rss *ReferenceSchema) *QcThresholds {
+	if rss.QcThresholds == nil {
+		return &QcThresholds{
+			MinMappingRate:   0.95,
+			MaxDuplicateRate: 0.2,
+			MinMeanCoverage:  20,
+			MinTiTv:          1.9,
+			MaxTiTv:          2.3,
+		}
+	}
+	return rss.QcThresholds
+}
+
+/*
+ * QC metrics of a calling region.
+ * Value which can not be read is nil.
+ */
+type RegionQc struct {
+	Region       string   `json:"region"`
+	MeanCoverage *float64 `json:"mean_coverage"`
+	TiTv         *float64 `json:"titv"`
+	Records      *float64 `json:"records"`
+	Snps         *float64 `json:"snps"`
+	Indels       *float64 `json:"indels"`
+}
+
+/*
+ * QC metrics of a sample.
+ * Flags are thresholds which the sample does not satisfy. Errors are QC files which can not be read.
+ */
+type SampleQc struct {
+	SampleId      string     `json:"sample_id"`
+	TotalReads    *float64   `json:"total_reads"`
+	MappingRate   *float64   `json:"mapping_rate"`
+	DuplicateRate *float64   `json:"duplicate_rate"`
+	Regions       []RegionQc `json:"regions"`
+	Flags         []string   `json:"flags"`
+	Errors        []string   `json:"errors"`
+}
+
+type QcSummary struct {
+	OutputDirectory string        `json:"output_directory"`
+	UpdatedAt       string        `json:"updated_at"`
+	Thresholds      *QcThresholds `json:"thresholds"`
+	Samples         []SampleQc    `json:"samples"`
+	// number of samples which have flags
+	Outliers int `json:"outliers"`
+	// samples without result directory
+	NotFinishedSampleIds []string `json:"not_finished_sample_ids"`
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+// 1000 + 0 in total (QC-passed reads + QC-failed reads)
+var flagstatLineRe = regexp.MustCompile(`^(\d+) \+ (\d+) ([^(]+)`)
+
+/*
+ * Parse output of `samtools flagstat`.
+ * Return value: QC-passed + QC-failed reads of each item such as "in total", "mapped" and "duplicates".
+ */
+func ParseFlagstat(fn string) (map[string]float64, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	result := map[string]float64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		match := flagstatLineRe.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		passed, _ := strconv.ParseFloat(match[1], 64)
+		failed, _ := strconv.ParseFloat(match[2], 64)
+		result[strings.TrimSpace(match[3])] = passed + failed
+	}
+	if _, ok := result["in total"]; !ok {
+		return nil, fmt.Errorf("[%s] is not samtools flagstat output", fn)
+	}
+	return result, nil
+}
+
+/*
+ * Parse Picard metrics file.
+ * Return value: rows of the first metrics section. Keys are column names of the header line.
+ */
+func ParsePicardMetrics(fn string) ([]map[string]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rows := []map[string]string{}
+	var header []string
+	inMetrics := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "## METRICS CLASS") {
+			inMetrics = true
+			continue
+		}
+		if !inMetrics {
+			continue
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			// end of the metrics section, histogram follows
+			break
+		}
+		fields := strings.Split(line, "\t")
+		if header == nil {
+			header = fields
+			continue
+		}
+		row := map[string]string{}
+		for i, name := range header {
+			if i < len(fields) {
+				row[name] = fields[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("[%s] has no Picard metrics", fn)
+	}
+	return rows, nil
+}
+
+func picardMetricsNumber(row map[string]string, name string) (float64, bool) {
+	f, err := strconv.ParseFloat(row[name], 64)
+	return f, err == nil
+}
+
+/*
+ * Duplicate rate of Picard MarkDuplicates metrics.
+ * Libraries are summed in the same way as PERCENT_DUPLICATION.
+ */
+func duplicateRate(rows []map[string]string) (float64, error) {
+	var duplicates, examined float64
+	for _, row := range rows {
+		unpairedExamined, ok1 := picardMetricsNumber(row, "UNPAIRED_READS_EXAMINED")
+		pairsExamined, ok2 := picardMetricsNumber(row, "READ_PAIRS_EXAMINED")
+		unpairedDuplicates, ok3 := picardMetricsNumber(row, "UNPAIRED_READ_DUPLICATES")
+		pairDuplicates, ok4 := picardMetricsNumber(row, "READ_PAIR_DUPLICATES")
+		if !(ok1 && ok2 && ok3 && ok4) {
+			return 0, fmt.Errorf("duplication metrics are not found")
+		}
+		examined += unpairedExamined + pairsExamined*2
+		duplicates += unpairedDuplicates + pairDuplicates*2
+	}
+	if examined == 0 {
+		return 0, nil
+	}
+	return duplicates / examined, nil
+}
+
+/*
+ * Read MEAN_COVERAGE of Picard CollectWgsMetrics of the region.
+ */
+func ReadMeanCoverage(outputDirectoryPath string, sampleId string, region string) (float64, error) {
+	wgsMetricsFile := filepath.Join(outputDirectoryPath, sampleId, sampleId+".cram."+region+".wgs_metrics")
+	rows, err := ParsePicardMetrics(wgsMetricsFile)
+	if err != nil {
+		return 0, err
+	}
+	coverage, ok := picardMetricsNumber(rows[0], "MEAN_COVERAGE")
+	if !ok {
+		return 0, fmt.Errorf("[%s] has no MEAN_COVERAGE", wgsMetricsFile)
+	}
+	return coverage, nil
+}
+
+// SN	0	number of SNPs:	4012345
+var bcftoolsStatsSummaryNames = map[string]string{
+	"number of records:": "records",
+	"number of SNPs:":    "snps",
+	"number of indels:":  "indels",
+}
+
+/*
+ * Parse output of `bcftools stats`.
+ * Return value: records, snps, indels and titv of the first file.
+ */
+func ParseBcftoolsStats(fn string) (map[string]float64, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	result := map[string]float64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 4 || fields[1] != "0" {
+			continue
+		}
+		switch fields[0] {
+		case "SN":
+			if name, ok := bcftoolsStatsSummaryNames[fields[2]]; ok {
+				result[name], _ = strconv.ParseFloat(fields[3], 64)
+			}
+		case "TSTV":
+			// TSTV	id	ts	tv	ts/tv	...
+			if len(fields) > 4 {
+				result["titv"], _ = strconv.ParseFloat(fields[4], 64)
+			}
+		}
+	}
+	if _, ok := result["records"]; !ok {
+		return nil, fmt.Errorf("[%s] is not bcftools stats output", fn)
+	}
+	return result, nil
+}
+
+/*
+ * Read QC files in result directory of the sample.
+ */
+func CollectSampleQc(outputDirectoryPath string, sampleId string) SampleQc {
+	sample := SampleQc{SampleId: sampleId, Regions: []RegionQc{}, Flags: []string{}, Errors: []string{}}
+	prefix := filepath.Join(outputDirectoryPath, sampleId, sampleId)
+	if flagstat, err := ParseFlagstat(prefix + ".cram.flagstat"); err != nil {
+		sample.Errors = append(sample.Errors, err.Error())
+	} else {
+		sample.TotalReads = floatPtr(flagstat["in total"])
+		if flagstat["in total"] > 0 {
+			sample.MappingRate = floatPtr(flagstat["mapped"] / flagstat["in total"])
+		}
+	}
+	if rows, err := ParsePicardMetrics(prefix + ".metrics.txt"); err != nil {
+		sample.Errors = append(sample.Errors, err.Error())
+	} else if rate, err := duplicateRate(rows); err != nil {
+		sample.Errors = append(sample.Errors, fmt.Sprintf("[%s] %v", prefix+".metrics.txt", err))
+	} else {
+		sample.DuplicateRate = floatPtr(rate)
+	}
+	for _, region := range QcRegions {
+		regionQc := RegionQc{Region: region}
+		if coverage, err := ReadMeanCoverage(outputDirectoryPath, sampleId, region); err != nil {
+			sample.Errors = append(sample.Errors, err.Error())
+		} else {
+			regionQc.MeanCoverage = floatPtr(coverage)
+		}
+		if stats, err := ParseBcftoolsStats(prefix + "." + region + ".g.vcf.gz.bcftools-stats"); err != nil {
+			sample.Errors = append(sample.Errors, err.Error())
+		} else {
+			regionQc.Records = floatPtr(stats["records"])
+			regionQc.Snps = floatPtr(stats["snps"])
+			regionQc.Indels = floatPtr(stats["indels"])
+			if titv, ok := stats["titv"]; ok {
+				regionQc.TiTv = floatPtr(titv)
+			}
+		}
+		sample.Regions = append(sample.Regions, regionQc)
+	}
+	return sample
+}
+
+/*
+ * Return region QC of the sample. nil if not found.
+ */
+func (s *SampleQc) Region(region string) *RegionQc {
+	for i := range s.Regions {
+		if s.Regions[i].Region == region {
+			return &s.Regions[i]
+		}
+	}
+	return nil
+}
+
+/*
+ * Set flags of thresholds which the sample does not satisfy.
+ * Metrics which can not be read are not flagged. They are in errors.
+ */
+func (s *SampleQc) ApplyThresholds(thresholds *QcThresholds) {
+	flag := func(value *float64, threshold float64, isMin bool, name string) {
+		if value == nil || threshold == 0 {
+			return
+		}
+		if isMin && *value < threshold {
+			s.Flags = append(s.Flags, fmt.Sprintf("%s<%g", name, threshold))
+		}
+		if !isMin && *value > threshold {
+			s.Flags = append(s.Flags, fmt.Sprintf("%s>%g", name, threshold))
+		}
+	}
+	flag(s.MappingRate, thresholds.MinMappingRate, true, "mapping_rate")
+	flag(s.DuplicateRate, thresholds.MaxDuplicateRate, false, "duplicate_rate")
+	if autosome := s.Region(QcAutosomeRegion); autosome != nil {
+		flag(autosome.MeanCoverage, thresholds.MinMeanCoverage, true, "mean_coverage")
+		flag(autosome.TiTv, thresholds.MinTiTv, true, "titv")
+		flag(autosome.TiTv, thresholds.MaxTiTv, false, "titv")
+	}
+}
+
+/*
+ * Collect QC metrics of samples which have result directory.
+ */
+func CollectQcSummary(outputDirectoryPath string, ss *SimpleSchema, thresholds *QcThresholds) *QcSummary {
+	summary := &QcSummary{
+		OutputDirectory:      outputDirectoryPath,
+		UpdatedAt:            GetCurrentTime(),
+		Thresholds:           thresholds,
+		Samples:              []SampleQc{},
+		NotFinishedSampleIds: []string{},
+	}
+	for _, s := range ss.SampleList {
+		if !IsExistsFile(filepath.Join(outputDirectoryPath, s.SampleId)) {
+			summary.NotFinishedSampleIds = append(summary.NotFinishedSampleIds, s.SampleId)
+			continue
+		}
+		sample := CollectSampleQc(outputDirectoryPath, s.SampleId)
+		sample.ApplyThresholds(thresholds)
+		if len(sample.Flags) > 0 {
+			summary.Outliers += 1
+		}
+		summary.Samples = append(summary.Samples, sample)
+	}
+	sort.SliceStable(summary.Samples, func(i, j int) bool {
+		// outliers first
+		return len(summary.Samples[i].Flags) > 0 && len(summary.Samples[j].Flags) == 0
+	})
+	return summary
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseFlagstat(t *testing.T) {
+	result, err := ParseFlagstat("../test/qcfiles/NA12878/NA12878.cram.flagstat")
+	assert.NoError(t, err)
+	assert.Equal(t, 812345678.0, result["in total"])
+	assert.Equal(t, 808282949.0, result["mapped"])
+	assert.Equal(t, 98765432.0, result["duplicates"])
+
+	_, err = ParseFlagstat("../test/qcfiles/NA12878/NA12878.metrics.txt")
+	assert.Error(t, err, "not flagstat output")
+}
+
+func Test_ParsePicardMetrics(t *testing.T) {
+	rows, err := ParsePicardMetrics("../test/qcfiles/NA12878/NA12878.cram.autosome_PAR_ploidy_2.wgs_metrics")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(rows), "histogram is not read")
+	assert.Equal(t, "31.245", rows[0]["MEAN_COVERAGE"])
+
+	rows, err = ParsePicardMetrics("../test/qcfiles/NA12878/NA12878.metrics.txt")
+	assert.NoError(t, err)
+	rate, err := duplicateRate(rows)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.122084, rate, 0.000001, "same as PERCENT_DUPLICATION")
+
+	_, err = ParsePicardMetrics("../test/qcfiles/NA12878/NA12878.cram.flagstat")
+	assert.Error(t, err, "not Picard metrics")
+}
+
+func Test_ParseBcftoolsStats(t *testing.T) {
+	result, err := ParseBcftoolsStats("../test/qcfiles/NA12878/NA12878.autosome_PAR_ploidy_2.g.vcf.gz.bcftools-stats")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"records": 210000000, "snps": 3900000, "indels": 850000, "titv": 2.08}, result)
+}
+
+func Test_CollectQcSummary(t *testing.T) {
+	ss, _ := loadTestSampleSheetAndConfigFile(t)
+	summary := CollectQcSummary("../test/qcfiles", ss, &QcThresholds{MinMappingRate: 0.95, MaxDuplicateRate: 0.2, MinMeanCoverage: 20, MinTiTv: 1.9, MaxTiTv: 2.3})
+	assert.Equal(t, []string{"NA1287O"}, summary.NotFinishedSampleIds)
+	assert.Equal(t, 1, len(summary.Samples))
+	sample := summary.Samples[0]
+	assert.Equal(t, []string{}, sample.Flags)
+	assert.Equal(t, []string{}, sample.Errors)
+	assert.Equal(t, 0, summary.Outliers)
+	assert.InDelta(t, 0.995, *sample.MappingRate, 0.0001)
+	assert.Equal(t, 4, len(sample.Regions))
+	assert.Equal(t, 0.07, *sample.Region("chrY_nonPAR_ploidy_1").MeanCoverage)
+	assert.Equal(t, 1.89, *sample.Region("chrX_nonPAR_ploidy_2").TiTv)
+
+	summary = CollectQcSummary("../test/qcfiles", ss, &QcThresholds{MinMeanCoverage: 35, MaxTiTv: 2.0})
+	assert.Equal(t, []string{"mean_coverage<35", "titv>2"}, summary.Samples[0].Flags)
+	assert.Equal(t, 1, summary.Outliers)
+}
+
+func Test_CollectSampleQc_missing(t *testing.T) {
+	sample := CollectSampleQc(t.TempDir(), "NA12878")
+	assert.Nil(t, sample.MappingRate)
+	assert.Equal(t, 2+len(QcRegions)*2, len(sample.Errors))
+	sample.ApplyThresholds(&QcThresholds{MinMappingRate: 0.95})
+	assert.Equal(t, []string{}, sample.Flags, "missing metrics are not flagged")
+}
+
+func Test_GetQcThresholds(t *testing.T) {
+	rss := &ReferenceSchema{}
+	assert.Equal(t, 0.95, GetQcThresholds(rss).MinMappingRate, "default")
+	rss.QcThresholds = &QcThresholds{MinMeanCoverage: 10}
+	assert.Equal(t, 0.0, GetQcThresholds(rss).MinMappingRate, "not checked")
+}
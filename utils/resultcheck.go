@@ -0,0 +1,343 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Empty BGZF block at the end of BGZF file, such as .vcf.gz, .tbi and .bam
+var bgzfEOFMarker = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43,
+	0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// EOF container at the end of CRAM file
+var cramEOFContainers = map[byte][]byte{
+	2: {
+		0x0b, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xe0, 0x45, 0x4f, 0x46, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x06, 0x06, 0x01, 0x00, 0x01, 0x00, 0x01, 0x00,
+	},
+	3: {
+		0x0f, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0x0f, 0xe0, 0x45, 0x4f, 0x46, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x05, 0xbd, 0xd9, 0x4f, 0x00, 0x01, 0x00, 0x06, 0x06, 0x01, 0x00, 0x01, 0x00,
+		0x01, 0x00, 0xee, 0x63, 0x01, 0x4b,
+	},
+}
+
+// Error messages in .log files of workflow steps
+var resultLogErrorRes = []*regexp.Regexp{
+	regexp.MustCompile(`\[E::`),
+	regexp.MustCompile(`Exception in thread`),
+	regexp.MustCompile(`java\.lang\.\w+(?:Exception|Error)`),
+	regexp.MustCompile(`^\s*(?:ERROR|FATAL)\b`),
+	regexp.MustCompile(`(?i)truncated file`),
+	regexp.MustCompile(`(?i)EOF marker is absent`),
+	regexp.MustCompile(`(?i)segmentation fault|core dumped`),
+	regexp.MustCompile(`No space left on device`),
+}
+
+func readFileTail(fn string, size int) ([]byte, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fileinfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fileinfo.Size() < int64(size) {
+		return nil, fmt.Errorf("[%s] is too small", fn)
+	}
+	buffer := make([]byte, size)
+	if _, err := f.ReadAt(buffer, fileinfo.Size()-int64(size)); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+/*
+ * Check BGZF file ends with EOF marker. Truncated file does not have it.
+ */
+func CheckBgzfEOF(fn string) error {
+	tail, err := readFileTail(fn, len(bgzfEOFMarker))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tail, bgzfEOFMarker) {
+		return fmt.Errorf("[%s] has no BGZF EOF marker. file may be truncated", fn)
+	}
+	return nil
+}
+
+/*
+ * Check index file is not older than data file.
+ */
+func CheckIndexNewer(dataFile string, indexFile string) error {
+	dataInfo, err := os.Stat(dataFile)
+	if err != nil {
+		return err
+	}
+	indexInfo, err := os.Stat(indexFile)
+	if err != nil {
+		return err
+	}
+	if indexInfo.ModTime().Before(dataInfo.ModTime()) {
+		return fmt.Errorf("[%s] is older than [%s]", indexFile, dataFile)
+	}
+	return nil
+}
+
+// ITF8 integer of CRAM
+func readItf8(r io.ByteReader) (int32, error) {
+	b0, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	extra := 0
+	for mask := byte(0x80); extra < 4 && b0&mask != 0; mask >>= 1 {
+		extra += 1
+	}
+	value := uint32(b0) & (0xff >> uint(extra+1))
+	if extra == 4 {
+		value = uint32(b0) & 0x0f
+	}
+	for i := 0; i < extra; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if extra == 4 && i == 3 {
+			// only lower 4 bits of the last byte are used
+			value = value<<4 | uint32(b&0x0f)
+		} else {
+			value = value<<8 | uint32(b)
+		}
+	}
+	return int32(value), nil
+}
+
+// LTF8 integer of CRAM
+func readLtf8(r io.ByteReader) error {
+	b0, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	extra := 0
+	for mask := byte(0x80); mask != 0 && b0&mask != 0; mask >>= 1 {
+		extra += 1
+	}
+	for i := 0; i < extra; i++ {
+		if _, err := r.ReadByte(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Read SAM header text in the first container of CRAM.
+ */
+func readCramHeader(r *bufio.Reader, major byte) (string, error) {
+	// container header
+	if _, err := r.Discard(4); err != nil {
+		return "", err
+	}
+	// reference sequence id, starting position, alignment span, number of records
+	for i := 0; i < 4; i++ {
+		if _, err := readItf8(r); err != nil {
+			return "", err
+		}
+	}
+	// record counter, bases
+	for i := 0; i < 2; i++ {
+		if err := readLtf8(r); err != nil {
+			return "", err
+		}
+	}
+	// number of blocks
+	if _, err := readItf8(r); err != nil {
+		return "", err
+	}
+	landmarks, err := readItf8(r)
+	if err != nil {
+		return "", err
+	}
+	for i := int32(0); i < landmarks; i++ {
+		if _, err := readItf8(r); err != nil {
+			return "", err
+		}
+	}
+	if major >= 3 {
+		// crc32
+		if _, err := r.Discard(4); err != nil {
+			return "", err
+		}
+	}
+	// block: method, content type, content id, compressed size, raw size
+	method, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	contentType, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if contentType != 0 {
+		return "", fmt.Errorf("first block is not file header")
+	}
+	if _, err := readItf8(r); err != nil {
+		return "", err
+	}
+	compressedSize, err := readItf8(r)
+	if err != nil {
+		return "", err
+	}
+	if _, err := readItf8(r); err != nil {
+		return "", err
+	}
+	var block io.Reader = io.LimitReader(r, int64(compressedSize))
+	switch method {
+	case 0:
+	case 1:
+		if block, err = gzip.NewReader(block); err != nil {
+			return "", err
+		}
+	case 2:
+		block = bzip2.NewReader(block)
+	default:
+		// other compression methods are not read
+		return "", nil
+	}
+	var length int32
+	if err := binary.Read(block, binary.LittleEndian, &length); err != nil {
+		return "", err
+	}
+	text, err := ioutil.ReadAll(io.LimitReader(block, int64(length)))
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+/*
+ * Check CRAM file has file definition, SAM header container and EOF container.
+ */
+func CheckCram(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	// file definition: "CRAM", major, minor and file id
+	definition := make([]byte, 26)
+	if _, err := io.ReadFull(r, definition); err != nil || string(definition[:4]) != "CRAM" {
+		return fmt.Errorf("[%s] is not CRAM", fn)
+	}
+	major := definition[4]
+	eof, ok := cramEOFContainers[major]
+	if !ok {
+		return fmt.Errorf("[%s] has unsupported CRAM version %d.%d", fn, major, definition[5])
+	}
+	header, err := readCramHeader(r, major)
+	if err != nil {
+		return fmt.Errorf("[%s] has invalid CRAM header: %v", fn, err)
+	}
+	if header != "" && !strings.HasPrefix(header, "@") {
+		return fmt.Errorf("[%s] has invalid SAM header in CRAM", fn)
+	}
+	tail, err := readFileTail(fn, len(eof))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tail, eof) {
+		return fmt.Errorf("[%s] has no CRAM EOF container. file may be truncated", fn)
+	}
+	return nil
+}
+
+/*
+ * Return the first line of the log file which matches error messages.
+ */
+func FindResultLogError(fn string) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, re := range resultLogErrorRes {
+			if re.MatchString(line) {
+				return strings.TrimSpace(line), nil
+			}
+		}
+	}
+	return "", scanner.Err()
+}
+
+/*
+ * Check contents of result files, not only existence.
+ * BGZF EOF of .g.vcf.gz, .tbi and .bam, CRAM header and EOF, index is newer than data file
+ * and error messages in .log files.
+ * Return value: problems found. Empty if result files are valid.
+ */
+func DeepCheckResultFiles(outputDirectoryPath string, s *Sample) []string {
+	problems := []string{}
+	addProblem := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	prefix := filepath.Join(outputDirectoryPath, s.SampleId, s.SampleId)
+	for _, region := range QcRegions {
+		gvcf := prefix + "." + region + ".g.vcf.gz"
+		addProblem(CheckBgzfEOF(gvcf))
+		addProblem(CheckBgzfEOF(gvcf + ".tbi"))
+		addProblem(CheckIndexNewer(gvcf, gvcf+".tbi"))
+	}
+	addProblem(CheckCram(prefix + ".cram"))
+	addProblem(CheckIndexNewer(prefix+".cram", prefix+".cram.crai"))
+	for _, r := range s.RunList {
+		addProblem(CheckBgzfEOF(filepath.Join(outputDirectoryPath, s.SampleId, r.RunId+".bam")))
+	}
+	logFiles, _ := filepath.Glob(filepath.Join(outputDirectoryPath, s.SampleId, "*.log"))
+	for _, logFile := range logFiles {
+		line, err := FindResultLogError(logFile)
+		addProblem(err)
+		if line != "" {
+			problems = append(problems, fmt.Sprintf("[%s] has error: %s", logFile, line))
+		}
+	}
+	return problems
+}
+
+/*
+ * Check all result files exist. If deepCheck is true, contents of result files are also checked.
+ */
+func CheckResultFiles(outputDirectoryPath string, s *Sample, deepCheck bool) bool {
+	if !CheckAllResultFiles(outputDirectoryPath, s) {
+		return false
+	}
+	if !deepCheck {
+		return true
+	}
+	problems := DeepCheckResultFiles(outputDirectoryPath, s)
+	for _, problem := range problems {
+		fmt.Printf("Invalid file %s\n", problem)
+	}
+	return len(problems) == 0
+}
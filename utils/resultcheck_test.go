@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// minimum CRAM 3.0 file which has only SAM header container and EOF container
+func createTestCram(header string, eof bool) []byte {
+	data := []byte("CRAM\x03\x00")
+	data = append(data, make([]byte, 20)...)
+	text := make([]byte, 4)
+	binary.LittleEndian.PutUint32(text, uint32(len(header)))
+	text = append(text, header...)
+	// method raw, content type file header, content id, compressed size, raw size
+	block := []byte{0, 0, 0, byte(len(text)), byte(len(text))}
+	block = append(block, text...)
+	block = append(block, 0, 0, 0, 0)
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(block)))
+	data = append(data, length...)
+	// reference sequence id, start, span, records, record counter, bases, blocks, landmarks, crc32
+	data = append(data, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0)
+	data = append(data, block...)
+	if eof {
+		data = append(data, cramEOFContainers[3]...)
+	}
+	return data
+}
+
+func Test_readItf8(t *testing.T) {
+	for _, c := range []struct {
+		bytes []byte
+		value int32
+	}{
+		{[]byte{0x05}, 5},
+		{[]byte{0x81, 0x00}, 256},
+		{[]byte{0xc1, 0x00, 0x00}, 65536},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, -1},
+	} {
+		value, err := readItf8(bytes.NewReader(c.bytes))
+		assert.NoError(t, err)
+		assert.Equal(t, c.value, value)
+	}
+}
+
+func Test_CheckBgzfEOF(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.g.vcf.gz")
+	ioutil.WriteFile(fn, append([]byte("dummy bgzf blocks"), bgzfEOFMarker...), 0644)
+	assert.NoError(t, CheckBgzfEOF(fn))
+	ioutil.WriteFile(fn, []byte("dummy bgzf blocks, truncated"), 0644)
+	assert.Error(t, CheckBgzfEOF(fn))
+	ioutil.WriteFile(fn, []byte("x"), 0644)
+	assert.Error(t, CheckBgzfEOF(fn), "too small")
+}
+
+func Test_CheckIndexNewer(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "test.cram")
+	index := data + ".crai"
+	ioutil.WriteFile(data, []byte("data"), 0644)
+	ioutil.WriteFile(index, []byte("index"), 0644)
+	assert.NoError(t, CheckIndexNewer(data, index))
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(index, old, old)
+	assert.Error(t, CheckIndexNewer(data, index))
+}
+
+func Test_CheckCram(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.cram")
+	ioutil.WriteFile(fn, createTestCram("@HD\tVN:1.6\tSO:coordinate\n", true), 0644)
+	assert.NoError(t, CheckCram(fn))
+	ioutil.WriteFile(fn, createTestCram("@HD\tVN:1.6\tSO:coordinate\n", false), 0644)
+	assert.Error(t, CheckCram(fn), "EOF container is missing")
+	ioutil.WriteFile(fn, createTestCram("broken", true), 0644)
+	assert.Error(t, CheckCram(fn), "SAM header is invalid")
+	ioutil.WriteFile(fn, append([]byte("BAM\x01"), bgzfEOFMarker...), 0644)
+	assert.Error(t, CheckCram(fn), "not CRAM")
+}
+
+func Test_FindResultLogError(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.log")
+	ioutil.WriteFile(fn, []byte("[M::bwa_idx_load_from_disk] read 0 ALT contigs\n[E::hts_open_format] Failed to open file\n"), 0644)
+	line, err := FindResultLogError(fn)
+	assert.NoError(t, err)
+	assert.Equal(t, "[E::hts_open_format] Failed to open file", line)
+	ioutil.WriteFile(fn, []byte("INFO  Done\n"), 0644)
+	line, err = FindResultLogError(fn)
+	assert.NoError(t, err)
+	assert.Equal(t, "", line)
+}
+
+func Test_DeepCheckResultFiles(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	out := rss.OutputDirectory.Path
+	s := ss.SampleList[0]
+	dir := filepath.Join(out, s.SampleId)
+	os.MkdirAll(dir, 0755)
+	prefix := filepath.Join(dir, s.SampleId)
+	old := time.Now().Add(-time.Hour)
+	bgzf := append([]byte("dummy bgzf blocks"), bgzfEOFMarker...)
+	for _, region := range QcRegions {
+		ioutil.WriteFile(prefix+"."+region+".g.vcf.gz", bgzf, 0644)
+		os.Chtimes(prefix+"."+region+".g.vcf.gz", old, old)
+		ioutil.WriteFile(prefix+"."+region+".g.vcf.gz.tbi", bgzf, 0644)
+		ioutil.WriteFile(prefix+"."+region+".g.vcf.gz.log", []byte("Done\n"), 0644)
+	}
+	ioutil.WriteFile(prefix+".cram", createTestCram("@HD\tVN:1.6\n", true), 0644)
+	os.Chtimes(prefix+".cram", old, old)
+	ioutil.WriteFile(prefix+".cram.crai", []byte("index"), 0644)
+	for _, r := range s.RunList {
+		ioutil.WriteFile(filepath.Join(dir, r.RunId+".bam"), bgzf, 0644)
+	}
+	assert.Equal(t, []string{}, DeepCheckResultFiles(out, s))
+
+	// truncated gVCF, old index and error in log
+	ioutil.WriteFile(prefix+".chrY_nonPAR_ploidy_1.g.vcf.gz", []byte("truncated"), 0644)
+	// index is written before the truncated gVCF. mtime may be same in coarse file system timestamps
+	os.Chtimes(prefix+".chrY_nonPAR_ploidy_1.g.vcf.gz.tbi", old, old)
+	os.Chtimes(prefix+".cram.crai", old.Add(-time.Hour), old.Add(-time.Hour))
+	ioutil.WriteFile(prefix+".cram.log", []byte("Exception in thread \"main\" htsjdk.samtools.SAMException\n"), 0644)
+	problems := DeepCheckResultFiles(out, s)
+	assert.Equal(t, 4, len(problems), problems)
+}
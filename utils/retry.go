@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+/*
+ * Retry policy of failed samples. `retry_policy` in config file.
+ * If both RetryableExitCodes and RetryableStderrPatterns are empty,
+ * every failure except NonRetryableStderrPatterns is retryable.
+ */
+type RetryPolicy struct {
+	MaxAttempts                int      `json:"max_attempts"`
+	BackoffSeconds             int      `json:"backoff_seconds"`
+	BackoffMultiplier          float64  `json:"backoff_multiplier"`
+	MaxBackoffSeconds          int      `json:"max_backoff_seconds"`
+	RetryableExitCodes         []int    `json:"retryable_exit_codes"`
+	RetryableStderrPatterns    []string `json:"retryable_stderr_patterns"`
+	NonRetryableStderrPatterns []string `json:"non_retryable_stderr_patterns"`
+}
+
+/*
+ * Return retry policy from config. If not specified, failed sample is not retried.
+ */
+func GetRetryPolicy(rss *ReferenceSchema) *RetryPolicy {
+	if rss.RetryPolicy == nil {
+		return &RetryPolicy{MaxAttempts: 1}
+	}
+	return rss.RetryPolicy
+}
+
+/*
+ * Check patterns in retry policy are valid regular expressions.
+ */
+func (p *RetryPolicy) Validate() error {
+	for _, pattern := range append(append([]string{}, p.RetryableStderrPatterns...), p.NonRetryableStderrPatterns...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern [%s] in retry_policy: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+/*
+ * Wait time before next attempt.
+ * attempt is the number of failed attempt, starts from 1.
+ */
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	seconds := float64(p.BackoffSeconds) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoffSeconds > 0 && seconds > float64(p.MaxBackoffSeconds) {
+		seconds = float64(p.MaxBackoffSeconds)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func matchAnyPattern(patterns []string, content string) bool {
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Decide the failed attempt is retryable.
+ * toil stderr and toil log file in jobManagerDirectory are checked by patterns.
+ */
+func (p *RetryPolicy) IsRetryable(exitCode int, jobManagerDirectory string, sampleId string) bool {
+	if exitCode == 0 {
+		// toil-cwl-runner is finished. missing results are not fixed by retry.
+		return false
+	}
+	content := ""
+	for _, fn := range []string{filepath.Join(jobManagerDirectory, "toil.stderr.txt"), createLogFilePath(jobManagerDirectory, sampleId)} {
+		if raw, err := ioutil.ReadFile(fn); err == nil {
+			content = content + string(raw)
+		}
+	}
+	if matchAnyPattern(p.NonRetryableStderrPatterns, content) {
+		return false
+	}
+	if len(p.RetryableExitCodes) == 0 && len(p.RetryableStderrPatterns) == 0 {
+		return true
+	}
+	for _, code := range p.RetryableExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return matchAnyPattern(p.RetryableStderrPatterns, content)
+}
+
+/*
+ * Return timestamp for the next attempt of the sample.
+ * Each attempt is recorded in its own outputDirectoryPath/jobManager/<timestamp>/<sampleId>,
+ * so wait until the timestamp is changed.
+ */
+func nextAttemptTime(outputDirectoryPath string, sampleId string, previousTime string) string {
+	for {
+		currentTime := GetCurrentTime()
+		if currentTime > previousTime && !IsExistsFile(filepath.Join(outputDirectoryPath, "jobManager", currentTime, sampleId)) {
+			return currentTime
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
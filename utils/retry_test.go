@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestStderr(t *testing.T, stderr string) string {
+	jobManagerDirectory := t.TempDir()
+	os.MkdirAll(filepath.Join(jobManagerDirectory, "logs"), 0755)
+	ioutil.WriteFile(filepath.Join(jobManagerDirectory, "toil.stderr.txt"), []byte(stderr), 0644)
+	return jobManagerDirectory
+}
+
+func Test_GetRetryPolicy_default(t *testing.T) {
+	result := GetRetryPolicy(&ReferenceSchema{})
+	assert.Equal(t, 1, result.MaxAttempts, "no retry without retry_policy")
+}
+
+func Test_RetryPolicy_Validate_invalid_pattern(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, RetryableStderrPatterns: []string{"node(fail"}}
+	assert.Error(t, policy.Validate(), "pattern is invalid regular expression")
+}
+
+func Test_RetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BackoffSeconds: 10, BackoffMultiplier: 2, MaxBackoffSeconds: 30}
+	assert.Equal(t, 10*time.Second, policy.Backoff(1))
+	assert.Equal(t, 20*time.Second, policy.Backoff(2))
+	assert.Equal(t, 30*time.Second, policy.Backoff(3), "limited by max_backoff_seconds")
+}
+
+func Test_RetryPolicy_IsRetryable_exit_code(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, RetryableExitCodes: []int{1}}
+	jobManagerDirectory := createTestStderr(t, "")
+	assert.True(t, policy.IsRetryable(1, jobManagerDirectory, "XX00001"))
+	assert.False(t, policy.IsRetryable(2, jobManagerDirectory, "XX00001"))
+	assert.False(t, policy.IsRetryable(0, jobManagerDirectory, "XX00001"), "exitcode 0 is not failure")
+}
+
+func Test_RetryPolicy_IsRetryable_stderr_pattern(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, RetryableStderrPatterns: []string{"NODE_FAIL"}}
+	assert.True(t, policy.IsRetryable(1, createTestStderr(t, "batch job 123 NODE_FAIL\n"), "XX00001"))
+	assert.False(t, policy.IsRetryable(1, createTestStderr(t, "permanentFail\n"), "XX00001"))
+}
+
+func Test_RetryPolicy_IsRetryable_toil_log(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, RetryableStderrPatterns: []string{"NODE_FAIL"}}
+	jobManagerDirectory := createTestStderr(t, "")
+	ioutil.WriteFile(createLogFilePath(jobManagerDirectory, "XX00001"), []byte("NODE_FAIL\n"), 0644)
+	assert.True(t, policy.IsRetryable(1, jobManagerDirectory, "XX00001"), "toil log file is also checked")
+}
+
+func Test_RetryPolicy_IsRetryable_non_retryable(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, NonRetryableStderrPatterns: []string{"ValidationException"}}
+	assert.True(t, policy.IsRetryable(1, createTestStderr(t, "NODE_FAIL\n"), "XX00001"), "every failure is retryable")
+	assert.False(t, policy.IsRetryable(1, createTestStderr(t, "schema_salad.validate.ValidationException\n"), "XX00001"))
+}
+
+func Test_nextAttemptTime(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	currentTime := GetCurrentTime()
+	result := nextAttemptTime(outputDirectoryPath, "XX00001", currentTime)
+	assert.True(t, result > currentTime, "timestamp of next attempt is changed")
+}
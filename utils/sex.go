@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Sex in sample sheet and inferred sex.
+const (
+	SexMale    = "male"
+	SexFemale  = "female"
+	SexUnknown = "unknown"
+)
+
+// Result of comparison between sample sheet and inferred sex.
+const (
+	SexCheckMatch        = "match"
+	SexCheckMismatch     = "mismatch"
+	SexCheckNotSpecified = "not_specified"
+	SexCheckInconclusive = "inconclusive"
+	SexCheckError        = "error"
+)
+
+// Regions of wgs_metrics used to infer sex.
+// chrX_nonPAR_ploidy_1 and chrX_nonPAR_ploidy_2 are the same interval, so one of them is used.
+const (
+	sexCheckChrXRegion = "chrX_nonPAR_ploidy_2"
+	sexCheckChrYRegion = "chrY_nonPAR_ploidy_1"
+)
+
+/*
+ * Coverage ratio to autosome which separates number of sex chromosomes.
+ * chrX: about 1.0 for XX and 0.5 for X.
+ * chrY: about 0.5 for Y, but lower because reads of low mapping quality are excluded. Almost 0 without Y.
+ * Ratios between low and high are not classified.
+ */
+const (
+	SexCheckChrXLow  = 0.65
+	SexCheckChrXHigh = 0.85
+	SexCheckChrYLow  = 0.05
+	SexCheckChrYHigh = 0.15
+)
+
+type SexCheck struct {
+	SampleId         string  `json:"sample_id"`
+	AutosomeCoverage float64 `json:"autosome_coverage"`
+	ChrXCoverage     float64 `json:"chrX_coverage"`
+	ChrYCoverage     float64 `json:"chrY_coverage"`
+	ChrXRatio        float64 `json:"chrX_ratio"`
+	ChrYRatio        float64 `json:"chrY_ratio"`
+	// XX, XY, X, XXY or empty if coverage ratio is not classified
+	Karyotype    string `json:"karyotype"`
+	InferredSex  string `json:"inferred_sex"`
+	SampleSheet  string `json:"sample_sheet_sex"`
+	Result       string `json:"result"`
+	ErrorMessage string `json:"error"`
+}
+
+type SexCheckReport struct {
+	OutputDirectory      string     `json:"output_directory"`
+	Samples              []SexCheck `json:"samples"`
+	Mismatches           int        `json:"mismatches"`
+	NotFinishedSampleIds []string   `json:"not_finished_sample_ids"`
+}
+
+/*
+ * Infer karyotype from coverage ratio of chrX and chrY nonPAR to autosome.
+ */
+func InferKaryotype(chrXRatio float64, chrYRatio float64) string {
+	x := ""
+	switch {
+	case chrXRatio < SexCheckChrXLow:
+		x = "X"
+	case chrXRatio >= SexCheckChrXHigh:
+		x = "XX"
+	default:
+		return ""
+	}
+	switch {
+	case chrYRatio < SexCheckChrYLow:
+		return x
+	case chrYRatio >= SexCheckChrYHigh:
+		return x + "Y"
+	default:
+		return ""
+	}
+}
+
+func karyotypeSex(karyotype string) string {
+	switch karyotype {
+	case "XX":
+		return SexFemale
+	case "XY":
+		return SexMale
+	default:
+		// sex chromosome aneuploidy or not classified
+		return SexUnknown
+	}
+}
+
+/*
+ * Infer sex of the sample from wgs_metrics and compare with sex in sample sheet.
+ */
+func CheckSampleSex(outputDirectoryPath string, s *Sample) SexCheck {
+	check := SexCheck{SampleId: s.SampleId, InferredSex: SexUnknown, SampleSheet: s.Sex}
+	if check.SampleSheet == "" {
+		check.SampleSheet = SexUnknown
+	}
+	var err error
+	for _, coverage := range []struct {
+		region string
+		value  *float64
+	}{
+		{QcAutosomeRegion, &check.AutosomeCoverage},
+		{sexCheckChrXRegion, &check.ChrXCoverage},
+		{sexCheckChrYRegion, &check.ChrYCoverage},
+	} {
+		if *coverage.value, err = ReadMeanCoverage(outputDirectoryPath, s.SampleId, coverage.region); err != nil {
+			check.Result = SexCheckError
+			check.ErrorMessage = err.Error()
+			return check
+		}
+	}
+	if check.AutosomeCoverage == 0 {
+		check.Result = SexCheckError
+		check.ErrorMessage = fmt.Sprintf("mean coverage of %s is 0", QcAutosomeRegion)
+		return check
+	}
+	check.ChrXRatio = check.ChrXCoverage / check.AutosomeCoverage
+	check.ChrYRatio = check.ChrYCoverage / check.AutosomeCoverage
+	check.Karyotype = InferKaryotype(check.ChrXRatio, check.ChrYRatio)
+	check.InferredSex = karyotypeSex(check.Karyotype)
+	switch {
+	case check.SampleSheet == SexUnknown:
+		check.Result = SexCheckNotSpecified
+	case check.InferredSex == SexUnknown:
+		check.Result = SexCheckInconclusive
+	case check.InferredSex == check.SampleSheet:
+		check.Result = SexCheckMatch
+	default:
+		check.Result = SexCheckMismatch
+	}
+	return check
+}
+
+/*
+ * Check sex of samples which have result directory.
+ */
+func CheckSex(outputDirectoryPath string, ss *SimpleSchema) *SexCheckReport {
+	report := &SexCheckReport{OutputDirectory: outputDirectoryPath, Samples: []SexCheck{}, NotFinishedSampleIds: []string{}}
+	for _, s := range ss.SampleList {
+		if !IsExistsFile(filepath.Join(outputDirectoryPath, s.SampleId)) {
+			report.NotFinishedSampleIds = append(report.NotFinishedSampleIds, s.SampleId)
+			continue
+		}
+		check := CheckSampleSex(outputDirectoryPath, s)
+		if check.Result == SexCheckMismatch {
+			report.Mismatches += 1
+		}
+		report.Samples = append(report.Samples, check)
+	}
+	return report
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_InferKaryotype(t *testing.T) {
+	assert.Equal(t, "XX", InferKaryotype(0.98, 0.002))
+	assert.Equal(t, "XY", InferKaryotype(0.49, 0.35))
+	assert.Equal(t, "X", InferKaryotype(0.5, 0.001))
+	assert.Equal(t, "XXY", InferKaryotype(1.0, 0.4))
+	assert.Equal(t, "", InferKaryotype(0.75, 0.001), "chrX is not classified")
+	assert.Equal(t, "", InferKaryotype(0.5, 0.1), "chrY is not classified")
+}
+
+func writeTestWgsMetrics(t *testing.T, outputDirectoryPath string, sampleId string, autosome float64, chrX float64, chrY float64) {
+	dir := filepath.Join(outputDirectoryPath, sampleId)
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	for region, coverage := range map[string]float64{QcAutosomeRegion: autosome, sexCheckChrXRegion: chrX, sexCheckChrYRegion: chrY} {
+		content := fmt.Sprintf("## METRICS CLASS\tpicard.analysis.WgsMetrics\nGENOME_TERRITORY\tMEAN_COVERAGE\n1000\t%g\n\n", coverage)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, sampleId+".cram."+region+".wgs_metrics"), []byte(content), 0644))
+	}
+}
+
+func Test_CheckSampleSex(t *testing.T) {
+	check := CheckSampleSex("../test/qcfiles", &Sample{SampleId: "NA12878", Sex: SexFemale})
+	assert.Equal(t, "XX", check.Karyotype)
+	assert.Equal(t, SexFemale, check.InferredSex)
+	assert.Equal(t, SexCheckMatch, check.Result)
+
+	check = CheckSampleSex("../test/qcfiles", &Sample{SampleId: "NA12878", Sex: SexMale})
+	assert.Equal(t, SexCheckMismatch, check.Result)
+
+	check = CheckSampleSex("../test/qcfiles", &Sample{SampleId: "NA12878"})
+	assert.Equal(t, SexUnknown, check.SampleSheet)
+	assert.Equal(t, SexCheckNotSpecified, check.Result)
+
+	out := t.TempDir()
+	writeTestWgsMetrics(t, out, "XX00001", 30, 22.5, 0.1)
+	check = CheckSampleSex(out, &Sample{SampleId: "XX00001", Sex: SexMale})
+	assert.Equal(t, SexCheckInconclusive, check.Result)
+
+	check = CheckSampleSex(out, &Sample{SampleId: "XX00002", Sex: SexMale})
+	assert.Equal(t, SexCheckError, check.Result, "wgs_metrics is missing")
+	assert.NotEmpty(t, check.ErrorMessage)
+}
+
+func Test_CheckSex(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	out := rss.OutputDirectory.Path
+	ss.SampleList[0].Sex = SexFemale
+	ss.SampleList[1].Sex = SexFemale
+	writeTestWgsMetrics(t, out, ss.SampleList[0].SampleId, 30, 29.5, 0.03)
+	writeTestWgsMetrics(t, out, ss.SampleList[1].SampleId, 30, 15, 10)
+	report := CheckSex(out, ss)
+	assert.Equal(t, 2, len(report.Samples))
+	assert.Equal(t, SexCheckMatch, report.Samples[0].Result)
+	assert.Equal(t, SexCheckMismatch, report.Samples[1].Result)
+	assert.Equal(t, "XY", report.Samples[1].Karyotype)
+	assert.Equal(t, 1, report.Mismatches)
+	assert.Equal(t, []string{}, report.NotFinishedSampleIds)
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Status of sample in StatusReport.
+const (
+	SampleStatusFinished   = "finished"
+	SampleStatusStale      = "stale"
+	SampleStatusRunning    = "running"
+	SampleStatusFailed     = "failed"
+	SampleStatusCancelled  = "cancelled"
+	SampleStatusNotStarted = "not_started"
+)
+
+/*
+ * An execution of the sample in outputDirectoryPath/jobManager/<timestamp>/<sampleId>.
+ * ExitCode is empty while running, or when JobManager is killed.
+ */
+type AttemptStatus struct {
+	Directory       string `json:"directory"`
+	StartedAt       string `json:"started_at"`
+	FinishedAt      string `json:"finished_at"`
+	DurationSeconds int64  `json:"duration_seconds"`
+	ExitCode        string `json:"exit_code"`
+	Running         bool   `json:"running"`
+	Killed          bool   `json:"killed"`
+	CancelledAt     string `json:"cancelled_at"`
+	Hostname        string `json:"hostname"`
+}
+
+type SampleStatus struct {
+	SampleId string          `json:"sample_id"`
+	Status   string          `json:"status"`
+	Attempts []AttemptStatus `json:"attempts"`
+	// last lines of toil log file of the latest execution
+	LogTail []string `json:"log_tail"`
+}
+
+/*
+ * Status of all samples in sample sheet.
+ */
+type StatusReport struct {
+	OutputDirectory string         `json:"output_directory"`
+	UpdatedAt       string         `json:"updated_at"`
+	Total           int            `json:"total"`
+	Finished        int            `json:"finished"`
+	Stale           int            `json:"stale"`
+	Running         int            `json:"running"`
+	Failed          int            `json:"failed"`
+	Cancelled       int            `json:"cancelled"`
+	NotStarted      int            `json:"not_started"`
+	Samples         []SampleStatus `json:"samples"`
+}
+
+/*
+ * Return last n lines of the file.
+ * Only the end of the file is read, because toil log file can be large.
+ */
+func TailFile(fn string, n int) []string {
+	result := []string{}
+	if n <= 0 {
+		return result
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		return result
+	}
+	defer f.Close()
+	fileinfo, err := f.Stat()
+	if err != nil {
+		return result
+	}
+	const maxTailBytes = 64 * 1024
+	offset := fileinfo.Size() - maxTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return result
+	}
+	raw, err := ioutil.ReadAll(f)
+	if err != nil {
+		return result
+	}
+	lines := strings.Split(strings.TrimRight(string(raw), "\n"), "\n")
+	if offset > 0 && len(lines) > 1 {
+		// first line may be partial
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return result
+	}
+	return lines
+}
+
+/*
+ * Collect status of the execution in the job manager directory.
+ * Start time is the timestamp directory, and finish time is modification time of exitcode file.
+ */
+func CollectAttemptStatus(jobManagerDirectory string) AttemptStatus {
+	attempt := AttemptStatus{
+		Directory: jobManagerDirectory,
+		StartedAt: filepath.Base(filepath.Dir(jobManagerDirectory)),
+	}
+	startedAt, startErr := parseCurrentTime(attempt.StartedAt)
+	isRunning, record := IsAttemptRunning(jobManagerDirectory)
+	if record != nil {
+		attempt.Hostname = record.Hostname
+	}
+	exitcodeFilePath := filepath.Join(jobManagerDirectory, "toil.exitcode.txt")
+	if fileinfo, err := os.Stat(exitcodeFilePath); err == nil {
+		attempt.ExitCode = GetExitCodeContent(exitcodeFilePath)
+		attempt.FinishedAt = fileinfo.ModTime().Format("20060102150405")
+		if startErr == nil {
+			attempt.DurationSeconds = int64(fileinfo.ModTime().Sub(startedAt).Seconds())
+		}
+	} else if isRunning {
+		attempt.Running = true
+		if startErr == nil {
+			attempt.DurationSeconds = int64(time.Since(startedAt).Seconds())
+		}
+	} else {
+		attempt.Killed = true
+	}
+	cancelledFilePath := filepath.Join(jobManagerDirectory, CancelledFileName)
+	if IsExistsFile(cancelledFilePath) {
+		attempt.CancelledAt = GetExitCodeContent(cancelledFilePath)
+	}
+	return attempt
+}
+
+/*
+ * Collect status of all samples in sample sheet.
+ * Samples are classified in the same way as `show-job-progress`.
+ * logTailLines lines of toil log file of the latest execution are included for not finished samples.
+ */
+func CollectStatusReport(outputDirectoryPath string, ss *SimpleSchema, rss *ReferenceSchema, toolVersion string, logTailLines int) *StatusReport {
+	report := &StatusReport{
+		OutputDirectory: outputDirectoryPath,
+		UpdatedAt:       GetCurrentTime(),
+		Total:           len(ss.SampleList),
+		Samples:         []SampleStatus{},
+	}
+	execSampleIdList := CreateExecuteSampleIDList(outputDirectoryPath, ss)
+	staleSampleIdList := CreateStaleSampleIDList(outputDirectoryPath, ss, rss, execSampleIdList, toolVersion)
+	isExecute := map[string]bool{}
+	for _, sampleId := range execSampleIdList {
+		isExecute[sampleId] = true
+	}
+	isStale := map[string]bool{}
+	for _, sampleId := range staleSampleIdList {
+		isStale[sampleId] = true
+	}
+	for _, s := range ss.SampleList {
+		sample := SampleStatus{SampleId: s.SampleId, Attempts: []AttemptStatus{}, LogTail: []string{}}
+		attemptDirectories := ListSampleAttemptDirectories(outputDirectoryPath, s.SampleId)
+		for _, jobManagerDirectory := range attemptDirectories {
+			sample.Attempts = append(sample.Attempts, CollectAttemptStatus(jobManagerDirectory))
+		}
+		switch {
+		case isStale[s.SampleId]:
+			sample.Status = SampleStatusStale
+			report.Stale += 1
+		case !isExecute[s.SampleId]:
+			sample.Status = SampleStatusFinished
+			report.Finished += 1
+		case len(sample.Attempts) == 0:
+			sample.Status = SampleStatusNotStarted
+			report.NotStarted += 1
+		case sample.Attempts[0].Running:
+			sample.Status = SampleStatusRunning
+			report.Running += 1
+		case sample.Attempts[0].CancelledAt != "":
+			sample.Status = SampleStatusCancelled
+			report.Cancelled += 1
+		default:
+			sample.Status = SampleStatusFailed
+			report.Failed += 1
+		}
+		if isExecute[s.SampleId] && len(attemptDirectories) > 0 {
+			sample.LogTail = TailFile(createLogFilePath(attemptDirectories[0], s.SampleId), logTailLines)
+			if len(sample.LogTail) == 0 {
+				sample.LogTail = TailFile(filepath.Join(attemptDirectories[0], "toil.stderr.txt"), logTailLines)
+			}
+		}
+		report.Samples = append(report.Samples, sample)
+	}
+	return report
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TailFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "toil.log")
+	lines := []string{}
+	for i := 1; i <= 30; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	ioutil.WriteFile(fn, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	assert.Equal(t, []string{"line 28", "line 29", "line 30"}, TailFile(fn, 3))
+	assert.Equal(t, 30, len(TailFile(fn, 100)))
+	assert.Equal(t, []string{}, TailFile(fn, 0))
+	assert.Equal(t, []string{}, TailFile(fn+".missing", 3))
+}
+
+func Test_TailFile_large(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "toil.log")
+	ioutil.WriteFile(fn, []byte(strings.Repeat("x", 100*1024)+"\nlast line\n"), 0644)
+	assert.Equal(t, []string{"last line"}, TailFile(fn, 2), "partial first line is dropped")
+}
+
+func Test_CollectStatusReport(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	outputDirectoryPath := rss.OutputDirectory.Path
+	// first sample failed, second sample is not started
+	failed := createTestAttempt(t, outputDirectoryPath, "20211101145001", ss.SampleList[0].SampleId, "1", false)
+	os.MkdirAll(filepath.Join(failed, "logs"), 0755)
+	ioutil.WriteFile(createLogFilePath(failed, ss.SampleList[0].SampleId), []byte("start\nERROR: failed\n"), 0644)
+	report := CollectStatusReport(outputDirectoryPath, ss, rss, "test", 1)
+	assert.Equal(t, len(ss.SampleList), report.Total)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, SampleStatusFailed, report.Samples[0].Status)
+	assert.Equal(t, "1", report.Samples[0].Attempts[0].ExitCode)
+	assert.Equal(t, "20211101145001", report.Samples[0].Attempts[0].StartedAt)
+	assert.Equal(t, []string{"ERROR: failed"}, report.Samples[0].LogTail)
+	assert.Equal(t, SampleStatusNotStarted, report.Samples[1].Status)
+}
+
+func Test_CollectAttemptStatus_killed(t *testing.T) {
+	attemptDirectory := createTestAttempt(t, t.TempDir(), "20211101145001", "XX00001", "", false)
+	attempt := CollectAttemptStatus(attemptDirectory)
+	assert.True(t, attempt.Killed, "exitcode file is missing and not running")
+	assert.False(t, attempt.Running)
+}
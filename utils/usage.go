@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Output of `toil stats --raw` saved in job manager directory.
+// jobStore may be removed later, so it is saved when it is read first.
+const ToilStatsFileName = "toil.stats.json"
+
+/*
+ * Resource usage of a CWL step in an execution.
+ * Memory is peak RSS reported by toil in KiB.
+ */
+type StepUsage struct {
+	Step            string  `json:"step"`
+	Jobs            int     `json:"jobs"`
+	WallTimeSeconds float64 `json:"wall_time_seconds"`
+	CpuTimeSeconds  float64 `json:"cpu_time_seconds"`
+	PeakMemoryKiB   float64 `json:"peak_memory_kib"`
+}
+
+/*
+ * Resource usage of the latest successful execution of a sample.
+ */
+type SampleUsage struct {
+	SampleId            string      `json:"sample_id"`
+	JobManagerDirectory string      `json:"jobmanager_directory"`
+	WallTimeSeconds     float64     `json:"wall_time_seconds"`
+	CpuTimeSeconds      float64     `json:"cpu_time_seconds"`
+	PeakMemoryKiB       float64     `json:"peak_memory_kib"`
+	Jobs                int         `json:"jobs"`
+	Steps               []StepUsage `json:"steps"`
+}
+
+/*
+ * Resource usage of a CWL step aggregated across samples.
+ */
+type StepUsageSummary struct {
+	Step                string  `json:"step"`
+	Samples             int     `json:"samples"`
+	MeanWallTimeSeconds float64 `json:"mean_wall_time_seconds"`
+	MaxWallTimeSeconds  float64 `json:"max_wall_time_seconds"`
+	MeanCpuTimeSeconds  float64 `json:"mean_cpu_time_seconds"`
+	MaxCpuTimeSeconds   float64 `json:"max_cpu_time_seconds"`
+	MaxPeakMemoryKiB    float64 `json:"max_peak_memory_kib"`
+}
+
+type UsageReport struct {
+	Samples []SampleUsage      `json:"samples"`
+	Steps   []StepUsageSummary `json:"steps"`
+	// samples without successful execution or toil stats
+	MissingSampleIds []string `json:"missing_sample_ids"`
+}
+
+// values of toil stats are number or string
+func toilStatsNumber(m map[string]interface{}, key string) float64 {
+	switch v := m[key].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
+
+/*
+ * Step name from toil job name.
+ * CWL job name can be the tool URI, such as file:///.../bwa.cwl#bwa_mem
+ */
+func toilStatsStepName(name string) string {
+	if index := strings.LastIndex(name, "#"); index >= 0 {
+		name = name[index+1:]
+	}
+	return name
+}
+
+/*
+ * Parse output of `toil stats --raw`.
+ */
+func ParseToilStats(raw []byte) (*SampleUsage, error) {
+	var stats map[string]interface{}
+	if err := json.Unmarshal(raw, &stats); err != nil {
+		return nil, err
+	}
+	usage := &SampleUsage{
+		WallTimeSeconds: toilStatsNumber(stats, "total_run_time"),
+		CpuTimeSeconds:  toilStatsNumber(stats, "total_clock"),
+		Steps:           []StepUsage{},
+	}
+	if jobs, ok := stats["jobs"].(map[string]interface{}); ok {
+		usage.Jobs = int(toilStatsNumber(jobs, "total_number"))
+	}
+	steps := map[string]*StepUsage{}
+	jobTypes, _ := stats["job_types"].([]interface{})
+	for _, jobType := range jobTypes {
+		m, ok := jobType.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := m["name"].(string)
+		step := toilStatsStepName(name)
+		if steps[step] == nil {
+			steps[step] = &StepUsage{Step: step}
+		}
+		steps[step].Jobs += int(toilStatsNumber(m, "total_number"))
+		steps[step].WallTimeSeconds += toilStatsNumber(m, "total_time")
+		steps[step].CpuTimeSeconds += toilStatsNumber(m, "total_clock")
+		if memory := toilStatsNumber(m, "max_memory"); memory > steps[step].PeakMemoryKiB {
+			steps[step].PeakMemoryKiB = memory
+		}
+	}
+	for _, step := range steps {
+		usage.Steps = append(usage.Steps, *step)
+		if step.PeakMemoryKiB > usage.PeakMemoryKiB {
+			usage.PeakMemoryKiB = step.PeakMemoryKiB
+		}
+	}
+	sort.Slice(usage.Steps, func(i, j int) bool {
+		return usage.Steps[i].Step < usage.Steps[j].Step
+	})
+	return usage, nil
+}
+
+/*
+ * Read toil stats of the execution.
+ * Saved file is used if exists. Otherwise `toil stats --raw` is executed for jobStore and saved.
+ */
+func LoadToilStats(jobManagerDirectory string) ([]byte, error) {
+	if raw, err := ioutil.ReadFile(filepath.Join(jobManagerDirectory, ToilStatsFileName)); err == nil {
+		return raw, nil
+	}
+	return SaveToilStats(jobManagerDirectory)
+}
+
+/*
+ * Execute `toil stats --raw` for jobStore of the execution and save it in job manager directory.
+ * `run` saves it when the execution is successfully finished, so the stats is kept after jobStore is removed.
+ */
+func SaveToilStats(jobManagerDirectory string) ([]byte, error) {
+	jobStoreDir := GetAttemptJobStore(jobManagerDirectory)
+	if !IsUsableJobStore(jobStoreDir) {
+		return nil, fmt.Errorf("jobStore [%s] is not found", jobStoreDir)
+	}
+	raw, err := exec.Command("toil", "stats", "--raw", jobStoreDir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("toil stats %s: %v", jobStoreDir, err)
+	}
+	if _, err := ParseToilStats(raw); err != nil {
+		return nil, fmt.Errorf("toil stats %s: %v", jobStoreDir, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(jobManagerDirectory, ToilStatsFileName), raw, 0644); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+/*
+ * Collect resource usage of the latest successful execution of each sample.
+ */
+func CollectUsageReport(outputDirectoryPath string, ss *SimpleSchema) *UsageReport {
+	report := &UsageReport{Samples: []SampleUsage{}, Steps: []StepUsageSummary{}, MissingSampleIds: []string{}}
+	for _, s := range ss.SampleList {
+		var usage *SampleUsage
+		for _, jobManagerDirectory := range ListSampleAttemptDirectories(outputDirectoryPath, s.SampleId) {
+			if GetExitCodeContent(filepath.Join(jobManagerDirectory, "toil.exitcode.txt")) != "0" {
+				continue
+			}
+			raw, err := LoadToilStats(jobManagerDirectory)
+			if err != nil {
+				fmt.Printf("SampleId: %s %v\n", s.SampleId, err)
+				break
+			}
+			if usage, err = ParseToilStats(raw); err != nil {
+				fmt.Printf("SampleId: %s %v\n", s.SampleId, err)
+				break
+			}
+			usage.SampleId = s.SampleId
+			usage.JobManagerDirectory = jobManagerDirectory
+			break
+		}
+		if usage == nil {
+			report.MissingSampleIds = append(report.MissingSampleIds, s.SampleId)
+			continue
+		}
+		report.Samples = append(report.Samples, *usage)
+	}
+	report.Steps = SummarizeStepUsage(report.Samples)
+	return report
+}
+
+/*
+ * Aggregate usage of each step across samples.
+ */
+func SummarizeStepUsage(samples []SampleUsage) []StepUsageSummary {
+	summaries := map[string]*StepUsageSummary{}
+	for _, sample := range samples {
+		for _, step := range sample.Steps {
+			summary := summaries[step.Step]
+			if summary == nil {
+				summary = &StepUsageSummary{Step: step.Step}
+				summaries[step.Step] = summary
+			}
+			summary.Samples += 1
+			// sum is divided by samples later
+			summary.MeanWallTimeSeconds += step.WallTimeSeconds
+			summary.MeanCpuTimeSeconds += step.CpuTimeSeconds
+			if step.WallTimeSeconds > summary.MaxWallTimeSeconds {
+				summary.MaxWallTimeSeconds = step.WallTimeSeconds
+			}
+			if step.CpuTimeSeconds > summary.MaxCpuTimeSeconds {
+				summary.MaxCpuTimeSeconds = step.CpuTimeSeconds
+			}
+			if step.PeakMemoryKiB > summary.MaxPeakMemoryKiB {
+				summary.MaxPeakMemoryKiB = step.PeakMemoryKiB
+			}
+		}
+	}
+	result := []StepUsageSummary{}
+	for _, summary := range summaries {
+		summary.MeanWallTimeSeconds /= float64(summary.Samples)
+		summary.MeanCpuTimeSeconds /= float64(summary.Samples)
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Step < result[j].Step
+	})
+	return result
+}
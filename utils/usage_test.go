@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseToilStats(t *testing.T) {
+	raw, err := ioutil.ReadFile("../test/toilstats/toil-stats-raw.json")
+	assert.NoError(t, err)
+	usage, err := ParseToilStats(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, 15234.52, usage.WallTimeSeconds)
+	assert.Equal(t, 98012.3, usage.CpuTimeSeconds)
+	assert.Equal(t, 14, usage.Jobs)
+	assert.Equal(t, 31457280.0, usage.PeakMemoryKiB)
+	assert.Equal(t, 3, len(usage.Steps))
+	assert.Equal(t, StepUsage{Step: "CWLJob", Jobs: 11, WallTimeSeconds: 2199.5, CpuTimeSeconds: 6500, PeakMemoryKiB: 1048576}, usage.Steps[0], "numbers in string")
+	assert.Equal(t, "bwa_mem", usage.Steps[1].Step, "tool URI is trimmed")
+	assert.Equal(t, 2, usage.Steps[1].Jobs)
+
+	_, err = ParseToilStats([]byte("Batch System: slurm"))
+	assert.Error(t, err, "not raw output")
+}
+
+func Test_CollectUsageReport(t *testing.T) {
+	ss, rss := loadTestSampleSheetAndConfigFile(t)
+	outputDirectoryPath := rss.OutputDirectory.Path
+	raw, _ := ioutil.ReadFile("../test/toilstats/toil-stats-raw.json")
+	// failed execution after success is ignored
+	succeeded := createTestAttempt(t, outputDirectoryPath, "20211101143242", ss.SampleList[0].SampleId, "0", false)
+	ioutil.WriteFile(filepath.Join(succeeded, ToilStatsFileName), raw, 0644)
+	createTestAttempt(t, outputDirectoryPath, "20211101145001", ss.SampleList[0].SampleId, "1", false)
+	report := CollectUsageReport(outputDirectoryPath, ss)
+	assert.Equal(t, 1, len(report.Samples))
+	assert.Equal(t, succeeded, report.Samples[0].JobManagerDirectory)
+	assert.Equal(t, []string{ss.SampleList[1].SampleId}, report.MissingSampleIds)
+	assert.Equal(t, 3, len(report.Steps))
+}
+
+func Test_SaveToilStats(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	jobManagerDirectory := createTestAttempt(t, outputDirectoryPath, "20211101143242", "XX00000", "0", true)
+	statsFilePath, err := filepath.Abs("../test/toilstats/toil-stats-raw.json")
+	assert.NoError(t, err)
+	// toil which prints raw stats
+	binDirectory := t.TempDir()
+	ioutil.WriteFile(filepath.Join(binDirectory, "toil"), []byte("#!/bin/sh\ncat "+statsFilePath+"\n"), 0755)
+	t.Setenv("PATH", binDirectory+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	raw, err := SaveToilStats(jobManagerDirectory)
+	assert.NoError(t, err)
+	saved, err := ioutil.ReadFile(filepath.Join(jobManagerDirectory, ToilStatsFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, raw, saved)
+
+	// saved stats is used after jobStore is removed
+	assert.NoError(t, os.RemoveAll(filepath.Join(jobManagerDirectory, "jobStore")))
+	_, err = SaveToilStats(jobManagerDirectory)
+	assert.Error(t, err)
+	loaded, err := LoadToilStats(jobManagerDirectory)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, loaded)
+}
+
+func Test_SummarizeStepUsage(t *testing.T) {
+	samples := []SampleUsage{
+		{SampleId: "XX00001", Steps: []StepUsage{{Step: "bwa_mem", WallTimeSeconds: 100, CpuTimeSeconds: 800, PeakMemoryKiB: 1000}}},
+		{SampleId: "XX00002", Steps: []StepUsage{{Step: "bwa_mem", WallTimeSeconds: 300, CpuTimeSeconds: 1600, PeakMemoryKiB: 3000}}},
+	}
+	summaries := SummarizeStepUsage(samples)
+	assert.Equal(t, []StepUsageSummary{{Step: "bwa_mem", Samples: 2, MeanWallTimeSeconds: 200, MaxWallTimeSeconds: 300, MeanCpuTimeSeconds: 1200, MaxCpuTimeSeconds: 1600, MaxPeakMemoryKiB: 3000}}, summaries)
+}
@@ -3,10 +3,12 @@ package utils
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -37,6 +39,8 @@ type Sample struct {
 	SampleId string `json:"sampleid"`
 	Platform string `json:"platform"`
 	RunList  []*Run `json:"runlist"`
+	// optional. male, female or unknown
+	Sex string `json:"sex"`
 }
 
 type SimpleSchema struct {
@@ -70,6 +74,12 @@ type ReferenceSchema struct {
 	HaplotypecallerChrXNonPARIntervalList  *PathOnlyObject `json:"haplotypecaller_chrX_nonPAR_interval_list"`
 	HaplotypecallerChrYNonPARIntervalBed   *PathOnlyObject `json:"haplotypecaller_chrY_nonPAR_interval_bed"`
 	HaplotypecallerChrYNonPARIntervalList  *PathOnlyObject `json:"haplotypecaller_chrY_nonPAR_interval_list"`
+
+	RetryPolicy   *RetryPolicy        `json:"retry_policy"`
+	Notifications []*NotificationHook `json:"notifications"`
+	FailureRules  []*FailureRule      `json:"failure_rules"`
+	QcThresholds  *QcThresholds       `json:"qc_thresholds"`
+	DiskSpace     *DiskSpacePolicy    `json:"disk_space"`
 }
 
 // valid character expression
@@ -136,6 +146,42 @@ func outputReference(rss *ReferenceSchema) (string, error) {
 	return byteBuf.String(), nil
 }
 
+/*
+ * Reference and interval file in config file, which is required to execute workflow.
+ * Name is used in messages.
+ */
+type RequiredFile struct {
+	Name string
+	Path string
+}
+
+// path of optional object in config file. empty if it is not specified
+func pathOf(o *PathOnlyObject) string {
+	if o == nil {
+		return ""
+	}
+	return o.Path
+}
+
+/*
+ * Reference and interval files in config file, which are passed to workflow by job file.
+ * Files which are not specified have empty path, so they are treated as missing.
+ */
+func RequiredFilesForExecute(rss *ReferenceSchema) []RequiredFile {
+	return []RequiredFile{
+		{"Referenece", pathOf(rss.Reference)},
+		{"dbsnp", pathOf(rss.Dbsnp)},
+		{"mills", pathOf(rss.Mills)},
+		{"known_indels", pathOf(rss.KnownIndels)},
+		{"haplotypecaller_autosome_PAR_interval_bed", pathOf(rss.HaplotypecallerAutosomePARIntervalBed)},
+		{"haplotypecaller_autosome_PAR_interval_list", pathOf(rss.HaplotypecallerAutosomePARIntervalList)},
+		{"haplotypecaller_chrX_nonPAR_interval_bed", pathOf(rss.HaplotypecallerChrXNonPARIntervalBed)},
+		{"haplotypecaller_chrX_nonPAR_interval_list", pathOf(rss.HaplotypecallerChrXNonPARIntervalList)},
+		{"haplotypecaller_chrY_nonPAR_interval_bed", pathOf(rss.HaplotypecallerChrYNonPARIntervalBed)},
+		{"haplotypecaller_chrY_nonPAR_interval_list", pathOf(rss.HaplotypecallerChrYNonPARIntervalList)},
+	}
+}
+
 /*
  * Check files inside config file are exists.
  * Return value:
@@ -144,57 +190,12 @@ func outputReference(rss *ReferenceSchema) (string, error) {
  */
 func CheckOutputReference(rss *ReferenceSchema) bool {
 	result := true
-	// reference file
-	if !IsExistsFile(rss.Reference.Path) {
-		fmt.Printf("Referenece file [%s] is missing\n", rss.Reference.Path)
-		result = false
-	}
-	// dbsnp
-	if !IsExistsFile(rss.Dbsnp.Path) {
-		fmt.Printf("dbsnp file [%s] is missing\n", rss.Dbsnp.Path)
-		result = false
-	}
-	// mills
-	if !IsExistsFile(rss.Mills.Path) {
-		fmt.Printf("mills file [%s] is missing\n", rss.Mills.Path)
-		result = false
-	}
-	// known_indels
-	if !IsExistsFile(rss.KnownIndels.Path) {
-		fmt.Printf("known_indels file [%s] is missing\n", rss.KnownIndels.Path)
-		result = false
-	}
-	// haplotypecaller_autosome_PAR_interval_bed
-	if !IsExistsFile(rss.HaplotypecallerAutosomePARIntervalBed.Path) {
-		fmt.Printf("haplotypecaller_autosome_PAR_interval_bed file [%s] is missing\n", rss.HaplotypecallerAutosomePARIntervalBed.Path)
-		result = false
-	}
-	// haplotypecaller_autosome_PAR_interval_list
-	if !IsExistsFile(rss.HaplotypecallerAutosomePARIntervalList.Path) {
-		fmt.Printf("haplotypecaller_autosome_PAR_interval_list file [%s] is missing\n", rss.HaplotypecallerAutosomePARIntervalList.Path)
-		result = false
-	}
-	// haplotypecaller_chrX_nonPAR_interval_bed
-	if !IsExistsFile(rss.HaplotypecallerChrXNonPARIntervalBed.Path) {
-		fmt.Printf("haplotypecaller_chrX_nonPAR_interval_bed file [%s] is missing\n", rss.HaplotypecallerChrXNonPARIntervalBed.Path)
-		result = false
-	}
-	// haplotypecaller_chrX_nonPAR_interval_list
-	if !IsExistsFile(rss.HaplotypecallerChrXNonPARIntervalList.Path) {
-		fmt.Printf("haplotypecaller_chrX_nonPAR_interval_list file [%s] is missing\n", rss.HaplotypecallerChrXNonPARIntervalList.Path)
-		result = false
-	}
-	// haplotypecaller_chrY_nonPAR_interval_bed
-	if !IsExistsFile(rss.HaplotypecallerChrYNonPARIntervalBed.Path) {
-		fmt.Printf("haplotypecaller_chrY_nonPAR_interval_bed file [%s] is missing\n", rss.HaplotypecallerChrYNonPARIntervalBed.Path)
-		result = false
-	}
-	// haplotypecaller_chrY_nonPAR_interval_list
-	if !IsExistsFile(rss.HaplotypecallerChrYNonPARIntervalList.Path) {
-		fmt.Printf("haplotypecaller_chrY_nonPAR_interval_list file [%s] is missing\n", rss.HaplotypecallerChrYNonPARIntervalList.Path)
-		result = false
+	for _, f := range RequiredFilesForExecute(rss) {
+		if !IsExistsFile(f.Path) {
+			fmt.Printf("%s file [%s] is missing\n", f.Name, f.Path)
+			result = false
+		}
 	}
-
 	return result
 }
 
@@ -230,25 +231,25 @@ func CheckAndDisplayFilesForExecute(rss *ReferenceSchema) bool {
 /*
  * return value: true is fine
  */
-func CheckSampleSheetFiles(ss *SimpleSchema, fileExistsCheckFlag bool, fileHashCheckFlag bool, displayMeesage bool) bool {
+func CheckSampleSheetFiles(w io.Writer, ss *SimpleSchema, fileExistsCheckFlag bool, fileHashCheckFlag bool, displayMeesage bool) bool {
 	checkResult := true
 	for _, s := range ss.SampleList {
-		//fmt.Printf("Check index: %d, SampleId: %s\n", i, s.SampleId)
+		//fmt.Fprintf(w, "Check index: %d, SampleId: %s\n", i, s.SampleId)
 		for j, t := range s.RunList {
-			r1, _ := CheckRunData(&t.RunData, fileExistsCheckFlag, fileHashCheckFlag)
+			r1, _ := checkRunData(w, &t.RunData, fileExistsCheckFlag, fileHashCheckFlag)
 			checkResult = checkResult && r1
 			if !r1 {
-				fmt.Println("At sample sheet check. Some error found. Sample Not exist or Hash value error")
-				fmt.Printf("Check index: %d, RunId: %s\n", j, t.RunId)
-				fmt.Printf("pe or se: [%s]\n", t.RunData.PEOrSE)
-				fmt.Printf("fq1: [%s]\n", t.RunData.FQ1)
-				fmt.Printf("fq2: [%s]\n", t.RunData.FQ2)
-				fmt.Printf("result=%t\n", r1)
+				fmt.Fprintln(w, "At sample sheet check. Some error found. Sample Not exist or Hash value error")
+				fmt.Fprintf(w, "Check index: %d, RunId: %s\n", j, t.RunId)
+				fmt.Fprintf(w, "pe or se: [%s]\n", t.RunData.PEOrSE)
+				fmt.Fprintf(w, "fq1: [%s]\n", t.RunData.FQ1)
+				fmt.Fprintf(w, "fq2: [%s]\n", t.RunData.FQ2)
+				fmt.Fprintf(w, "result=%t\n", r1)
 			}
 		}
 	}
 	if !checkResult {
-		fmt.Println("some thing wrong. do not execute")
+		fmt.Fprintln(w, "some thing wrong. do not execute")
 		//return
 	}
 	return checkResult
@@ -321,13 +322,7 @@ func CreateJobFile(jobManagerDirectory string, s *Sample, rss *ReferenceSchema)
 	}
 	defer file.Close()
 	writer := bufio.NewWriter(file)
-	// output reference data to job file per each sampleID
-	referenceData, _ := outputReference(rss)
-	if _, err := writer.WriteString(referenceData); err != nil {
-		return err
-	}
-	sampleData, _ := outputJobFile(s, rss)
-	if _, err := writer.WriteString(sampleData); err != nil {
+	if _, err := writer.WriteString(CreateJobFileContent(s, rss)); err != nil {
 		return err
 	}
 	// Flush
@@ -335,6 +330,17 @@ func CreateJobFile(jobManagerDirectory string, s *Sample, rss *ReferenceSchema)
 	return nil
 }
 
+/*
+ * Return job file contents for the sample.
+ * This is same as job-file.yaml created by CreateJobFile.
+ */
+func CreateJobFileContent(s *Sample, rss *ReferenceSchema) string {
+	// output reference data to job file per each sampleID
+	referenceData, _ := outputReference(rss)
+	sampleData, _ := outputJobFile(s, rss)
+	return referenceData + sampleData
+}
+
 func BuildVersionString(version, revision, date string) string {
 	result := fmt.Sprintf("Version: %s-%s (built at %s)\n", version, revision, date)
 	return result
@@ -402,23 +408,6 @@ func IsExistsWorkflowFile(workflowFilePath string) bool {
 	return true
 }
 
-func DisplayJobManagerRecoginition(rss *ReferenceSchema) {
-	fmt.Printf("Workflow file is exists [%t]\n", IsExistsWorkflowFile(rss.WorkflowFile.Path))
-	fmt.Printf("toil-cwl-runner is exists [%t]\n", IsExistsToilCWLRunner())
-	fmt.Printf("Using Virtualenv if true set TOIL_CHECK_ENV=True [%t]\n", IsInVirtualenv())
-
-	fmt.Printf("  Using Python virtualenv [%t]\n", IsInPythonVirtualenv())
-	fmt.Printf("  Using Conda virtual env [%t]\n", IsInCondaEnv())
-	fmt.Printf("sbatch(slurm) is exists [%t]\n", IsExistsSbatch())
-	fmt.Printf("singularity is exists [%t]\n", IsExistsSingularity())
-	result := CheckAndDisplayFilesForExecute(rss)
-	if result {
-		fmt.Println("All files for workflow Execution are found.")
-	} else {
-		fmt.Println("Some files for workflow Execution are missing.")
-	}
-}
-
 //
 
 func Md5File(filePath string) (string, error) {
@@ -431,11 +420,12 @@ func Md5File(filePath string) (string, error) {
 	defer file.Close()
 
 	hash := md5.New()
-	_, err = io.Copy(hash, file)
+	written, err := io.Copy(hash, file)
 
 	if err != nil {
 		panic(err)
 	}
+	addChecksumBytes(written)
 
 	return hex.EncodeToString(hash.Sum(nil)[:16]), nil
 }
@@ -444,13 +434,17 @@ func Md5File(filePath string) (string, error) {
  * return value: true is fine, false is some thing wrong
  */
 func CheckRunData(runData *RunData, fileExistsCheckFlag bool, fileHashCheckFlag bool) (bool, error) {
+	return checkRunData(os.Stdout, runData, fileExistsCheckFlag, fileHashCheckFlag)
+}
+
+func checkRunData(w io.Writer, runData *RunData, fileExistsCheckFlag bool, fileHashCheckFlag bool) (bool, error) {
 	result := false
 	if runData.PEOrSE == "PE" {
-		r1, _ := CheckRunDataFile(runData.FQ1, runData.FQ1_MD5, fileExistsCheckFlag, fileHashCheckFlag)
-		r2, _ := CheckRunDataFile(runData.FQ2, runData.FQ2_MD5, fileExistsCheckFlag, fileHashCheckFlag)
+		r1, _ := checkRunDataFile(w, runData.FQ1, runData.FQ1_MD5, fileExistsCheckFlag, fileHashCheckFlag)
+		r2, _ := checkRunDataFile(w, runData.FQ2, runData.FQ2_MD5, fileExistsCheckFlag, fileHashCheckFlag)
 		result = r1 && r2
 	} else {
-		result, _ = CheckRunDataFile(runData.FQ1, runData.FQ1_MD5, fileExistsCheckFlag, fileHashCheckFlag)
+		result, _ = checkRunDataFile(w, runData.FQ1, runData.FQ1_MD5, fileExistsCheckFlag, fileHashCheckFlag)
 	}
 	return result, nil
 }
@@ -469,6 +463,10 @@ func IsExistsFile(fn string) bool {
 	return true
 }
 func CheckRunDataFile(fn string, fnmd5 string, fileExistsCheckFlag bool, fileHashCheckFlag bool) (bool, error) {
+	return checkRunDataFile(os.Stdout, fn, fnmd5, fileExistsCheckFlag, fileHashCheckFlag)
+}
+
+func checkRunDataFile(w io.Writer, fn string, fnmd5 string, fileExistsCheckFlag bool, fileHashCheckFlag bool) (bool, error) {
 	// Check file existance flag is set
 	if fileExistsCheckFlag == false {
 		return true, nil
@@ -487,18 +485,73 @@ func CheckRunDataFile(fn string, fnmd5 string, fileExistsCheckFlag bool, fileHas
 		md5, _ := Md5File(fn)
 		if fnmd5 != md5 {
 			result = false
-			fmt.Printf("expected: [%s]\n", fnmd5)
-			fmt.Printf("actual  : [%s]\n", md5)
-			fmt.Println("md5 is not match")
+			fmt.Fprintf(w, "expected: [%s]\n", fnmd5)
+			fmt.Fprintf(w, "actual  : [%s]\n", md5)
+			fmt.Fprintln(w, "md5 is not match")
 		}
 	}
 	return result, nil
 }
 
+// Result files of each run: outputDirectoryPath/sampleId/runId.*
+var ResultFileExtensionsPrefixRunId = []string{".bam", ".bam.log"}
+
+// Result files of each sample: outputDirectoryPath/sampleId/sampleId.*
+var ResultFileExtensionsPrefixSampleId = []string{
+	".autosome_PAR_ploidy_2.g.vcf.gz",
+	".autosome_PAR_ploidy_2.g.vcf.gz.bcftools-stats",
+	".autosome_PAR_ploidy_2.g.vcf.gz.bcftools-stats.log",
+	".autosome_PAR_ploidy_2.g.vcf.gz.log",
+	".autosome_PAR_ploidy_2.g.vcf.gz.tbi",
+	".autosome_PAR_ploidy_2.g.vcf.gz.tbi.log",
+	".autosome_PAR_ploidy_2.g.vcf.log",
+	".bam.log",
+	".chrX_nonPAR_ploidy_1.g.vcf.gz",
+	".chrX_nonPAR_ploidy_1.g.vcf.gz.bcftools-stats",
+	".chrX_nonPAR_ploidy_1.g.vcf.gz.bcftools-stats.log",
+	".chrX_nonPAR_ploidy_1.g.vcf.gz.log",
+	".chrX_nonPAR_ploidy_1.g.vcf.gz.tbi",
+	".chrX_nonPAR_ploidy_1.g.vcf.gz.tbi.log",
+	".chrX_nonPAR_ploidy_1.g.vcf.log",
+	".chrX_nonPAR_ploidy_2.g.vcf.gz",
+	".chrX_nonPAR_ploidy_2.g.vcf.gz.bcftools-stats",
+	".chrX_nonPAR_ploidy_2.g.vcf.gz.bcftools-stats.log",
+	".chrX_nonPAR_ploidy_2.g.vcf.gz.log",
+	".chrX_nonPAR_ploidy_2.g.vcf.gz.tbi",
+	".chrX_nonPAR_ploidy_2.g.vcf.gz.tbi.log",
+	".chrX_nonPAR_ploidy_2.g.vcf.log",
+	".chrY_nonPAR_ploidy_1.g.vcf.gz",
+	".chrY_nonPAR_ploidy_1.g.vcf.gz.bcftools-stats",
+	".chrY_nonPAR_ploidy_1.g.vcf.gz.bcftools-stats.log",
+	".chrY_nonPAR_ploidy_1.g.vcf.gz.log",
+	".chrY_nonPAR_ploidy_1.g.vcf.gz.tbi",
+	".chrY_nonPAR_ploidy_1.g.vcf.gz.tbi.log",
+	".chrY_nonPAR_ploidy_1.g.vcf.log",
+	".cram",
+	".cram.autosome_PAR_ploidy_2.wgs_metrics",
+	".cram.autosome_PAR_ploidy_2.wgs_metrics.log",
+	".cram.chrX_nonPAR_ploidy_1.wgs_metrics",
+	".cram.chrX_nonPAR_ploidy_1.wgs_metrics.log",
+	".cram.chrX_nonPAR_ploidy_2.wgs_metrics",
+	".cram.chrX_nonPAR_ploidy_2.wgs_metrics.log",
+	".cram.chrY_nonPAR_ploidy_1.wgs_metrics",
+	".cram.chrY_nonPAR_ploidy_1.wgs_metrics.log",
+	".cram.collect_base_dist_by_cycle",
+	".cram.collect_base_dist_by_cycle.chart.pdf",
+	".cram.collect_base_dist_by_cycle.chart.png",
+	".cram.crai",
+	".cram.crai.log",
+	".cram.flagstat",
+	".cram.idxstats",
+	".cram.log",
+	".log",
+	".metrics.txt",
+}
+
 func IsExistsAllResultFilesPrefixRunId(outputDirectoryPath string, runId string) bool {
 	result := true
 	fn := filepath.Join(outputDirectoryPath, runId)
-	for _, extension := range []string{".bam", ".bam.log"} {
+	for _, extension := range ResultFileExtensionsPrefixRunId {
 		if _, err := os.Stat(fn + extension); os.IsNotExist(err) {
 			fmt.Printf("Missing file [%s]\n", fn+extension)
 			result = false
@@ -510,54 +563,7 @@ func IsExistsAllResultFilesPrefixRunId(outputDirectoryPath string, runId string)
 func IsExistsAllResultFilesPrefixSampleId(outputDirectoryPath string, sampleId string) bool {
 	result := true
 	fn := filepath.Join(outputDirectoryPath, sampleId)
-	for _, extension := range []string{".autosome_PAR_ploidy_2.g.vcf.gz",
-		".autosome_PAR_ploidy_2.g.vcf.gz.bcftools-stats",
-		".autosome_PAR_ploidy_2.g.vcf.gz.bcftools-stats.log",
-		".autosome_PAR_ploidy_2.g.vcf.gz.log",
-		".autosome_PAR_ploidy_2.g.vcf.gz.tbi",
-		".autosome_PAR_ploidy_2.g.vcf.gz.tbi.log",
-		".autosome_PAR_ploidy_2.g.vcf.log",
-		".bam.log",
-		".chrX_nonPAR_ploidy_1.g.vcf.gz",
-		".chrX_nonPAR_ploidy_1.g.vcf.gz.bcftools-stats",
-		".chrX_nonPAR_ploidy_1.g.vcf.gz.bcftools-stats.log",
-		".chrX_nonPAR_ploidy_1.g.vcf.gz.log",
-		".chrX_nonPAR_ploidy_1.g.vcf.gz.tbi",
-		".chrX_nonPAR_ploidy_1.g.vcf.gz.tbi.log",
-		".chrX_nonPAR_ploidy_1.g.vcf.log",
-		".chrX_nonPAR_ploidy_2.g.vcf.gz",
-		".chrX_nonPAR_ploidy_2.g.vcf.gz.bcftools-stats",
-		".chrX_nonPAR_ploidy_2.g.vcf.gz.bcftools-stats.log",
-		".chrX_nonPAR_ploidy_2.g.vcf.gz.log",
-		".chrX_nonPAR_ploidy_2.g.vcf.gz.tbi",
-		".chrX_nonPAR_ploidy_2.g.vcf.gz.tbi.log",
-		".chrX_nonPAR_ploidy_2.g.vcf.log",
-		".chrY_nonPAR_ploidy_1.g.vcf.gz",
-		".chrY_nonPAR_ploidy_1.g.vcf.gz.bcftools-stats",
-		".chrY_nonPAR_ploidy_1.g.vcf.gz.bcftools-stats.log",
-		".chrY_nonPAR_ploidy_1.g.vcf.gz.log",
-		".chrY_nonPAR_ploidy_1.g.vcf.gz.tbi",
-		".chrY_nonPAR_ploidy_1.g.vcf.gz.tbi.log",
-		".chrY_nonPAR_ploidy_1.g.vcf.log",
-		".cram",
-		".cram.autosome_PAR_ploidy_2.wgs_metrics",
-		".cram.autosome_PAR_ploidy_2.wgs_metrics.log",
-		".cram.chrX_nonPAR_ploidy_1.wgs_metrics",
-		".cram.chrX_nonPAR_ploidy_1.wgs_metrics.log",
-		".cram.chrX_nonPAR_ploidy_2.wgs_metrics",
-		".cram.chrX_nonPAR_ploidy_2.wgs_metrics.log",
-		".cram.chrY_nonPAR_ploidy_1.wgs_metrics",
-		".cram.chrY_nonPAR_ploidy_1.wgs_metrics.log",
-		".cram.collect_base_dist_by_cycle",
-		".cram.collect_base_dist_by_cycle.chart.pdf",
-		".cram.collect_base_dist_by_cycle.chart.png",
-		".cram.crai",
-		".cram.crai.log",
-		".cram.flagstat",
-		".cram.idxstats",
-		".cram.log",
-		".log",
-		".metrics.txt"} {
+	for _, extension := range ResultFileExtensionsPrefixSampleId {
 		// outputDirectoryPath/sampleId/sampleId.*
 		// outputDirectoryPath/XX00000/XX00000.*
 		targetFile := fn + "/" + sampleId + extension
@@ -587,22 +593,28 @@ func CheckSecondaryFilesExists(fn string) (bool, error) {
 	// true is exist all files
 	// false is some secodary files missing
 	result := true
-	for _, extension := range []string{".amb", ".ann", ".bwt", ".pac", ".sa", ".alt", ".fai"} {
+	for _, secondaryFile := range SecondaryFilePaths(fn) {
 		// Check file is exist
-		if _, err := os.Stat(fn + extension); os.IsNotExist(err) {
-			fmt.Printf("Missing file [%s]\n", fn+extension)
+		if _, err := os.Stat(secondaryFile); os.IsNotExist(err) {
+			fmt.Printf("Missing file [%s]\n", secondaryFile)
 			result = false
 		}
 	}
-	// ^.dict
-	dictfile := filepath.Join(filepath.Dir(fn), getFileNameWithoutExtension(fn)+".dict")
-	if _, err := os.Stat(dictfile); os.IsNotExist(err) {
-		fmt.Printf("Missing file [%s]\n", dictfile)
-		result = false
-	}
 	return result, nil
 }
 
+/*
+ * Secondary files of reference: BWA index, .fai and .dict
+ */
+func SecondaryFilePaths(fn string) []string {
+	result := []string{}
+	for _, extension := range []string{".amb", ".ann", ".bwt", ".pac", ".sa", ".alt", ".fai"} {
+		result = append(result, fn+extension)
+	}
+	// ^.dict
+	return append(result, filepath.Join(filepath.Dir(fn), getFileNameWithoutExtension(fn)+".dict"))
+}
+
 /*
  Result directory and files are exists return true.
  Something missing return false
@@ -632,7 +644,89 @@ func CheckAllResultFiles(outputDirectoryPath string, s *Sample) bool {
 	return allExists
 }
 
-func ExecCWL(sample *Sample, rss *ReferenceSchema, currentTime string) string {
+type ExecOptions struct {
+	// Version of this tool. Recorded in fingerprint.
+	ToolVersion string
+	// Restart from jobStore of the last failed execution, if it is usable.
+	Resume bool
+	// Wait time for toil-cwl-runner to stop after SIGTERM, then it is killed.
+	CancelTimeout time.Duration
+	// Counts of samples included in notification. If nil, counts are not included.
+	Summary func() *NotificationSummary
+	// Check contents of result files, not only existence and size.
+	DeepCheck bool
+}
+
+/*
+ * Execute CWL for the sample.
+ * Failed execution is retried by retry policy in config file.
+ * Each retry restarts from jobStore of the previous attempt if possible.
+ * When ctx is cancelled, running toil-cwl-runner is stopped and no more attempt is started.
+ */
+func ExecCWL(ctx context.Context, sample *Sample, rss *ReferenceSchema, currentTime string, opts *ExecOptions) string {
+	sampleId := sample.SampleId
+	policy := GetRetryPolicy(rss)
+	attemptTime := currentTime
+	resume := opts.Resume
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil {
+			fmt.Printf("SampleId: %s is cancelled before start\n", sampleId)
+			return "cancelled"
+		}
+		exitCode, jobManagerDirectory, message := execCWLAttempt(ctx, sample, rss, attemptTime, opts, resume)
+		if message != "" {
+			notifySampleFinished(sample, rss, opts, exitCode, attempt, jobManagerDirectory, message)
+			return message
+		}
+		if IsExistsFile(jobManagerDirectory + "/" + CancelledFileName) {
+			// cancelled by signal or `cancel` command. it is not notified
+			break
+		}
+		if exitCode == 0 || attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			notifySampleFinished(sample, rss, opts, exitCode, attempt, jobManagerDirectory, "")
+			break
+		}
+		if !policy.IsRetryable(exitCode, jobManagerDirectory, sampleId) {
+			fmt.Printf("SampleId: %s failure is not retryable\n", sampleId)
+			notifySampleFinished(sample, rss, opts, exitCode, attempt, jobManagerDirectory, "")
+			break
+		}
+		backoff := policy.Backoff(attempt)
+		fmt.Printf("SampleId: %s attempt %d/%d is fail. Retry after %s\n", sampleId, attempt, policy.MaxAttempts, backoff)
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		attemptTime = nextAttemptTime(rss.OutputDirectory.Path, sampleId, attemptTime)
+		resume = true
+	}
+	return ""
+}
+
+/*
+ * Fire notification hooks of finished sample.
+ * Sample is success if toil-cwl-runner is successfully finished and all result files exist.
+ */
+func notifySampleFinished(sample *Sample, rss *ReferenceSchema, opts *ExecOptions, exitCode int, attempts int, jobManagerDirectory string, message string) {
+	if len(rss.Notifications) == 0 {
+		return
+	}
+	event := NotifyEventSampleFailure
+	if exitCode == 0 && message == "" && CheckResultFiles(rss.OutputDirectory.Path, sample, opts.DeepCheck) {
+		event = NotifyEventSampleSuccess
+	}
+	e := NewSampleNotificationEvent(event, rss.OutputDirectory.Path, sample.SampleId, exitCode, attempts, jobManagerDirectory, message)
+	if opts.Summary != nil {
+		e.Summary = opts.Summary()
+	}
+	Notify(rss, e)
+}
+
+/*
+ * Execute CWL once in outputDirectoryPath/jobManager/<currentTime>/<sampleId>.
+ * Return value: exit code, job manager directory and error message if execution can not be started.
+ */
+func execCWLAttempt(ctx context.Context, sample *Sample, rss *ReferenceSchema, currentTime string, opts *ExecOptions, resume bool) (int, string, string) {
 	sampleId := sample.SampleId
 	// execute toil
 	//p, _ := os.Getwd()
@@ -646,21 +740,112 @@ func ExecCWL(sample *Sample, rss *ReferenceSchema, currentTime string) string {
 	if err := os.MkdirAll(jobManagerDirectory, 0755); err != nil {
 		fmt.Println(err)
 		fmt.Println("cannot create output directory")
-		return "cannot create output directory"
+		return -1, jobManagerDirectory, "cannot create output directory"
 	}
 	// for toil-cwl-runner created logfile
 	if err := os.MkdirAll(jobManagerDirectory+"/logs", 0755); err != nil {
 		fmt.Println(err)
 		fmt.Println("cannot create logs directory for toil-cwl-runner created logfile")
-		return "cannot create logs directory for toil-cwl-runner created logfile"
+		return -1, jobManagerDirectory, "cannot create logs directory for toil-cwl-runner created logfile"
 	}
+	// record running state until exitcode file is created
+	heartbeat := startHeartbeat(jobManagerDirectory)
+	defer heartbeat.Stop()
 
 	// Create job file for CWL
 	CreateJobFile(jobManagerDirectory, sample, rss)
+	// Record fingerprint of inputs. This is copied to result directory when execution is successfully finished.
+	fingerprint, err := CreateFingerprint(sample, rss, opts.ToolVersion)
+	if err != nil {
+		fmt.Printf("Can not create fingerprint SampleId[%s]: %v\n", sampleId, err)
+	} else if err := WriteFingerprint(jobManagerDirectory+"/"+FingerprintFileName, fingerprint); err != nil {
+		fmt.Printf("Can not write fingerprint SampleId[%s]: %v\n", sampleId, err)
+	}
 	// outdir is using as CWL output directory. All files is here, if CWL execution is sucessfully finished.
 	outdir := rss.OutputDirectory.Path + "/" + sampleId
+	// jobStore of this execution. If resume, jobStore of the last failed execution is used.
+	jobStoreDir := jobManagerDirectory + "/jobStore"
+	restart := false
+	if resume {
+		resumeJobStoreDir := FindResumableJobStore(rss.OutputDirectory.Path, sampleId, currentTime)
+		if resumeJobStoreDir != "" {
+			fmt.Printf("SampleId: %s is restarted from jobStore [%s]\n", sampleId, resumeJobStoreDir)
+			jobStoreDir = resumeJobStoreDir
+			restart = true
+		} else {
+			fmt.Printf("SampleId: %s has no usable jobStore to restart. Execute new.\n", sampleId)
+		}
+	}
 	// Create Command Line Arguments for CWL execution
-	commandArgs := createToilCwlRunnerArguments(outdir, jobManagerDirectory, sampleId, rss.WorkflowFile.Path, currentTime)
+	commandArgs := createToilCwlRunnerArguments(outdir, jobManagerDirectory, jobStoreDir, sampleId, rss.WorkflowFile.Path, restart)
+	exitCode, cancelled := -1, true
+	// `cancel` command may mark this execution as cancelled before toil-cwl-runner is started
+	if !IsExistsFile(jobManagerDirectory + "/" + CancelledFileName) {
+		exitCode, cancelled = runToilCwlRunner(ctx, jobManagerDirectory, jobStoreDir, commandArgs, rss, opts.CancelTimeout, heartbeat)
+	}
+	if restart && exitCode != 0 && !cancelled && IsJobStoreError(jobManagerDirectory+"/toil.stderr.txt") {
+		// jobStore can not be used by toil. keep logs of restart and execute new
+		fmt.Printf("SampleId: %s can not be restarted from jobStore [%s]. Execute new.\n", sampleId, jobStoreDir)
+		os.Rename(jobManagerDirectory+"/toil.stdout.txt", jobManagerDirectory+"/toil.restart.stdout.txt")
+		os.Rename(jobManagerDirectory+"/toil.stderr.txt", jobManagerDirectory+"/toil.restart.stderr.txt")
+		jobStoreDir = jobManagerDirectory + "/jobStore"
+		commandArgs = createToilCwlRunnerArguments(outdir, jobManagerDirectory, jobStoreDir, sampleId, rss.WorkflowFile.Path, false)
+		exitCode, cancelled = runToilCwlRunner(ctx, jobManagerDirectory, jobStoreDir, commandArgs, rss, opts.CancelTimeout, heartbeat)
+	}
+	// output exitcode
+	exitcodefile, _ := os.Create(jobManagerDirectory + "/toil.exitcode.txt")
+	defer exitcodefile.Close()
+	exitcodefile.WriteString(fmt.Sprintf("%d\n", exitCode))
+	// cancelled by signal to this process, or `cancel` command from another terminal
+	cancelled = cancelled || IsExistsFile(jobManagerDirectory+"/"+CancelledFileName)
+	if cancelled {
+		if !IsExistsFile(jobManagerDirectory + "/" + CancelledFileName) {
+			ioutil.WriteFile(jobManagerDirectory+"/"+CancelledFileName, []byte(GetCurrentTime()+"\n"), 0644)
+		}
+		fmt.Printf("SampleId: %s is cancelled. exitcode = %d\n", sampleId, exitCode)
+		return exitCode, jobManagerDirectory, ""
+	}
+	//
+	displayErrorMessageFlag := false
+	// display messages depending on exitCode
+	if exitCode == 0 {
+		// keep resource usage for `report-usage`, even if jobStore is removed later
+		if _, err := SaveToilStats(jobManagerDirectory); err != nil {
+			fmt.Printf("Can not save toil stats SampleId[%s]: %v\n", sampleId, err)
+		}
+		if CheckResultFiles(rss.OutputDirectory.Path, sample, opts.DeepCheck) {
+			if fingerprint != nil {
+				if err := WriteFingerprint(ResultFingerprintFilePath(rss.OutputDirectory.Path, sampleId), fingerprint); err != nil {
+					fmt.Printf("Can not write fingerprint SampleId[%s]: %v\n", sampleId, err)
+				}
+			}
+			fmt.Printf("SampleId: %s is successfully finished\n", sampleId)
+		} else {
+			displayErrorMessageFlag = true
+		}
+	} else {
+		displayErrorMessageFlag = true
+	}
+	if displayErrorMessageFlag {
+		stdoutfileabs, _ := filepath.Abs(jobManagerDirectory + "/toil.stdout.txt")
+		stderrfileabs, _ := filepath.Abs(jobManagerDirectory + "/toil.stderr.txt")
+
+		fmt.Printf("SampleId: %s is fail. exitcode = %d\n", sampleId, exitCode)
+		fmt.Println("  See stdout: ", stdoutfileabs)
+		fmt.Println("  See stderr: ", stderrfileabs)
+	}
+	//
+	return exitCode, jobManagerDirectory, ""
+}
+
+/*
+ * Execute toil-cwl-runner and wait.
+ * stdout and stderr are saved in jobManagerDirectory.
+ * Return value: exit code of toil-cwl-runner, and true if it is cancelled
+ */
+func runToilCwlRunner(ctx context.Context, jobManagerDirectory string, jobStoreDir string, commandArgs []string, rss *ReferenceSchema, cancelTimeout time.Duration, heartbeat *attemptHeartbeat) (int, bool) {
+	// record jobStore path. jobStore is not under jobManagerDirectory when restarted.
+	ioutil.WriteFile(jobManagerDirectory+"/"+JobStorePathFileName, []byte(jobStoreDir+"\n"), 0644)
 	// Create Command.
 	c1 := exec.Command("toil-cwl-runner", commandArgs...)
 	// Set environment value if needed
@@ -671,6 +856,10 @@ func ExecCWL(sample *Sample, rss *ReferenceSchema, currentTime string) string {
 	}
 	// TODO support docker
 	scriptEnv = append(scriptEnv, "CWL_SINGULARITY_CACHE="+rss.ContainerCacheDirectory.Path)
+	// record Slurm job ids by sbatch wrapper, `cancel --scancel` uses this
+	if wrapperDirectory, err := WriteSbatchWrapper(jobManagerDirectory); err == nil {
+		scriptEnv = append(scriptEnv, "PATH="+wrapperDirectory+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
 	c1.Env = scriptEnv
 	// Currently do not set other environment value by JobManager
 	//
@@ -682,44 +871,15 @@ func ExecCWL(sample *Sample, rss *ReferenceSchema, currentTime string) string {
 	defer stderrfile.Close()
 	c1.Stderr = stderrfile
 	//
-	c1.Start()
-	c1.Wait()
-	// output exitcode
-	exitcodefile, _ := os.Create(jobManagerDirectory + "/toil.exitcode.txt")
-	defer exitcodefile.Close()
-	exitCode := c1.ProcessState.ExitCode()
-	exitcodefile.WriteString(fmt.Sprintf("%d\n", exitCode))
-	//
-	stdoutwriter := bufio.NewWriter(stdoutfile)
-	defer stdoutwriter.Flush()
-	//
-	stderrwriter := bufio.NewWriter(stderrfile)
-	defer stderrwriter.Flush()
-	//
-	defer func() {
-		//
-		displayErrorMessageFlag := false
-		// display messages depending on exitCode
-		if exitCode == 0 {
-			if CheckAllResultFiles(rss.OutputDirectory.Path, sample) {
-				fmt.Printf("SampleId: %s is successfully finished\n", sampleId)
-			} else {
-				displayErrorMessageFlag = true
-			}
-		} else {
-			displayErrorMessageFlag = true
-		}
-		if displayErrorMessageFlag {
-			stdoutfileabs, _ := filepath.Abs(stdoutfile.Name())
-			stderrfileabs, _ := filepath.Abs(stderrfile.Name())
-
-			fmt.Printf("SampleId: %s is fail. exitcode = %d\n", sampleId, exitCode)
-			fmt.Println("  See stdout: ", stdoutfileabs)
-			fmt.Println("  See stderr: ", stderrfileabs)
-		}
-	}()
-	//
-	return ""
+	cancelled, err := startAndWaitProcessGroup(ctx, c1, cancelTimeout, func(pgid int) {
+		// record process, `cancel` command uses this
+		heartbeat.setProcess(c1.Process.Pid, pgid)
+	})
+	if err != nil {
+		fmt.Fprintln(stderrfile, err)
+		return -1, false
+	}
+	return c1.ProcessState.ExitCode(), cancelled
 }
 
 func GetCurrentTime() string {
@@ -730,11 +890,14 @@ func createLogFilePath(jobManagerDirectory string, sampleId string) string {
 	return jobManagerDirectory + "/logs/" + sampleId + ".log"
 }
 
-func createToilCwlRunnerArguments(outdir string, jobManagerDirectory string, sampleId string, workflowFilePath string, currentTime string) []string {
+func createToilCwlRunnerArguments(outdir string, jobManagerDirectory string, jobStoreDir string, sampleId string, workflowFilePath string, restart bool) []string {
 
-	jobStoreDir := jobManagerDirectory + "/jobStore"
 	logFilePath := createLogFilePath(jobManagerDirectory, sampleId)
-	commandArgs := []string{"--maxDisk", "248G", "--maxMemory", "64G", "--defaultMemory", "32000", "--defaultDisk", "32000", "--disableCaching", "--jobStore", jobStoreDir, "--outdir", outdir, "--stats", "--batchSystem", "slurm", "--retryCount", "1", "--singularity", "--logFile", logFilePath, workflowFilePath, jobManagerDirectory + "/job-file.yaml"}
+	commandArgs := []string{"--maxDisk", "248G", "--maxMemory", "64G", "--defaultMemory", "32000", "--defaultDisk", "32000", "--disableCaching", "--jobStore", jobStoreDir, "--outdir", outdir, "--stats", "--batchSystem", "slurm", "--retryCount", "1", "--singularity", "--logFile", logFilePath}
+	if restart {
+		commandArgs = append(commandArgs, "--restart")
+	}
+	commandArgs = append(commandArgs, workflowFilePath, jobManagerDirectory+"/job-file.yaml")
 	return commandArgs
 }
 
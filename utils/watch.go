@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Status file of `run --watch` in output directory. Updated every cycle.
+const WatchStatusFileName = "jobmanager.watch-status.json"
+
+/*
+ * Status of `run --watch`.
+ * State is "watching" while running, and "stopped" after interrupted.
+ */
+type WatchStatus struct {
+	State       string `json:"state"`
+	Hostname    string `json:"hostname"`
+	Pid         int    `json:"pid"`
+	SampleSheet string `json:"samplesheet"`
+	StartedAt   string `json:"started_at"`
+	UpdatedAt   string `json:"updated_at"`
+	NextCheckAt string `json:"next_check_at"`
+	Cycle       int    `json:"cycle"`
+
+	Total    int `json:"total"`
+	Finished int `json:"finished"`
+	Running  int `json:"running"`
+	Failed   int `json:"failed"`
+	Waiting  int `json:"waiting"`
+
+	RunningSampleIds []string `json:"running_sample_ids"`
+	FailedSampleIds  []string `json:"failed_sample_ids"`
+	// sample ids in sample sheet, but their files are not valid yet. checked again next cycle.
+	InvalidSampleIds []string `json:"invalid_sample_ids"`
+}
+
+func WatchStatusFilePath(outputDirectoryPath string) string {
+	return filepath.Join(outputDirectoryPath, WatchStatusFileName)
+}
+
+/*
+ * Write status file. It is replaced by rename, so reader does not see partial file.
+ */
+func WriteWatchStatus(outputDirectoryPath string, status *WatchStatus) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	statusFilePath := WatchStatusFilePath(outputDirectoryPath)
+	if err := ioutil.WriteFile(statusFilePath+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(statusFilePath+".tmp", statusFilePath)
+}
+
+func ReadWatchStatus(outputDirectoryPath string) (*WatchStatus, error) {
+	raw, err := ioutil.ReadFile(WatchStatusFilePath(outputDirectoryPath))
+	if err != nil {
+		return nil, err
+	}
+	var status WatchStatus
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+/*
+ * Return samples in ss which sample id is not in knownSampleIds.
+ * If same sample id appears twice, the first one is used.
+ */
+func FindNewSamples(ss *SimpleSchema, knownSampleIds map[string]bool) []*Sample {
+	result := []*Sample{}
+	found := map[string]bool{}
+	for _, s := range ss.SampleList {
+		if knownSampleIds[s.SampleId] || found[s.SampleId] {
+			continue
+		}
+		found[s.SampleId] = true
+		result = append(result, s)
+	}
+	return result
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WriteWatchStatus(t *testing.T) {
+	outputDirectoryPath := t.TempDir()
+	status := &WatchStatus{State: "watching", Cycle: 2, Total: 3, RunningSampleIds: []string{"XX00001"}}
+	assert.NoError(t, WriteWatchStatus(outputDirectoryPath, status))
+	status.Cycle = 3
+	assert.NoError(t, WriteWatchStatus(outputDirectoryPath, status))
+	result, err := ReadWatchStatus(outputDirectoryPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Cycle)
+	assert.Equal(t, []string{"XX00001"}, result.RunningSampleIds)
+	assert.False(t, IsExistsFile(WatchStatusFilePath(outputDirectoryPath)+".tmp"))
+}
+
+func Test_FindNewSamples(t *testing.T) {
+	ss := &SimpleSchema{SampleList: []*Sample{{SampleId: "XX00001"}, {SampleId: "XX00002"}, {SampleId: "XX00003"}, {SampleId: "XX00002"}}}
+	result := FindNewSamples(ss, map[string]bool{"XX00001": true})
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "XX00002", result[0].SampleId)
+	assert.Equal(t, "XX00003", result[1].SampleId)
+}